@@ -0,0 +1,113 @@
+package auth
+
+import (
+	"testing"
+	"time"
+)
+
+// useTestKeyRing installs an HS256 key ring for the duration of the test
+func useTestKeyRing(t *testing.T) {
+	t.Helper()
+	r, err := LoadKeyRing(KeyRingConfig{Secret: "test-secret"})
+	if err != nil {
+		t.Fatalf("LoadKeyRing: %v", err)
+	}
+	previous := keyRing
+	SetKeyRing(r)
+	t.Cleanup(func() { SetKeyRing(previous) })
+}
+
+func TestActionToken(t *testing.T) {
+	useTestKeyRing(t)
+
+	token, err := GenerateActionToken(PurposeResetPassword, 42, "dave@example.com", "hash", time.Hour)
+	if err != nil {
+		t.Fatalf("GenerateActionToken: %v", err)
+	}
+
+	claims, err := ValidateActionToken(token, PurposeResetPassword)
+	if err != nil {
+		t.Fatalf("ValidateActionToken: %v", err)
+	}
+	if id, err := claims.UserID(); err != nil || id != 42 {
+		t.Errorf("UserID: got %d, %v, want 42", id, err)
+	}
+	if claims.Email != "dave@example.com" || claims.ID == "" {
+		t.Errorf("got claims %+v, want the email and a token ID", claims)
+	}
+	if claims.PasswordHash != PasswordFingerprint("hash") || claims.PasswordHash == PasswordFingerprint("new hash") {
+		t.Errorf("got password fingerprint %q, want one that changes with the password", claims.PasswordHash)
+	}
+}
+
+func TestActionTokenIDsAreUnique(t *testing.T) {
+	useTestKeyRing(t)
+
+	seen := make(map[string]bool)
+	for i := 0; i < 10; i++ {
+		token, err := GenerateActionToken(PurposeVerifyEmail, 1, "dave@example.com", "", time.Hour)
+		if err != nil {
+			t.Fatalf("GenerateActionToken: %v", err)
+		}
+		claims, err := ValidateActionToken(token, PurposeVerifyEmail)
+		if err != nil {
+			t.Fatalf("ValidateActionToken: %v", err)
+		}
+		if seen[claims.ID] {
+			t.Fatalf("token ID %q issued twice", claims.ID)
+		}
+		seen[claims.ID] = true
+	}
+}
+
+func TestActionTokenRejectsOtherPurposes(t *testing.T) {
+	useTestKeyRing(t)
+
+	token, err := GenerateActionToken(PurposeVerifyEmail, 1, "dave@example.com", "", time.Hour)
+	if err != nil {
+		t.Fatalf("GenerateActionToken: %v", err)
+	}
+	if _, err := ValidateActionToken(token, PurposeResetPassword); err == nil {
+		t.Error("verification token accepted for a password reset")
+	}
+	if _, err := ValidateToken(token); err == nil {
+		t.Error("verification token accepted as an access token")
+	}
+
+	access, err := GenerateToken(1, "dave@example.com", "session")
+	if err != nil {
+		t.Fatalf("GenerateToken: %v", err)
+	}
+	if _, err := ValidateActionToken(access, PurposeVerifyEmail); err == nil {
+		t.Error("access token accepted as a verification token")
+	}
+}
+
+func TestActionTokenExpires(t *testing.T) {
+	useTestKeyRing(t)
+
+	token, err := GenerateActionToken(PurposeVerifyEmail, 1, "dave@example.com", "", -time.Minute)
+	if err != nil {
+		t.Fatalf("GenerateActionToken: %v", err)
+	}
+	if _, err := ValidateActionToken(token, PurposeVerifyEmail); err == nil {
+		t.Error("expired token accepted")
+	}
+}
+
+func TestActionTokenRejectsOtherKeys(t *testing.T) {
+	useTestKeyRing(t)
+	token, err := GenerateActionToken(PurposeVerifyEmail, 1, "dave@example.com", "", time.Hour)
+	if err != nil {
+		t.Fatalf("GenerateActionToken: %v", err)
+	}
+
+	other, err := LoadKeyRing(KeyRingConfig{Secret: "other-secret"})
+	if err != nil {
+		t.Fatalf("LoadKeyRing: %v", err)
+	}
+	SetKeyRing(other)
+	if _, err := ValidateActionToken(token, PurposeVerifyEmail); err == nil {
+		t.Error("token signed with another key accepted")
+	}
+}
@@ -0,0 +1,47 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+)
+
+const (
+	apiKeyPrefix     = "lla_"
+	apiKeyBytes      = 24
+	apiKeyShownChars = 8 // Characters of the random part kept as the display prefix
+)
+
+// GenerateAPIKey creates a new random API key. It returns the plaintext key,
+// a short display prefix, and the hash to store.
+func GenerateAPIKey() (key, prefix, hash string, err error) {
+	random, err := randomHex(apiKeyBytes)
+	if err != nil {
+		return "", "", "", err
+	}
+
+	key = apiKeyPrefix + random
+	prefix = key[:len(apiKeyPrefix)+apiKeyShownChars]
+	return key, prefix, HashAPIKey(key), nil
+}
+
+// HashAPIKey returns the hex-encoded SHA-256 hash of an API key. Keys are
+// long random strings, so a fast hash is sufficient and allows lookup by hash.
+func HashAPIKey(key string) string {
+	return sha256Hex(key)
+}
+
+// randomHex returns n cryptographically random bytes, hex-encoded
+func randomHex(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// sha256Hex returns the hex-encoded SHA-256 hash of s
+func sha256Hex(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,23 @@
+package auth
+
+import "time"
+
+const invitationTokenBytes = 32
+
+// InvitationTTL is how long an organization invitation can be accepted
+var InvitationTTL = getDuration("INVITATION_TTL", 7*24*time.Hour)
+
+// GenerateInvitationToken creates a new opaque invitation token. It returns
+// the plaintext token for the invitation email and the hash to store.
+func GenerateInvitationToken() (token, hash string, err error) {
+	token, err = randomHex(invitationTokenBytes)
+	if err != nil {
+		return "", "", err
+	}
+	return token, HashInvitationToken(token), nil
+}
+
+// HashInvitationToken returns the hex-encoded SHA-256 hash of an invitation token
+func HashInvitationToken(token string) string {
+	return sha256Hex(token)
+}
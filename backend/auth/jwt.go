@@ -10,41 +10,49 @@ import (
 
 var (
 	ErrInvalidToken = errors.New("invalid token")
-	jwtSecret       = []byte(getJWTSecret())
+
+	// AccessTokenTTL is how long access tokens are valid
+	AccessTokenTTL = getDuration("ACCESS_TOKEN_TTL", 15*time.Minute)
 )
 
-// getJWTSecret retrieves JWT secret from environment or uses default
-func getJWTSecret() string {
-	secret := os.Getenv("JWT_SECRET")
-	if secret == "" {
-		secret = "your-secret-key-change-in-production" // Default for development
+// getDuration reads a duration from environment or uses the default
+func getDuration(key string, def time.Duration) time.Duration {
+	if d, err := time.ParseDuration(os.Getenv(key)); err == nil && d > 0 {
+		return d
 	}
-	return secret
+	return def
 }
 
-// Claims represents JWT claims
+// Claims represents JWT claims. The token ID (jti) is in RegisteredClaims.ID.
 type Claims struct {
-	UserID int    `json:"user_id"`
-	Email  string `json:"email"`
+	UserID    int    `json:"user_id"`
+	Email     string `json:"email"`
+	SessionID string `json:"sid"` // Login session shared with the refresh token
 	jwt.RegisteredClaims
 }
 
-// GenerateToken generates a JWT token for a user
-func GenerateToken(userID int, email string) (string, error) {
-	expirationTime := time.Now().Add(24 * time.Hour) // Token expires in 24 hours
+// GenerateToken generates a short-lived JWT access token for a user's session
+func GenerateToken(userID int, email, sessionID string) (string, error) {
+	expirationTime := time.Now().Add(AccessTokenTTL)
+
+	tokenID, err := randomHex(16)
+	if err != nil {
+		return "", err
+	}
 
 	claims := &Claims{
-		UserID: userID,
-		Email:  email,
+		UserID:    userID,
+		Email:     email,
+		SessionID: sessionID,
 		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        tokenID,
 			ExpiresAt: jwt.NewNumericDate(expirationTime),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
 			NotBefore: jwt.NewNumericDate(time.Now()),
 		},
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	tokenString, err := token.SignedString(jwtSecret)
+	tokenString, err := keyRing.Sign(claims)
 	if err != nil {
 		return "", err
 	}
@@ -52,22 +60,24 @@ func GenerateToken(userID int, email string) (string, error) {
 	return tokenString, nil
 }
 
-// ValidateToken validates a JWT token and returns the claims
+// ValidateToken validates a JWT token against the key ring and returns the claims
 func ValidateToken(tokenString string) (*Claims, error) {
 	claims := &Claims{}
 
-	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, ErrInvalidToken
-		}
-		return jwtSecret, nil
-	})
+	if keyRing == nil {
+		return nil, ErrNoSigningKey
+	}
+
+	// Only accept algorithms of keys in the ring, so a token cannot pick a
+	// different algorithm than the one its key was issued for
+	token, err := jwt.ParseWithClaims(tokenString, claims, keyRing.Keyfunc, jwt.WithValidMethods(keyRing.Algorithms()))
 
 	if err != nil {
 		return nil, err
 	}
 
-	if !token.Valid {
+	// Access tokens have no audience; anything with one is an action token
+	if !token.Valid || len(claims.Audience) > 0 {
 		return nil, ErrInvalidToken
 	}
 
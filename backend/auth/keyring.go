@@ -0,0 +1,354 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"os"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	AlgHS256 = "HS256"
+	AlgRS256 = "RS256"
+	AlgEdDSA = "EdDSA"
+
+	// DefaultJWTSecret is the development fallback used when JWT_SECRET is
+	// unset. It is refused in production.
+	DefaultJWTSecret = "your-secret-key-change-in-production"
+
+	rsaKeyBits = 2048
+)
+
+var (
+	ErrUnknownAlgorithm = errors.New("unknown JWT algorithm")
+	ErrDefaultSecret    = errors.New("refusing to use the default JWT secret in production; set JWT_SECRET")
+	ErrNoPrivateKey     = errors.New("a private key file is required for asymmetric JWT algorithms in production; set JWT_PRIVATE_KEY_FILE")
+	ErrUnsupportedKey   = errors.New("unsupported JWT key type")
+	ErrNoSigningKey     = errors.New("no JWT signing key configured")
+)
+
+// KeyRingConfig holds the settings used to build the key ring at startup
+type KeyRingConfig struct {
+	Algorithm       string   // HS256 (default), RS256 or EdDSA
+	Secret          string   // HS256 signing secret
+	PrivateKeyFile  string   // PEM private key for RS256 or EdDSA signing
+	PreviousSecrets []string // Retired HS256 secrets still accepted for verification
+	VerifyKeyFiles  []string // PEM public (or private) keys still accepted for verification
+	Production      bool     // Refuse insecure development fallbacks
+}
+
+// Key is a single signing or verification key
+type Key struct {
+	ID     string // kid header value, derived from the key material
+	Method jwt.SigningMethod
+	sign   interface{} // nil for verification-only keys
+	verify interface{}
+}
+
+// KeyRing signs tokens with its current key and verifies tokens signed by
+// any of its keys, so retired keys keep working while their tokens expire
+type KeyRing struct {
+	signing *Key
+	keys    map[string]*Key
+	order   []string // kids in the order they were added, signing key first
+}
+
+// keyRing is the key ring used by GenerateToken and ValidateToken
+var keyRing *KeyRing
+
+// SetKeyRing installs the key ring used to sign and verify access tokens
+func SetKeyRing(r *KeyRing) {
+	keyRing = r
+}
+
+// LoadKeyRing builds a key ring from cfg
+func LoadKeyRing(cfg KeyRingConfig) (*KeyRing, error) {
+	r := &KeyRing{keys: make(map[string]*Key)}
+
+	var signing *Key
+	var err error
+	switch cfg.Algorithm {
+	case "", AlgHS256:
+		secret := cfg.Secret
+		if secret == "" {
+			secret = DefaultJWTSecret
+		}
+		if secret == DefaultJWTSecret {
+			if cfg.Production {
+				return nil, ErrDefaultSecret
+			}
+			log.Printf("Warning: using the default JWT secret; set JWT_SECRET outside development")
+		}
+		signing = newHMACKey([]byte(secret))
+
+	case AlgRS256, AlgEdDSA:
+		if cfg.PrivateKeyFile == "" {
+			if cfg.Production {
+				return nil, ErrNoPrivateKey
+			}
+			log.Printf("Warning: JWT_PRIVATE_KEY_FILE is not set; signing with a temporary %s key", cfg.Algorithm)
+			signing, err = generateKey(cfg.Algorithm)
+		} else {
+			signing, err = loadKeyFile(cfg.PrivateKeyFile)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if signing.sign == nil {
+			return nil, fmt.Errorf("%s does not contain a private key", cfg.PrivateKeyFile)
+		}
+		if signing.Method.Alg() != cfg.Algorithm {
+			return nil, fmt.Errorf("%s holds a %s key, but JWT_ALGORITHM is %s", cfg.PrivateKeyFile, signing.Method.Alg(), cfg.Algorithm)
+		}
+
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnknownAlgorithm, cfg.Algorithm)
+	}
+
+	r.add(signing)
+	r.signing = signing
+
+	for _, secret := range cfg.PreviousSecrets {
+		if secret != "" {
+			r.add(verifyOnly(newHMACKey([]byte(secret))))
+		}
+	}
+	for _, path := range cfg.VerifyKeyFiles {
+		if path == "" {
+			continue
+		}
+		key, err := loadKeyFile(path)
+		if err != nil {
+			return nil, err
+		}
+		r.add(verifyOnly(key))
+	}
+
+	return r, nil
+}
+
+// add registers key unless a key with the same kid is already present
+func (r *KeyRing) add(key *Key) {
+	if _, ok := r.keys[key.ID]; ok {
+		return
+	}
+	r.keys[key.ID] = key
+	r.order = append(r.order, key.ID)
+}
+
+// Sign signs claims with the current signing key and sets the kid header
+func (r *KeyRing) Sign(claims jwt.Claims) (string, error) {
+	if r == nil || r.signing == nil {
+		return "", ErrNoSigningKey
+	}
+	token := jwt.NewWithClaims(r.signing.Method, claims)
+	token.Header["kid"] = r.signing.ID
+	return token.SignedString(r.signing.sign)
+}
+
+// Keyfunc selects the verification key for a token by its kid header.
+// Tokens without a kid (issued before key rotation was introduced) are
+// checked against every key using the token's algorithm.
+func (r *KeyRing) Keyfunc(token *jwt.Token) (interface{}, error) {
+	if r == nil {
+		return nil, ErrNoSigningKey
+	}
+
+	kid, _ := token.Header["kid"].(string)
+	if kid != "" {
+		key, ok := r.keys[kid]
+		if !ok || key.Method.Alg() != token.Method.Alg() {
+			return nil, ErrInvalidToken
+		}
+		return key.verify, nil
+	}
+
+	var set jwt.VerificationKeySet
+	for _, id := range r.order {
+		if key := r.keys[id]; key.Method.Alg() == token.Method.Alg() {
+			set.Keys = append(set.Keys, key.verify)
+		}
+	}
+	if len(set.Keys) == 0 {
+		return nil, ErrInvalidToken
+	}
+	return set, nil
+}
+
+// Algorithms returns the algorithms of all keys in the ring
+func (r *KeyRing) Algorithms() []string {
+	var algs []string
+	seen := map[string]bool{}
+	for _, id := range r.order {
+		alg := r.keys[id].Method.Alg()
+		if !seen[alg] {
+			seen[alg] = true
+			algs = append(algs, alg)
+		}
+	}
+	return algs
+}
+
+// JWK is a public key in JSON Web Key format (RFC 7517)
+type JWK struct {
+	KeyType string `json:"kty"`
+	KeyID   string `json:"kid"`
+	Use     string `json:"use"`
+	Alg     string `json:"alg"`
+	N       string `json:"n,omitempty"`   // RSA modulus
+	E       string `json:"e,omitempty"`   // RSA public exponent
+	Curve   string `json:"crv,omitempty"` // OKP curve
+	X       string `json:"x,omitempty"`   // OKP public key
+}
+
+// JWKS is a JSON Web Key Set
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWKS returns the public keys of the ring. HMAC secrets are never published.
+func (r *KeyRing) JWKS() JWKS {
+	set := JWKS{Keys: []JWK{}}
+	for _, id := range r.order {
+		key := r.keys[id]
+		switch pub := key.verify.(type) {
+		case *rsa.PublicKey:
+			set.Keys = append(set.Keys, JWK{
+				KeyType: "RSA",
+				KeyID:   key.ID,
+				Use:     "sig",
+				Alg:     key.Method.Alg(),
+				N:       base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+				E:       base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+			})
+		case ed25519.PublicKey:
+			set.Keys = append(set.Keys, JWK{
+				KeyType: "OKP",
+				KeyID:   key.ID,
+				Use:     "sig",
+				Alg:     key.Method.Alg(),
+				Curve:   "Ed25519",
+				X:       base64.RawURLEncoding.EncodeToString(pub),
+			})
+		}
+	}
+	return set
+}
+
+// newHMACKey creates an HS256 key. The kid is derived from the secret so
+// that it is stable across restarts without revealing the secret.
+func newHMACKey(secret []byte) *Key {
+	sum := sha256.Sum256(append([]byte("latlongapi-jwt-kid:"), secret...))
+	return &Key{
+		ID:     "hs-" + hex.EncodeToString(sum[:8]),
+		Method: jwt.SigningMethodHS256,
+		sign:   secret,
+		verify: secret,
+	}
+}
+
+// newPublicKey creates an RS256 or EdDSA key from a public key and an
+// optional matching private key. The kid is derived from the public key.
+func newPublicKey(pub, priv interface{}) (*Key, error) {
+	der, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(der)
+
+	key := &Key{sign: priv, verify: pub}
+	switch pub.(type) {
+	case *rsa.PublicKey:
+		key.ID = "rs-" + hex.EncodeToString(sum[:8])
+		key.Method = jwt.SigningMethodRS256
+	case ed25519.PublicKey:
+		key.ID = "ed-" + hex.EncodeToString(sum[:8])
+		key.Method = jwt.SigningMethodEdDSA
+	default:
+		return nil, ErrUnsupportedKey
+	}
+	return key, nil
+}
+
+// verifyOnly returns a copy of key that cannot sign
+func verifyOnly(key *Key) *Key {
+	k := *key
+	k.sign = nil
+	return &k
+}
+
+// generateKey creates a temporary signing key for development
+func generateKey(alg string) (*Key, error) {
+	switch alg {
+	case AlgRS256:
+		priv, err := rsa.GenerateKey(rand.Reader, rsaKeyBits)
+		if err != nil {
+			return nil, err
+		}
+		return newPublicKey(&priv.PublicKey, priv)
+	default:
+		pub, priv, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return nil, err
+		}
+		return newPublicKey(pub, priv)
+	}
+}
+
+// loadKeyFile reads a PEM-encoded RSA or Ed25519 private or public key
+func loadKeyFile(path string) (*Key, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading JWT key: %w", err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("%s: no PEM data found", path)
+	}
+
+	var parsed interface{}
+	switch {
+	case strings.Contains(block.Type, "PRIVATE KEY"):
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+		}
+	case strings.Contains(block.Type, "PUBLIC KEY"):
+		parsed, err = x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			parsed, err = x509.ParsePKCS1PublicKey(block.Bytes)
+		}
+	default:
+		return nil, fmt.Errorf("%s: unexpected PEM block %q", path, block.Type)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	var key *Key
+	switch k := parsed.(type) {
+	case *rsa.PrivateKey:
+		key, err = newPublicKey(&k.PublicKey, k)
+	case ed25519.PrivateKey:
+		key, err = newPublicKey(k.Public(), k)
+	case crypto.PublicKey:
+		key, err = newPublicKey(k, nil)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return key, nil
+}
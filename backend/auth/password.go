@@ -1,19 +1,183 @@
 package auth
 
-import "golang.org/x/crypto/bcrypt"
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
 
-// HashPassword hashes a password using bcrypt
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Password hashing algorithms
+const (
+	HashBcrypt   = "bcrypt"
+	HashArgon2id = "argon2id"
+)
+
+const argon2SaltLength = 16
+
+var (
+	ErrUnknownHashAlgorithm = errors.New("unknown password hashing algorithm")
+	ErrInvalidHashParams    = errors.New("invalid password hashing parameters")
+)
+
+// PasswordHashConfig selects the algorithm and cost of new password hashes.
+// Existing hashes keep working whatever the configuration; logins upgrade
+// them (see PasswordNeedsRehash).
+type PasswordHashConfig struct {
+	Algorithm     string // bcrypt (default) or argon2id
+	BcryptCost    int
+	Argon2Time    uint32 // Passes over memory
+	Argon2Memory  uint32 // KiB
+	Argon2Threads uint8
+}
+
+// DefaultPasswordHashConfig returns bcrypt at its default cost, with the
+// argon2id parameters recommended by OWASP for when it is selected
+func DefaultPasswordHashConfig() PasswordHashConfig {
+	return PasswordHashConfig{
+		Algorithm:     HashBcrypt,
+		BcryptCost:    bcrypt.DefaultCost,
+		Argon2Time:    2,
+		Argon2Memory:  19 * 1024,
+		Argon2Threads: 1,
+	}
+}
+
+var (
+	passwordHashing = DefaultPasswordHashConfig()
+
+	dummyHash     string
+	dummyHashOnce sync.Once
+)
+
+// SetPasswordHashing configures how new passwords are hashed. Call it at
+// startup, before any password is hashed.
+func SetPasswordHashing(cfg PasswordHashConfig) error {
+	switch cfg.Algorithm {
+	case "", HashBcrypt:
+		cfg.Algorithm = HashBcrypt
+		if cfg.BcryptCost < bcrypt.MinCost || cfg.BcryptCost > bcrypt.MaxCost {
+			return fmt.Errorf("%w: bcrypt cost must be between %d and %d", ErrInvalidHashParams, bcrypt.MinCost, bcrypt.MaxCost)
+		}
+	case HashArgon2id:
+		if cfg.Argon2Time < 1 || cfg.Argon2Memory < 8*uint32(cfg.Argon2Threads) || cfg.Argon2Threads < 1 {
+			return fmt.Errorf("%w: argon2id needs time >= 1, threads >= 1 and memory >= 8 KiB per thread", ErrInvalidHashParams)
+		}
+	default:
+		return fmt.Errorf("%w: %s", ErrUnknownHashAlgorithm, cfg.Algorithm)
+	}
+
+	passwordHashing = cfg
+	return nil
+}
+
+// HashPassword hashes a password with the configured algorithm
 func HashPassword(password string) (string, error) {
-	bytes, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	cfg := passwordHashing
+	if cfg.Algorithm == HashArgon2id {
+		return hashArgon2id(password, cfg)
+	}
+
+	bytes, err := bcrypt.GenerateFromPassword([]byte(password), cfg.BcryptCost)
 	if err != nil {
 		return "", err
 	}
 	return string(bytes), nil
 }
 
-// CheckPasswordHash compares a password with a hash
+// CheckPasswordHash compares a password with a bcrypt or argon2id hash
 func CheckPasswordHash(password, hash string) bool {
+	if strings.HasPrefix(hash, "$"+HashArgon2id+"$") {
+		params, salt, key, err := parseArgon2id(hash)
+		if err != nil {
+			return false
+		}
+		other := argon2.IDKey([]byte(password), salt, params.Argon2Time, params.Argon2Memory, params.Argon2Threads, uint32(len(key)))
+		return subtle.ConstantTimeCompare(key, other) == 1
+	}
+
 	err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
 	return err == nil
 }
 
+// PasswordNeedsRehash reports whether hash was made with a different
+// algorithm or weaker parameters than are now configured
+func PasswordNeedsRehash(hash string) bool {
+	cfg := passwordHashing
+
+	if strings.HasPrefix(hash, "$"+HashArgon2id+"$") {
+		if cfg.Algorithm != HashArgon2id {
+			return true
+		}
+		params, _, _, err := parseArgon2id(hash)
+		return err != nil ||
+			params.Argon2Time != cfg.Argon2Time ||
+			params.Argon2Memory != cfg.Argon2Memory ||
+			params.Argon2Threads != cfg.Argon2Threads
+	}
+
+	if cfg.Algorithm != HashBcrypt {
+		return true
+	}
+	cost, err := bcrypt.Cost([]byte(hash))
+	return err != nil || cost != cfg.BcryptCost
+}
+
+// CheckDummyPassword takes as long as CheckPasswordHash does against a real
+// hash. Call it when there is no user to check, so that response timing does
+// not reveal whether an account exists.
+func CheckDummyPassword(password string) {
+	dummyHashOnce.Do(func() {
+		dummyHash, _ = HashPassword("dummy password")
+	})
+	CheckPasswordHash(password, dummyHash)
+}
+
+// hashArgon2id hashes a password into the PHC string format:
+// $argon2id$v=19$m=<memory>,t=<time>,p=<threads>$<salt>$<key>
+func hashArgon2id(password string, cfg PasswordHashConfig) (string, error) {
+	salt := make([]byte, argon2SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+
+	key := argon2.IDKey([]byte(password), salt, cfg.Argon2Time, cfg.Argon2Memory, cfg.Argon2Threads, 32)
+	return fmt.Sprintf("$%s$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		HashArgon2id, argon2.Version, cfg.Argon2Memory, cfg.Argon2Time, cfg.Argon2Threads,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+// parseArgon2id splits an argon2id PHC string into its parameters, salt and key
+func parseArgon2id(hash string) (PasswordHashConfig, []byte, []byte, error) {
+	var params PasswordHashConfig
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 || parts[1] != HashArgon2id {
+		return params, nil, nil, ErrInvalidHashParams
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return params, nil, nil, ErrInvalidHashParams
+	}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.Argon2Memory, &params.Argon2Time, &params.Argon2Threads); err != nil {
+		return params, nil, nil, ErrInvalidHashParams
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return params, nil, nil, ErrInvalidHashParams
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil || len(key) == 0 {
+		return params, nil, nil, ErrInvalidHashParams
+	}
+
+	params.Algorithm = HashArgon2id
+	return params, salt, key, nil
+}
@@ -0,0 +1,203 @@
+package auth
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Cheap settings, so the tests run quickly
+var (
+	testBcrypt   = PasswordHashConfig{Algorithm: HashBcrypt, BcryptCost: bcrypt.MinCost}
+	testArgon2id = PasswordHashConfig{Algorithm: HashArgon2id, Argon2Time: 1, Argon2Memory: 64, Argon2Threads: 1}
+)
+
+// useHashing configures password hashing for the duration of the test
+func useHashing(t *testing.T, cfg PasswordHashConfig) {
+	t.Helper()
+	previous := passwordHashing
+	if err := SetPasswordHashing(cfg); err != nil {
+		t.Fatalf("SetPasswordHashing: %v", err)
+	}
+	t.Cleanup(func() { passwordHashing = previous })
+}
+
+func TestHashPassword(t *testing.T) {
+	for _, cfg := range []PasswordHashConfig{testBcrypt, testArgon2id} {
+		useHashing(t, cfg)
+
+		hash, err := HashPassword("correct horse")
+		if err != nil {
+			t.Fatalf("%s: HashPassword: %v", cfg.Algorithm, err)
+		}
+		if cfg.Algorithm == HashArgon2id && !strings.HasPrefix(hash, "$argon2id$v=19$m=64,t=1,p=1$") {
+			t.Errorf("%s: got hash %q", cfg.Algorithm, hash)
+		}
+		if !CheckPasswordHash("correct horse", hash) {
+			t.Errorf("%s: password does not match its hash", cfg.Algorithm)
+		}
+		if CheckPasswordHash("wrong horse", hash) {
+			t.Errorf("%s: wrong password matches", cfg.Algorithm)
+		}
+
+		// Salted: the same password hashes differently each time
+		if other, _ := HashPassword("correct horse"); other == hash {
+			t.Errorf("%s: hash is not salted", cfg.Algorithm)
+		}
+	}
+}
+
+func TestCheckPasswordHashAcceptsEitherAlgorithm(t *testing.T) {
+	useHashing(t, testArgon2id)
+	argonHash, _ := HashPassword("correct horse")
+	useHashing(t, testBcrypt)
+	bcryptHash, _ := HashPassword("correct horse")
+
+	// Whatever is configured now, existing hashes keep working
+	for _, cfg := range []PasswordHashConfig{testBcrypt, testArgon2id} {
+		useHashing(t, cfg)
+		if !CheckPasswordHash("correct horse", argonHash) || !CheckPasswordHash("correct horse", bcryptHash) {
+			t.Errorf("%s configured: existing hash rejected", cfg.Algorithm)
+		}
+	}
+}
+
+func TestCheckPasswordHashRejectsMalformedHashes(t *testing.T) {
+	for _, hash := range []string{
+		"",
+		"plaintext",
+		"$argon2id$v=19$m=64,t=1,p=1$c2FsdA",
+		"$argon2id$v=18$m=64,t=1,p=1$c2FsdA$a2V5",
+		"$argon2id$v=19$m=64,t=1,p=1$c2FsdA$",
+	} {
+		if CheckPasswordHash("", hash) || CheckPasswordHash("plaintext", hash) {
+			t.Errorf("malformed hash %q matched", hash)
+		}
+	}
+}
+
+func TestPasswordNeedsRehash(t *testing.T) {
+	useHashing(t, testBcrypt)
+	bcryptHash, _ := HashPassword("correct horse")
+	useHashing(t, testArgon2id)
+	argonHash, _ := HashPassword("correct horse")
+
+	strongerBcrypt := testBcrypt
+	strongerBcrypt.BcryptCost++
+	strongerArgon2id := testArgon2id
+	strongerArgon2id.Argon2Memory *= 2
+
+	tests := []struct {
+		cfg  PasswordHashConfig
+		hash string
+		want bool
+	}{
+		{testBcrypt, bcryptHash, false},
+		{strongerBcrypt, bcryptHash, true},
+		{testArgon2id, bcryptHash, true},
+		{testArgon2id, argonHash, false},
+		{strongerArgon2id, argonHash, true},
+		{testBcrypt, argonHash, true},
+		{testArgon2id, "$argon2id$garbage", true},
+	}
+	for i, tt := range tests {
+		useHashing(t, tt.cfg)
+		if got := PasswordNeedsRehash(tt.hash); got != tt.want {
+			t.Errorf("%d: %s configured, hash %.20q: got %v, want %v", i, tt.cfg.Algorithm, tt.hash, got, tt.want)
+		}
+	}
+}
+
+func TestSetPasswordHashingRejectsInvalidSettings(t *testing.T) {
+	useHashing(t, testBcrypt)
+
+	for _, cfg := range []PasswordHashConfig{
+		{Algorithm: "md5"},
+		{Algorithm: HashBcrypt, BcryptCost: bcrypt.MaxCost + 1},
+		{Algorithm: HashArgon2id, Argon2Time: 0, Argon2Memory: 64, Argon2Threads: 1},
+		{Algorithm: HashArgon2id, Argon2Time: 1, Argon2Memory: 64, Argon2Threads: 0},
+		{Algorithm: HashArgon2id, Argon2Time: 1, Argon2Memory: 8, Argon2Threads: 2},
+	} {
+		if err := SetPasswordHashing(cfg); err == nil {
+			t.Errorf("%+v accepted", cfg)
+		}
+	}
+	if passwordHashing != testBcrypt {
+		t.Errorf("settings changed to %+v by rejected calls", passwordHashing)
+	}
+}
+
+func TestLoadPasswordPolicyMaxLength(t *testing.T) {
+	useHashing(t, testBcrypt)
+	if _, err := LoadPasswordPolicy(PasswordPolicyConfig{MaxLength: 100}); err == nil {
+		t.Error("maximum above 72 bytes accepted with bcrypt")
+	}
+
+	useHashing(t, testArgon2id)
+	p, err := LoadPasswordPolicy(PasswordPolicyConfig{MaxLength: 100})
+	if err != nil {
+		t.Fatalf("LoadPasswordPolicy with argon2id: %v", err)
+	}
+	if err := p.Validate(strings.Repeat("a", 100)); err != nil {
+		t.Errorf("100-byte password rejected: %v", err)
+	}
+	if err := p.Validate(strings.Repeat("a", 101)); err == nil {
+		t.Error("101-byte password accepted")
+	}
+}
+
+func TestPasswordPolicy(t *testing.T) {
+	list := filepath.Join(t.TempDir(), "breached.txt")
+	breached := "password123\n" +
+		"5BAA61E4C9B93F3F0682250B6CF8331B7EE68FD8:3861493\n" // "password"
+	if err := os.WriteFile(list, []byte(breached), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	p, err := LoadPasswordPolicy(PasswordPolicyConfig{MinLength: 8, MinClasses: 2, BreachedListFile: list})
+	if err != nil {
+		t.Fatalf("LoadPasswordPolicy: %v", err)
+	}
+	if p.BreachedCount() != 2 {
+		t.Errorf("got %d breached passwords, want 2", p.BreachedCount())
+	}
+
+	tests := []struct {
+		password string
+		ok       bool
+	}{
+		{"Horse1", false},                 // too short
+		{"ünïcödé1", true},                // length counts characters, not bytes
+		{"correcthorse", false},           // one class
+		{"correct horse", true},           // lowercase and a symbol
+		{"password123", false},            // breached, listed in plain text
+		{"password", false},               // breached, listed as a hash
+		{strings.Repeat("a1", 37), false}, // over 72 bytes
+	}
+	for _, tt := range tests {
+		if err := p.Validate(tt.password); (err == nil) != tt.ok {
+			t.Errorf("%q: got error %v, want ok %v", tt.password, err, tt.ok)
+		}
+	}
+}
+
+func TestLoadPasswordPolicyRejectsInconsistentSettings(t *testing.T) {
+	useHashing(t, testBcrypt)
+
+	for _, cfg := range []PasswordPolicyConfig{
+		{MinLength: 80},
+		{MinLength: 10, MaxLength: 8},
+		{MinClasses: 5},
+	} {
+		if _, err := LoadPasswordPolicy(cfg); err == nil {
+			t.Errorf("%+v accepted", cfg)
+		}
+	}
+	if _, err := LoadPasswordPolicy(PasswordPolicyConfig{BreachedListFile: "/nonexistent"}); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("missing breached list: got error %v, want %v", err, os.ErrNotExist)
+	}
+}
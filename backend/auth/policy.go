@@ -0,0 +1,145 @@
+package auth
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"unicode"
+)
+
+// bcryptMaxLength is the longest password bcrypt accepts, in bytes
+const bcryptMaxLength = 72
+
+// PasswordPolicyConfig holds the rules new passwords must follow
+type PasswordPolicyConfig struct {
+	MinLength        int
+	MaxLength        int    // In bytes; bcrypt cannot hash more than 72
+	MinClasses       int    // Character classes required, of lowercase, uppercase, digits and symbols
+	BreachedListFile string // Passwords known from data breaches, one per line
+}
+
+// PasswordPolicy checks new passwords against a PasswordPolicyConfig
+type PasswordPolicy struct {
+	cfg      PasswordPolicyConfig
+	breached map[string]struct{} // Upper-case hex SHA-1 of breached passwords
+}
+
+// DefaultPasswordPolicy requires six characters and nothing else
+func DefaultPasswordPolicy() *PasswordPolicy {
+	return &PasswordPolicy{cfg: PasswordPolicyConfig{MinLength: 6, MaxLength: bcryptMaxLength}}
+}
+
+// LoadPasswordPolicy builds a policy from cfg, reading the breached password
+// list if one is configured. Each line of the list is either a password or
+// the SHA-1 hash of one in hex, optionally followed by ":count" as in the
+// Have I Been Pwned downloads. Call it after SetPasswordHashing: a maximum
+// above 72 bytes is refused while new passwords are hashed with bcrypt.
+func LoadPasswordPolicy(cfg PasswordPolicyConfig) (*PasswordPolicy, error) {
+	if cfg.MaxLength <= 0 {
+		cfg.MaxLength = bcryptMaxLength
+	}
+	if passwordHashing.Algorithm == HashBcrypt && cfg.MaxLength > bcryptMaxLength {
+		return nil, fmt.Errorf("maximum password length %d exceeds the %d bytes bcrypt can hash; lower it or use argon2id", cfg.MaxLength, bcryptMaxLength)
+	}
+	if cfg.MinLength > cfg.MaxLength {
+		return nil, fmt.Errorf("minimum password length %d exceeds the maximum of %d", cfg.MinLength, cfg.MaxLength)
+	}
+	if cfg.MinClasses > 4 {
+		return nil, fmt.Errorf("at most 4 character classes can be required, not %d", cfg.MinClasses)
+	}
+
+	p := &PasswordPolicy{cfg: cfg}
+	if cfg.BreachedListFile == "" {
+		return p, nil
+	}
+
+	f, err := os.Open(cfg.BreachedListFile)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	p.breached = make(map[string]struct{})
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if line == "" {
+			continue
+		}
+		if hash, _, _ := strings.Cut(line, ":"); isSHA1Hex(hash) {
+			p.breached[strings.ToUpper(hash)] = struct{}{}
+		} else {
+			p.breached[sha1Hex(line)] = struct{}{}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("reading %s: %w", cfg.BreachedListFile, err)
+	}
+
+	return p, nil
+}
+
+// BreachedCount returns the number of entries in the breached password list
+func (p *PasswordPolicy) BreachedCount() int {
+	return len(p.breached)
+}
+
+// Validate returns an error, worded for the user, if password breaks the policy
+func (p *PasswordPolicy) Validate(password string) error {
+	if len([]rune(password)) < p.cfg.MinLength {
+		return fmt.Errorf("Password must be at least %d characters", p.cfg.MinLength)
+	}
+	if len(password) > p.cfg.MaxLength {
+		return fmt.Errorf("Password must be at most %d bytes", p.cfg.MaxLength)
+	}
+
+	if p.cfg.MinClasses > 0 {
+		var lower, upper, digit, symbol bool
+		for _, r := range password {
+			switch {
+			case unicode.IsLower(r):
+				lower = true
+			case unicode.IsUpper(r):
+				upper = true
+			case unicode.IsDigit(r):
+				digit = true
+			default:
+				symbol = true
+			}
+		}
+		classes := 0
+		for _, has := range []bool{lower, upper, digit, symbol} {
+			if has {
+				classes++
+			}
+		}
+		if classes < p.cfg.MinClasses {
+			return fmt.Errorf("Password must contain at least %d of: lowercase letters, uppercase letters, digits and symbols", p.cfg.MinClasses)
+		}
+	}
+
+	if _, found := p.breached[sha1Hex(password)]; found {
+		return errors.New("This password has appeared in a data breach; choose a different one")
+	}
+
+	return nil
+}
+
+// sha1Hex returns the upper-case hex SHA-1 of s
+func sha1Hex(s string) string {
+	sum := sha1.Sum([]byte(s))
+	return strings.ToUpper(hex.EncodeToString(sum[:]))
+}
+
+// isSHA1Hex reports whether s looks like a hex SHA-1 hash
+func isSHA1Hex(s string) bool {
+	if len(s) != 2*sha1.Size {
+		return false
+	}
+	_, err := hex.DecodeString(s)
+	return err == nil
+}
@@ -0,0 +1,28 @@
+package auth
+
+import "time"
+
+const refreshTokenBytes = 32
+
+// RefreshTokenTTL is how long a refresh token can be used to obtain new access tokens
+var RefreshTokenTTL = getDuration("REFRESH_TOKEN_TTL", 30*24*time.Hour)
+
+// GenerateRefreshToken creates a new opaque refresh token. It returns the
+// plaintext token for the client and the hash to store.
+func GenerateRefreshToken() (token, hash string, err error) {
+	token, err = randomHex(refreshTokenBytes)
+	if err != nil {
+		return "", "", err
+	}
+	return token, HashRefreshToken(token), nil
+}
+
+// HashRefreshToken returns the hex-encoded SHA-256 hash of a refresh token
+func HashRefreshToken(token string) string {
+	return sha256Hex(token)
+}
+
+// NewSessionID creates a random identifier for a login session
+func NewSessionID() (string, error) {
+	return randomHex(16)
+}
@@ -0,0 +1,114 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// TOTP parameters (RFC 6238 defaults, supported by all authenticator apps)
+const (
+	totpSecretBytes = 20
+	totpDigits      = 6
+	totpModulo      = 1000000 // 10^totpDigits
+	totpPeriod      = 30 * time.Second
+	totpSkew        = 1 // Steps accepted on either side of the current one, for clock drift
+
+	recoveryCodeCount = 10
+	recoveryCodeBytes = 5 // Each code is 10 hex characters, shown as xxxxx-xxxxx
+
+	// TOTPIssuer names the account in authenticator apps
+	TOTPIssuer = "LatLongAPI"
+)
+
+var (
+	// MFATokenTTL is how long a user has to enter their code after a password login
+	MFATokenTTL = getDuration("MFA_TOKEN_TTL", 5*time.Minute)
+
+	base32NoPadding = base32.StdEncoding.WithPadding(base32.NoPadding)
+)
+
+// PurposeMFA is the purpose of the token issued by a password login that
+// still needs a second factor
+const PurposeMFA = "mfa"
+
+// GenerateTOTPSecret creates a new random base32-encoded TOTP secret
+func GenerateTOTPSecret() (string, error) {
+	b := make([]byte, totpSecretBytes)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base32NoPadding.EncodeToString(b), nil
+}
+
+// TOTPURI returns the otpauth:// URI used to add secret to an authenticator
+// app, usually shown as a QR code
+func TOTPURI(secret, email string) string {
+	v := url.Values{}
+	v.Set("secret", secret)
+	v.Set("issuer", TOTPIssuer)
+	v.Set("algorithm", "SHA1")
+	v.Set("digits", fmt.Sprint(totpDigits))
+	v.Set("period", fmt.Sprint(int(totpPeriod.Seconds())))
+	return "otpauth://totp/" + url.PathEscape(TOTPIssuer+":"+email) + "?" + v.Encode()
+}
+
+// ValidateTOTP checks code against secret at time now. It returns the time
+// step the code belongs to, which callers record to reject replays.
+func ValidateTOTP(secret, code string, now time.Time) (int64, bool) {
+	key, err := base32NoPadding.DecodeString(strings.ToUpper(secret))
+	if err != nil || len(code) != totpDigits {
+		return 0, false
+	}
+
+	current := now.Unix() / int64(totpPeriod.Seconds())
+	for step := current - totpSkew; step <= current+totpSkew; step++ {
+		if subtle.ConstantTimeCompare([]byte(totpCode(key, step)), []byte(code)) == 1 {
+			return step, true
+		}
+	}
+	return 0, false
+}
+
+// totpCode computes the code for one time step (RFC 4226 HOTP)
+func totpCode(key []byte, step int64) string {
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], uint64(step))
+
+	mac := hmac.New(sha1.New, key)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	return fmt.Sprintf("%0*d", totpDigits, value%totpModulo)
+}
+
+// GenerateRecoveryCodes creates single-use codes that can stand in for a
+// TOTP code. It returns the plaintext codes for the user and the hashes to store.
+func GenerateRecoveryCodes() (codes, hashes []string, err error) {
+	for i := 0; i < recoveryCodeCount; i++ {
+		random, err := randomHex(recoveryCodeBytes)
+		if err != nil {
+			return nil, nil, err
+		}
+		code := random[:recoveryCodeBytes] + "-" + random[recoveryCodeBytes:]
+		codes = append(codes, code)
+		hashes = append(hashes, HashRecoveryCode(code))
+	}
+	return codes, hashes, nil
+}
+
+// HashRecoveryCode returns the hash of a recovery code, ignoring case,
+// spaces and dashes
+func HashRecoveryCode(code string) string {
+	code = strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(code))
+	return sha256Hex(code)
+}
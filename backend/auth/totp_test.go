@@ -0,0 +1,122 @@
+package auth
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// rfc6238Secret is the SHA-1 key of the RFC 6238 test vectors, in base32
+const rfc6238Secret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ" // "12345678901234567890"
+
+func TestValidateTOTPTestVectors(t *testing.T) {
+	// The last six digits of the RFC 6238 appendix B SHA-1 codes
+	tests := []struct {
+		unix int64
+		code string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+	}
+
+	for _, tt := range tests {
+		now := time.Unix(tt.unix, 0)
+		step, ok := ValidateTOTP(rfc6238Secret, tt.code, now)
+		if !ok {
+			t.Errorf("%d: code %s rejected", tt.unix, tt.code)
+			continue
+		}
+		if want := tt.unix / 30; step != want {
+			t.Errorf("%d: got step %d, want %d", tt.unix, step, want)
+		}
+	}
+}
+
+func TestValidateTOTPAcceptsOneStepOfDrift(t *testing.T) {
+	now := time.Unix(1111111111, 0) // code 050471, step 37037037
+
+	for _, tt := range []struct {
+		offset time.Duration
+		ok     bool
+	}{
+		{-90 * time.Second, false},
+		{-30 * time.Second, true},
+		{30 * time.Second, true},
+		{90 * time.Second, false},
+	} {
+		if _, ok := ValidateTOTP(rfc6238Secret, "050471", now.Add(tt.offset)); ok != tt.ok {
+			t.Errorf("offset %s: got %v, want %v", tt.offset, ok, tt.ok)
+		}
+	}
+}
+
+func TestValidateTOTPRejectsMalformedInput(t *testing.T) {
+	now := time.Unix(59, 0)
+
+	for _, tt := range []struct{ secret, code string }{
+		{rfc6238Secret, "28708"},
+		{rfc6238Secret, "2870820"},
+		{rfc6238Secret, ""},
+		{"not base32!", "287082"},
+	} {
+		if _, ok := ValidateTOTP(tt.secret, tt.code, now); ok {
+			t.Errorf("secret %q, code %q accepted", tt.secret, tt.code)
+		}
+	}
+
+	// Secrets are accepted in lower case, as some apps display them
+	if _, ok := ValidateTOTP(strings.ToLower(rfc6238Secret), "287082", now); !ok {
+		t.Error("lower-case secret rejected")
+	}
+}
+
+func TestGenerateTOTPSecret(t *testing.T) {
+	secret, err := GenerateTOTPSecret()
+	if err != nil {
+		t.Fatalf("GenerateTOTPSecret: %v", err)
+	}
+	if len(secret) != 32 || strings.ContainsRune(secret, '=') {
+		t.Errorf("got secret %q, want 32 base32 characters without padding", secret)
+	}
+
+	uri := TOTPURI(secret, "frank@example.com")
+	if !strings.HasPrefix(uri, "otpauth://totp/LatLongAPI:frank@example.com?") || !strings.Contains(uri, "secret="+secret) {
+		t.Errorf("got URI %q", uri)
+	}
+}
+
+func TestRecoveryCodes(t *testing.T) {
+	codes, hashes, err := GenerateRecoveryCodes()
+	if err != nil {
+		t.Fatalf("GenerateRecoveryCodes: %v", err)
+	}
+	if len(codes) != recoveryCodeCount || len(hashes) != recoveryCodeCount {
+		t.Fatalf("got %d codes and %d hashes, want %d", len(codes), len(hashes), recoveryCodeCount)
+	}
+
+	seen := make(map[string]bool)
+	for i, code := range codes {
+		if len(code) != 11 || code[5] != '-' {
+			t.Errorf("code %q is not formatted xxxxx-xxxxx", code)
+		}
+		if seen[code] {
+			t.Errorf("code %q generated twice", code)
+		}
+		seen[code] = true
+
+		if hashes[i] != HashRecoveryCode(code) {
+			t.Errorf("hash %d does not match code %q", i, code)
+		}
+	}
+
+	// Codes are typed by hand: case, spaces and dashes do not matter
+	code := codes[0]
+	for _, typed := range []string{strings.ToUpper(code), strings.ReplaceAll(code, "-", ""), code[:5] + " " + code[6:]} {
+		if HashRecoveryCode(typed) != hashes[0] {
+			t.Errorf("%q does not match %q", typed, code)
+		}
+	}
+}
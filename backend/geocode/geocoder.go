@@ -0,0 +1,44 @@
+package geocode
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"latlongapi/backend/models"
+)
+
+var (
+	ErrUnknownProvider = errors.New("unknown geocoder provider")
+	ErrNotFound        = errors.New("no place found")
+)
+
+// Geocoder defines the interface for geocoding providers
+type Geocoder interface {
+	Reverse(ctx context.Context, lat, lng float64) (*models.Place, error)
+	Search(ctx context.Context, query string, limit int) ([]models.Place, error)
+}
+
+// Pinger is implemented by geocoders that can check the provider is
+// reachable without geocoding anything
+type Pinger interface {
+	Ping(ctx context.Context) error
+}
+
+// Config holds the settings used to build a geocoder at startup
+type Config struct {
+	Provider  string // "nominatim" (default) or "stub"
+	BaseURL   string // Override the provider's base URL (e.g. a self-hosted Nominatim)
+	UserAgent string
+}
+
+// New creates the geocoder selected by cfg.Provider
+func New(cfg Config) (Geocoder, error) {
+	switch cfg.Provider {
+	case "", "nominatim":
+		return NewNominatim(cfg.BaseURL, cfg.UserAgent), nil
+	case "stub":
+		return NewStub(), nil
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnknownProvider, cfg.Provider)
+	}
+}
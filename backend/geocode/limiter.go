@@ -0,0 +1,238 @@
+package geocode
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"latlongapi/backend/models"
+	"math"
+	"strconv"
+	"sync"
+	"time"
+)
+
+var (
+	ErrQueueFull = errors.New("upstream queue is full")
+)
+
+// QueueFullError is returned when too many callers are already waiting for
+// upstream capacity. RetryAfter estimates when a new request would be admitted.
+type QueueFullError struct {
+	RetryAfter time.Duration
+}
+
+func (e *QueueFullError) Error() string {
+	return fmt.Sprintf("%v, retry after %s", ErrQueueFull, e.RetryAfter)
+}
+
+// Is lets errors.Is match QueueFullError against ErrQueueFull
+func (e *QueueFullError) Is(target error) bool {
+	return target == ErrQueueFull
+}
+
+// TokenBucket is a token-bucket rate limiter with a bounded wait queue.
+// Callers reserve a token up front and sleep until it becomes available,
+// so waiting callers are admitted in arrival order.
+type TokenBucket struct {
+	rate     float64 // tokens per second
+	burst    float64
+	maxQueue int
+
+	mu       sync.Mutex
+	tokens   float64 // negative when callers are queued
+	last     time.Time
+	waiting  int
+	reserved uint64 // Counts reservations, identifying the latest one
+}
+
+// NewTokenBucket creates a limiter allowing rps requests per second with the
+// given burst, and at most maxQueue callers waiting at once
+func NewTokenBucket(rps float64, burst, maxQueue int) *TokenBucket {
+	return &TokenBucket{
+		rate:     rps,
+		burst:    float64(burst),
+		maxQueue: maxQueue,
+		tokens:   float64(burst),
+		last:     time.Now(),
+	}
+}
+
+// Wait blocks until a token is available or ctx is done. It returns a
+// *QueueFullError without waiting if the queue is already full.
+func (b *TokenBucket) Wait(ctx context.Context) error {
+	b.mu.Lock()
+	now := time.Now()
+	b.tokens = math.Min(b.burst, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+	b.last = now
+
+	if b.tokens >= 1 {
+		b.tokens--
+		b.mu.Unlock()
+		return nil
+	}
+
+	if b.waiting >= b.maxQueue {
+		retryAfter := b.delay(1 - b.tokens)
+		b.mu.Unlock()
+		return &QueueFullError{RetryAfter: retryAfter}
+	}
+
+	// Reserve the next token and wait for it to be refilled
+	b.tokens--
+	delay := b.delay(-b.tokens)
+	b.waiting++
+	b.reserved++
+	ticket := b.reserved
+	b.mu.Unlock()
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		b.mu.Lock()
+		b.waiting--
+		b.mu.Unlock()
+		return nil
+	case <-ctx.Done():
+		// Callers queued behind this one were given delays that count on
+		// its slot, so the reservation is handed back only if it is the
+		// last one. Otherwise the slot goes unused.
+		b.mu.Lock()
+		b.waiting--
+		if b.reserved == ticket {
+			b.tokens++
+		}
+		b.mu.Unlock()
+		return ctx.Err()
+	}
+}
+
+// delay returns how long it takes to refill n tokens
+func (b *TokenBucket) delay(n float64) time.Duration {
+	return time.Duration(n / b.rate * float64(time.Second))
+}
+
+// flightCall is an in-progress or completed upstream call shared by callers
+type flightCall struct {
+	done     chan struct{}
+	val      interface{}
+	err      error
+	waiters  int                // Callers still waiting for the result
+	admitted bool               // Set once the call has been given a token
+	cancel   context.CancelFunc // Ends the wait for a token once no caller is waiting
+}
+
+// flightGroup coalesces concurrent calls with the same key into one
+type flightGroup struct {
+	mu    sync.Mutex
+	calls map[string]*flightCall
+}
+
+// do runs fn once for all concurrent callers with the same key, after wait
+// admits it. Each caller stops waiting when its own ctx is done. The ctx
+// passed to wait and fn carries the first caller's values. If every caller
+// stops waiting before wait returns, the wait is cancelled and later callers
+// start a fresh call. Once admitted, fn runs to completion and later callers
+// share its result, so a token is never spent twice on the same request.
+func (g *flightGroup) do(ctx context.Context, key string, wait func(context.Context) error, fn func(context.Context) (interface{}, error)) (interface{}, error) {
+	g.mu.Lock()
+	if g.calls == nil {
+		g.calls = make(map[string]*flightCall)
+	}
+	c, ok := g.calls[key]
+	if !ok {
+		callCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+		c = &flightCall{done: make(chan struct{}), cancel: cancel}
+		g.calls[key] = c
+		go func() {
+			c.val, c.err = g.run(callCtx, c, wait, fn)
+			cancel()
+			g.mu.Lock()
+			if g.calls[key] == c {
+				delete(g.calls, key)
+			}
+			g.mu.Unlock()
+			close(c.done)
+		}()
+	}
+	c.waiters++
+	g.mu.Unlock()
+
+	select {
+	case <-c.done:
+		return c.val, c.err
+	case <-ctx.Done():
+		g.mu.Lock()
+		c.waiters--
+		if c.waiters == 0 && !c.admitted {
+			// Nobody wants the result and no token has been spent on it
+			c.cancel()
+			if g.calls[key] == c {
+				delete(g.calls, key)
+			}
+		}
+		g.mu.Unlock()
+		return nil, ctx.Err()
+	}
+}
+
+// run waits for admission and then calls fn, unless the call was abandoned
+// while it waited
+func (g *flightGroup) run(ctx context.Context, c *flightCall, wait func(context.Context) error, fn func(context.Context) (interface{}, error)) (interface{}, error) {
+	if err := wait(ctx); err != nil {
+		return nil, err
+	}
+
+	g.mu.Lock()
+	if c.waiters == 0 && !c.admitted {
+		// Abandoned as the token arrived. The call is no longer in g.calls,
+		// so running fn could duplicate a newer call for the same key.
+		g.mu.Unlock()
+		return nil, context.Canceled
+	}
+	c.admitted = true
+	g.mu.Unlock()
+
+	return fn(ctx)
+}
+
+// Limited wraps a Geocoder with a shared upstream rate limit and coalesces
+// concurrent identical requests into a single upstream call
+type Limited struct {
+	next    Geocoder
+	limiter *TokenBucket
+	group   flightGroup
+}
+
+// NewLimited wraps next so that upstream calls are admitted by limiter
+func NewLimited(next Geocoder, limiter *TokenBucket) *Limited {
+	return &Limited{
+		next:    next,
+		limiter: limiter,
+	}
+}
+
+// Reverse rate limits and coalesces reverse geocoding calls
+func (l *Limited) Reverse(ctx context.Context, lat, lng float64) (*models.Place, error) {
+	key := "reverse:" + strconv.FormatFloat(lat, 'f', 6, 64) + "," + strconv.FormatFloat(lng, 'f', 6, 64)
+	v, err := l.group.do(ctx, key, l.limiter.Wait, func(ctx context.Context) (interface{}, error) {
+		return l.next.Reverse(ctx, lat, lng)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return v.(*models.Place), nil
+}
+
+// Search rate limits and coalesces forward geocoding calls
+func (l *Limited) Search(ctx context.Context, query string, limit int) ([]models.Place, error) {
+	key := "search:" + strconv.Itoa(limit) + ":" + query
+	v, err := l.group.do(ctx, key, l.limiter.Wait, func(ctx context.Context) (interface{}, error) {
+		return l.next.Search(ctx, query, limit)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return v.([]models.Place), nil
+}
@@ -0,0 +1,269 @@
+package geocode
+
+import (
+	"context"
+	"errors"
+	"latlongapi/backend/models"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// waitQueued waits until n callers are queued in b
+func waitQueued(t *testing.T, b *TokenBucket, n int) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for {
+		b.mu.Lock()
+		waiting := b.waiting
+		b.mu.Unlock()
+		if waiting == n {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("got %d queued callers, want %d", waiting, n)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// queue starts a caller waiting on b and returns a function that cancels it
+func queue(t *testing.T, b *TokenBucket) context.CancelFunc {
+	t.Helper()
+	b.mu.Lock()
+	n := b.waiting
+	b.mu.Unlock()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- b.Wait(ctx) }()
+	waitQueued(t, b, n+1)
+
+	return func() {
+		cancel()
+		if err := <-done; err != context.Canceled {
+			t.Errorf("cancelled caller: got error %v, want %v", err, context.Canceled)
+		}
+	}
+}
+
+func TestTokenBucketSpacesAdmissions(t *testing.T) {
+	b := NewTokenBucket(20, 2, 10)
+	start := time.Now()
+
+	// The burst is admitted at once, then one caller every 50ms
+	for i := 0; i < 5; i++ {
+		if err := b.Wait(context.Background()); err != nil {
+			t.Fatalf("Wait %d: %v", i, err)
+		}
+		elapsed := time.Since(start)
+		want := time.Duration(max(i-1, 0)) * 50 * time.Millisecond
+		if elapsed < want-5*time.Millisecond || elapsed > want+500*time.Millisecond {
+			t.Errorf("Wait %d: admitted after %s, want %s", i, elapsed, want)
+		}
+	}
+}
+
+func TestTokenBucketQueueFull(t *testing.T) {
+	b := NewTokenBucket(10, 1, 1)
+	if err := b.Wait(context.Background()); err != nil {
+		t.Fatalf("Wait: %v", err)
+	}
+	cancel := queue(t, b)
+	defer cancel()
+
+	err := b.Wait(context.Background())
+	var queueFull *QueueFullError
+	if !errors.As(err, &queueFull) || !errors.Is(err, ErrQueueFull) {
+		t.Fatalf("got error %v, want a QueueFullError", err)
+	}
+	// The queued caller takes the next token, so a new caller could be
+	// admitted with the one after it
+	if queueFull.RetryAfter <= 100*time.Millisecond || queueFull.RetryAfter > 200*time.Millisecond {
+		t.Errorf("got Retry-After %s, want just under 200ms", queueFull.RetryAfter)
+	}
+}
+
+func TestTokenBucketCancelledSlotIsNotReused(t *testing.T) {
+	b := NewTokenBucket(10, 1, 10)
+	start := time.Now()
+	if err := b.Wait(context.Background()); err != nil {
+		t.Fatalf("Wait: %v", err)
+	}
+
+	// The first caller takes the slot at 100ms, the second the one at 200ms
+	cancelFirst := queue(t, b)
+	second := make(chan time.Duration, 1)
+	go func() {
+		b.Wait(context.Background())
+		second <- time.Since(start)
+	}()
+	waitQueued(t, b, 2)
+	cancelFirst()
+
+	// With the second caller still queued, a new caller must not be given
+	// its slot
+	if err := b.Wait(context.Background()); err != nil {
+		t.Fatalf("Wait: %v", err)
+	}
+	third := time.Since(start)
+	if third < 290*time.Millisecond {
+		t.Errorf("new caller admitted after %s, want 300ms", third)
+	}
+	if d := <-second; d < 190*time.Millisecond || third-d < 90*time.Millisecond {
+		t.Errorf("second caller admitted after %s, new caller after %s: want them 100ms apart", d, third)
+	}
+}
+
+func TestTokenBucketCancelledLastSlotIsReused(t *testing.T) {
+	b := NewTokenBucket(10, 1, 10)
+	start := time.Now()
+	if err := b.Wait(context.Background()); err != nil {
+		t.Fatalf("Wait: %v", err)
+	}
+
+	// Nobody is queued behind the cancelled caller, so its slot is handed on
+	queue(t, b)()
+	if err := b.Wait(context.Background()); err != nil {
+		t.Fatalf("Wait: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 190*time.Millisecond {
+		t.Errorf("new caller admitted after %s, want 100ms", elapsed)
+	}
+}
+
+// blockingGeocoder counts upstream calls and holds them until release is closed
+type blockingGeocoder struct {
+	calls   atomic.Int32
+	release chan struct{}
+}
+
+func (g *blockingGeocoder) Reverse(ctx context.Context, lat, lng float64) (*models.Place, error) {
+	g.calls.Add(1)
+	<-g.release
+	return &models.Place{Latitude: lat, Longitude: lng}, nil
+}
+
+func (g *blockingGeocoder) Search(ctx context.Context, query string, limit int) ([]models.Place, error) {
+	g.calls.Add(1)
+	<-g.release
+	return []models.Place{{FormattedAddress: query}}, nil
+}
+
+// waiters returns how many callers wait on the call for key
+func waiters(l *Limited, key string) int {
+	l.group.mu.Lock()
+	defer l.group.mu.Unlock()
+	if c, ok := l.group.calls[key]; ok {
+		return c.waiters
+	}
+	return 0
+}
+
+// waitFor polls cond for up to a second
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestLimitedCoalescesCalls(t *testing.T) {
+	upstream := &blockingGeocoder{release: make(chan struct{})}
+	l := NewLimited(upstream, NewTokenBucket(100, 10, 10))
+	const key = "search:5:london"
+
+	results := make(chan error, 3)
+	for i := 0; i < 3; i++ {
+		go func() {
+			places, err := l.Search(context.Background(), "london", 5)
+			if err == nil && (len(places) != 1 || places[0].FormattedAddress != "london") {
+				t.Errorf("got %+v", places)
+			}
+			results <- err
+		}()
+	}
+	waitFor(t, "3 callers", func() bool { return waiters(l, key) == 3 })
+	close(upstream.release)
+
+	for i := 0; i < 3; i++ {
+		if err := <-results; err != nil {
+			t.Errorf("Search: %v", err)
+		}
+	}
+	if n := upstream.calls.Load(); n != 1 {
+		t.Errorf("got %d upstream calls, want 1", n)
+	}
+}
+
+func TestLimitedJoinsAbandonedCallInFlight(t *testing.T) {
+	upstream := &blockingGeocoder{release: make(chan struct{})}
+	l := NewLimited(upstream, NewTokenBucket(100, 10, 10))
+	const key = "reverse:51.507400,-0.127800"
+
+	ctx, cancel := context.WithCancel(context.Background())
+	first := make(chan error, 1)
+	go func() {
+		_, err := l.Reverse(ctx, 51.5074, -0.1278)
+		first <- err
+	}()
+	waitFor(t, "the upstream call", func() bool { return upstream.calls.Load() == 1 })
+	cancel()
+	if err := <-first; err != context.Canceled {
+		t.Fatalf("cancelled caller: got error %v, want %v", err, context.Canceled)
+	}
+
+	// The upstream call has spent its token and is still running, so a new
+	// caller waits for it instead of starting another
+	second := make(chan error, 1)
+	go func() {
+		place, err := l.Reverse(context.Background(), 51.5074, -0.1278)
+		if err == nil && place.Latitude != 51.5074 {
+			t.Errorf("got %+v", place)
+		}
+		second <- err
+	}()
+	waitFor(t, "the new caller", func() bool { return waiters(l, key) == 1 })
+	close(upstream.release)
+
+	if err := <-second; err != nil {
+		t.Errorf("Reverse: %v", err)
+	}
+	if n := upstream.calls.Load(); n != 1 {
+		t.Errorf("got %d upstream calls, want 1", n)
+	}
+}
+
+func TestLimitedDropsCallAbandonedInQueue(t *testing.T) {
+	upstream := &blockingGeocoder{release: make(chan struct{})}
+	close(upstream.release)
+	limiter := NewTokenBucket(1, 1, 10)
+	limiter.Wait(context.Background())
+	l := NewLimited(upstream, limiter)
+
+	// Still queued for a token when its only caller gives up, so the call is
+	// dropped and its queue slot freed
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		_, err := l.Reverse(ctx, 1, 2)
+		done <- err
+	}()
+	waitQueued(t, limiter, 1)
+	cancel()
+	if err := <-done; err != context.Canceled {
+		t.Fatalf("got error %v, want %v", err, context.Canceled)
+	}
+	waitQueued(t, limiter, 0)
+
+	l.group.mu.Lock()
+	pending := len(l.group.calls)
+	l.group.mu.Unlock()
+	if pending != 0 || upstream.calls.Load() != 0 {
+		t.Errorf("got %d pending and %d upstream calls, want none", pending, upstream.calls.Load())
+	}
+}
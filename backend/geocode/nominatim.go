@@ -0,0 +1,194 @@
+package geocode
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"latlongapi/backend/logging"
+	"latlongapi/backend/models"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+)
+
+const (
+	DefaultNominatimURL = "https://nominatim.openstreetmap.org"
+	DefaultUserAgent    = "LatLongAPI-Go/1.0"
+)
+
+// Nominatim is a Geocoder backed by an OpenStreetMap Nominatim server
+type Nominatim struct {
+	baseURL   string
+	userAgent string
+	client    *http.Client
+}
+
+// NewNominatim creates a Nominatim geocoder. Empty arguments fall back to the
+// public OpenStreetMap instance and the default User-Agent.
+func NewNominatim(baseURL, userAgent string) *Nominatim {
+	if baseURL == "" {
+		baseURL = DefaultNominatimURL
+	}
+	if userAgent == "" {
+		userAgent = DefaultUserAgent
+	}
+	return &Nominatim{
+		baseURL:   strings.TrimRight(baseURL, "/"),
+		userAgent: userAgent,
+		client: &http.Client{
+			Timeout: 10 * time.Second,
+			// Traces upstream calls and sends the W3C traceparent header
+			Transport: otelhttp.NewTransport(http.DefaultTransport),
+		},
+	}
+}
+
+// nominatimPlace is a place as returned by Nominatim's JSON output format
+type nominatimPlace struct {
+	Lat         string            `json:"lat"`
+	Lon         string            `json:"lon"`
+	DisplayName string            `json:"display_name"`
+	Address     map[string]string `json:"address"`
+	BoundingBox []string          `json:"boundingbox"` // south, north, west, east
+	OSMType     string            `json:"osm_type"`
+	OSMID       int64             `json:"osm_id"`
+	PlaceRank   int               `json:"place_rank"`
+	Importance  float64           `json:"importance"`
+	Error       string            `json:"error"` // Set when nothing was found
+}
+
+// toPlace converts a Nominatim place into the typed model
+func (p nominatimPlace) toPlace() *models.Place {
+	place := &models.Place{
+		FormattedAddress: p.DisplayName,
+		Address:          models.NewAddress(p.Address),
+		OSMType:          p.OSMType,
+		OSMID:            p.OSMID,
+		PlaceRank:        p.PlaceRank,
+		Importance:       p.Importance,
+	}
+	place.Latitude, _ = strconv.ParseFloat(p.Lat, 64)
+	place.Longitude, _ = strconv.ParseFloat(p.Lon, 64)
+
+	if place.FormattedAddress == "" {
+		place.FormattedAddress = place.Address.Format()
+	}
+
+	if len(p.BoundingBox) == 4 {
+		var bbox [4]float64
+		valid := true
+		for i, v := range p.BoundingBox {
+			f, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				valid = false
+				break
+			}
+			bbox[i] = f
+		}
+		if valid {
+			place.BoundingBox = &models.BoundingBox{South: bbox[0], North: bbox[1], West: bbox[2], East: bbox[3]}
+		}
+	}
+
+	return place
+}
+
+// Reverse converts coordinates to a place using the /reverse endpoint
+func (n *Nominatim) Reverse(ctx context.Context, lat, lng float64) (*models.Place, error) {
+	params := url.Values{}
+	params.Set("format", "json")
+	params.Set("lat", strconv.FormatFloat(lat, 'f', 6, 64))
+	params.Set("lon", strconv.FormatFloat(lng, 'f', 6, 64))
+	params.Set("zoom", "18")
+	params.Set("addressdetails", "1")
+
+	var data nominatimPlace
+	if err := n.get(ctx, "/reverse", params, &data); err != nil {
+		return nil, err
+	}
+	if data.Error != "" {
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, data.Error)
+	}
+	return data.toPlace(), nil
+}
+
+// Search converts a free-form query to candidate places using the /search endpoint.
+// Results are ranked by Nominatim, most relevant first.
+func (n *Nominatim) Search(ctx context.Context, query string, limit int) ([]models.Place, error) {
+	params := url.Values{}
+	params.Set("format", "json")
+	params.Set("q", query)
+	params.Set("limit", strconv.Itoa(limit))
+	params.Set("addressdetails", "1")
+
+	var data []nominatimPlace
+	if err := n.get(ctx, "/search", params, &data); err != nil {
+		return nil, err
+	}
+
+	places := make([]models.Place, 0, len(data))
+	for _, p := range data {
+		places = append(places, *p.toPlace())
+	}
+	return places, nil
+}
+
+// nominatimStatus is the response of the /status endpoint
+type nominatimStatus struct {
+	Status  int    `json:"status"` // 0 when the server is working
+	Message string `json:"message"`
+}
+
+// Ping checks the server using the /status endpoint, which does not count
+// against the usage policy like geocoding requests do
+func (n *Nominatim) Ping(ctx context.Context) error {
+	params := url.Values{}
+	params.Set("format", "json")
+
+	var data nominatimStatus
+	if err := n.get(ctx, "/status", params, &data); err != nil {
+		return err
+	}
+	if data.Status != 0 {
+		return fmt.Errorf("nominatim status %d: %s", data.Status, data.Message)
+	}
+	return nil
+}
+
+// get performs a GET request against the Nominatim server and decodes the JSON body into v
+func (n *Nominatim) get(ctx context.Context, path string, params url.Values, v interface{}) error {
+	apiURL := n.baseURL + path + "?" + params.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, apiURL, nil)
+	if err != nil {
+		return err
+	}
+	// Nominatim requires a proper User-Agent
+	req.Header.Set("User-Agent", n.userAgent)
+	// Lets a self-hosted server's logs be matched with ours
+	if id := logging.RequestID(ctx); id != "" {
+		req.Header.Set("X-Request-ID", id)
+	}
+
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("nominatim API returned status %d", resp.StatusCode)
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(body, v)
+}
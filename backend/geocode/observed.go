@@ -0,0 +1,47 @@
+package geocode
+
+import (
+	"context"
+	"latlongapi/backend/models"
+	"time"
+)
+
+// Geocoding operations reported to an ObserveFunc
+const (
+	OpReverse = "reverse"
+	OpSearch  = "search"
+)
+
+// ObserveFunc is told about every call that reaches the wrapped geocoder
+type ObserveFunc func(op string, duration time.Duration, err error)
+
+// Observed wraps a Geocoder and reports the duration and outcome of each call.
+// Wrap the provider itself, inside Limited, to observe only upstream calls.
+type Observed struct {
+	next    Geocoder
+	observe ObserveFunc
+}
+
+// NewObserved wraps next so that observe is called after each call
+func NewObserved(next Geocoder, observe ObserveFunc) *Observed {
+	return &Observed{
+		next:    next,
+		observe: observe,
+	}
+}
+
+// Reverse calls the wrapped geocoder and reports the call
+func (o *Observed) Reverse(ctx context.Context, lat, lng float64) (*models.Place, error) {
+	start := time.Now()
+	place, err := o.next.Reverse(ctx, lat, lng)
+	o.observe(OpReverse, time.Since(start), err)
+	return place, err
+}
+
+// Search calls the wrapped geocoder and reports the call
+func (o *Observed) Search(ctx context.Context, query string, limit int) ([]models.Place, error) {
+	start := time.Now()
+	places, err := o.next.Search(ctx, query, limit)
+	o.observe(OpSearch, time.Since(start), err)
+	return places, err
+}
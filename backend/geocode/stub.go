@@ -0,0 +1,53 @@
+package geocode
+
+import (
+	"context"
+	"latlongapi/backend/models"
+)
+
+// Stub is an offline Geocoder that returns fixed, Nominatim-shaped results.
+// It is intended for local development and tests.
+type Stub struct{}
+
+// NewStub creates a stub geocoder
+func NewStub() *Stub {
+	return &Stub{}
+}
+
+// Reverse returns a placeholder address for any coordinate
+func (s *Stub) Reverse(ctx context.Context, lat, lng float64) (*models.Place, error) {
+	return &models.Place{
+		Latitude:         lat,
+		Longitude:        lng,
+		FormattedAddress: "1 Example Street, Stubville, Teststate, 00000, Nowhere",
+		Address: models.Address{
+			HouseNumber: "1",
+			Road:        "Example Street",
+			City:        "Stubville",
+			State:       "Teststate",
+			Postcode:    "00000",
+			Country:     "Nowhere",
+			CountryCode: "xx",
+		},
+		BoundingBox: &models.BoundingBox{South: lat - 0.0001, North: lat + 0.0001, West: lng - 0.0001, East: lng + 0.0001},
+		OSMType:     "node",
+		OSMID:       1,
+		PlaceRank:   30,
+	}, nil
+}
+
+// Search returns a single placeholder candidate for any query
+func (s *Stub) Search(ctx context.Context, query string, limit int) ([]models.Place, error) {
+	place, err := s.Reverse(ctx, 0, 0)
+	if err != nil {
+		return nil, err
+	}
+	place.FormattedAddress = query + ", Stubville, Teststate, 00000, Nowhere"
+	place.Importance = 1
+	return []models.Place{*place}, nil
+}
+
+// Ping always succeeds
+func (s *Stub) Ping(ctx context.Context) error {
+	return nil
+}
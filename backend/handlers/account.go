@@ -0,0 +1,305 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"latlongapi/backend/auth"
+	"latlongapi/backend/mail"
+	"latlongapi/backend/models"
+	"latlongapi/backend/store"
+	"log/slog"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const mailTimeout = 30 * time.Second
+
+// TokenRequest represents a request carrying an emailed action token
+type TokenRequest struct {
+	Token string `json:"token"`
+}
+
+// ForgotPasswordRequest represents a password reset request
+type ForgotPasswordRequest struct {
+	Email string `json:"email"`
+}
+
+// ResetPasswordRequest represents a request to set a new password
+type ResetPasswordRequest struct {
+	Token    string `json:"token"`
+	Password string `json:"password"`
+}
+
+// Verify confirms a user's email address with a token from a verification email
+func (h *AuthHandler) Verify(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req TokenRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Token == "" {
+		respondError(w, "Token is required", http.StatusBadRequest)
+		return
+	}
+
+	claims, user, ok := h.redeemActionToken(w, r, req.Token, auth.PurposeVerifyEmail)
+	if !ok {
+		return
+	}
+
+	// The address may have changed since the email was sent
+	if claims.Email != user.Email {
+		respondError(w, "Invalid or expired token", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.userStore.MarkEmailVerified(user.ID); err != nil {
+		slog.ErrorContext(r.Context(), "error verifying email", "error", err)
+		respondError(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	respondJSON(w, map[string]string{"message": "Email verified"}, http.StatusOK)
+}
+
+// ForgotPassword emails a password reset link. It responds the same way
+// whether or not the account exists, so it cannot be used to probe for
+// registered addresses. Requests are limited per email address and per
+// client, so that it cannot be used to flood a mailbox or the mailer.
+func (h *AuthHandler) ForgotPassword(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req ForgotPasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Email == "" {
+		respondError(w, "Email is required", http.StatusBadRequest)
+		return
+	}
+
+	// Unknown addresses are limited like real ones, so the limit does not
+	// reveal whether an account exists
+	now := time.Now()
+	ok, wait := h.resetsPerIP.Allow(ClientIP(r), now)
+	if ok {
+		ok, wait = h.resetsPerEmail.Allow(strings.ToLower(strings.TrimSpace(req.Email)), now)
+	}
+	if !ok {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+		respondError(w, "Too many password reset requests, try again later", http.StatusTooManyRequests)
+		return
+	}
+
+	user, err := h.userStore.GetUserByEmail(req.Email)
+	switch {
+	case err == nil:
+		h.sendPasswordResetEmail(r.Context(), user)
+	case err != store.ErrUserNotFound:
+		slog.ErrorContext(r.Context(), "error getting user", "error", err)
+	}
+
+	respondJSON(w, map[string]string{
+		"message": "If an account exists for this email, a password reset link has been sent",
+	}, http.StatusAccepted)
+}
+
+// ResetPassword sets a new password with a token from a password reset email.
+// All of the user's sessions are signed out.
+func (h *AuthHandler) ResetPassword(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req ResetPasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if req.Token == "" || req.Password == "" {
+		respondError(w, "Token and password are required", http.StatusBadRequest)
+		return
+	}
+
+	if !h.validatePassword(w, req.Password) {
+		return
+	}
+
+	claims, user, ok := h.redeemActionToken(w, r, req.Token, auth.PurposeResetPassword)
+	if !ok {
+		return
+	}
+
+	if claims.PasswordHash != auth.PasswordFingerprint(user.Password) {
+		respondError(w, "Invalid or expired token", http.StatusBadRequest)
+		return
+	}
+
+	hashedPassword, err := auth.HashPassword(req.Password)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "error hashing password", "error", err)
+		respondError(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	if err := h.userStore.UpdatePassword(user.ID, hashedPassword); err != nil {
+		slog.ErrorContext(r.Context(), "error updating password", "error", err)
+		respondError(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	// Receiving the reset email proves the user owns the address
+	if err := h.userStore.MarkEmailVerified(user.ID); err != nil {
+		slog.ErrorContext(r.Context(), "error verifying email", "error", err)
+	}
+
+	if err := h.tokenStore.RevokeUserSessions(user.ID, time.Now().Add(auth.AccessTokenTTL)); err != nil {
+		slog.ErrorContext(r.Context(), "error revoking sessions", "error", err)
+	}
+
+	respondJSON(w, map[string]string{"message": "Password has been reset"}, http.StatusOK)
+}
+
+// redeemActionToken validates an action token, marks it as used and loads
+// its user, writing an error response if any step fails
+func (h *AuthHandler) redeemActionToken(w http.ResponseWriter, r *http.Request, token, purpose string) (*auth.ActionClaims, *models.User, bool) {
+	claims, err := auth.ValidateActionToken(token, purpose)
+	if err != nil {
+		respondError(w, "Invalid or expired token", http.StatusBadRequest)
+		return nil, nil, false
+	}
+
+	userID, err := claims.UserID()
+	if err != nil {
+		respondError(w, "Invalid or expired token", http.StatusBadRequest)
+		return nil, nil, false
+	}
+
+	user, err := h.userStore.GetUserByID(userID)
+	if err != nil {
+		if err == store.ErrUserNotFound {
+			respondError(w, "Invalid or expired token", http.StatusBadRequest)
+			return nil, nil, false
+		}
+		slog.ErrorContext(r.Context(), "error getting user", "error", err)
+		respondError(w, "Internal server error", http.StatusInternalServerError)
+		return nil, nil, false
+	}
+
+	// Tokens are single use: record the token ID until the token expires
+	consumed, err := h.tokenStore.ConsumeToken(claims.ID, claims.ExpiresAt.Time)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "error consuming token", "error", err)
+		respondError(w, "Internal server error", http.StatusInternalServerError)
+		return nil, nil, false
+	}
+	if !consumed {
+		respondError(w, "Invalid or expired token", http.StatusBadRequest)
+		return nil, nil, false
+	}
+
+	return claims, user, true
+}
+
+// sendVerificationEmail emails user a link to confirm their address
+func (h *AuthHandler) sendVerificationEmail(ctx context.Context, user *models.User) {
+	token, err := auth.GenerateActionToken(auth.PurposeVerifyEmail, user.ID, user.Email, "", auth.VerifyEmailTokenTTL)
+	if err != nil {
+		slog.ErrorContext(ctx, "error generating verification token", "error", err)
+		return
+	}
+
+	h.sendMail(ctx, mail.Message{
+		To:      user.Email,
+		Subject: "Verify your LatLongAPI email address",
+		Body: fmt.Sprintf("Welcome to LatLongAPI!\n\nConfirm your email address by opening this link:\n\n%s\n\nThe link expires in %s.\n",
+			h.link("verify", token), formatTTL(auth.VerifyEmailTokenTTL)),
+	})
+}
+
+// sendPasswordResetEmail emails user a link to choose a new password
+func (h *AuthHandler) sendPasswordResetEmail(ctx context.Context, user *models.User) {
+	token, err := auth.GenerateActionToken(auth.PurposeResetPassword, user.ID, user.Email, user.Password, auth.ResetPasswordTokenTTL)
+	if err != nil {
+		slog.ErrorContext(ctx, "error generating password reset token", "error", err)
+		return
+	}
+
+	h.sendMail(ctx, mail.Message{
+		To:      user.Email,
+		Subject: "Reset your LatLongAPI password",
+		Body: fmt.Sprintf("Someone asked to reset the password of your LatLongAPI account.\n\nChoose a new password by opening this link:\n\n%s\n\nThe link expires in %s. If you did not ask for this, you can ignore this email.\n",
+			h.link("reset", token), formatTTL(auth.ResetPasswordTokenTTL)),
+	})
+}
+
+// link builds a login page link carrying token. The token goes in the
+// fragment so it is never sent to the server or leaked in Referer headers.
+func (h *AuthHandler) link(action, token string) string {
+	return h.baseURL + "/login#" + action + "=" + url.QueryEscape(token)
+}
+
+// formatTTL describes a link lifetime in whole days, hours or minutes
+func formatTTL(d time.Duration) string {
+	n, unit := int(d.Minutes()), "minute"
+	if d >= time.Hour && d%time.Hour == 0 {
+		n, unit = int(d.Hours()), "hour"
+	}
+	if d >= 24*time.Hour && d%(24*time.Hour) == 0 {
+		n, unit = int(d.Hours())/24, "day"
+	}
+	if n != 1 {
+		unit += "s"
+	}
+	return fmt.Sprintf("%d %s", n, unit)
+}
+
+// sendMail sends msg in the background, so responses do not wait on (or
+// reveal anything through the timing of) the mail server
+func (h *AuthHandler) sendMail(ctx context.Context, msg mail.Message) {
+	// The request may be over before the mail is sent
+	ctx = context.WithoutCancel(ctx)
+	go func() {
+		ctx, cancel := context.WithTimeout(ctx, mailTimeout)
+		defer cancel()
+
+		if err := h.mailer.Send(ctx, msg); err != nil {
+			slog.ErrorContext(ctx, "error sending email", "to", msg.To, "error", err)
+		}
+	}()
+}
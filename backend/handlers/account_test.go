@@ -0,0 +1,172 @@
+package handlers
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"latlongapi/backend/auth"
+	"latlongapi/backend/models"
+	"latlongapi/backend/store"
+)
+
+// createUser adds a user with password
+func createUser(t *testing.T, memStore *store.MemoryStore, email, password string) *models.User {
+	t.Helper()
+	hash, err := auth.HashPassword(password)
+	if err != nil {
+		t.Fatalf("HashPassword: %v", err)
+	}
+	user, err := memStore.CreateUser(email, hash)
+	if err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+	return user
+}
+
+// actionToken issues a token for purpose to user
+func actionToken(t *testing.T, user *models.User, purpose string) string {
+	t.Helper()
+	token, err := auth.GenerateActionToken(purpose, user.ID, user.Email, user.Password, time.Hour)
+	if err != nil {
+		t.Fatalf("GenerateActionToken: %v", err)
+	}
+	return token
+}
+
+// linkToken returns the token of the given action in an emailed link
+func linkToken(t *testing.T, body, action string) string {
+	t.Helper()
+	_, rest, ok := strings.Cut(body, "/login#"+action+"=")
+	if !ok {
+		t.Fatalf("no %s link in %q", action, body)
+	}
+	token, err := url.QueryUnescape(strings.Fields(rest)[0])
+	if err != nil {
+		t.Fatalf("unescaping token: %v", err)
+	}
+	return token
+}
+
+func TestVerifyTokenIsSingleUse(t *testing.T) {
+	h, memStore, _ := newTestAuthHandler()
+	user := createUser(t, memStore, "erin@example.com", "old password")
+	token := actionToken(t, user, auth.PurposeVerifyEmail)
+
+	if status := doJSON(t, h.Verify, http.MethodPost, "/api/auth/verify", TokenRequest{Token: token}, nil); status != http.StatusOK {
+		t.Fatalf("verify: got status %d, want %d", status, http.StatusOK)
+	}
+	if user, _ := memStore.GetUserByID(user.ID); !user.EmailVerified() {
+		t.Error("email not verified")
+	}
+
+	if status := doJSON(t, h.Verify, http.MethodPost, "/api/auth/verify", TokenRequest{Token: token}, nil); status != http.StatusBadRequest {
+		t.Errorf("second verify: got status %d, want %d", status, http.StatusBadRequest)
+	}
+}
+
+func TestVerifyRejectsTokenForOldEmail(t *testing.T) {
+	h, memStore, _ := newTestAuthHandler()
+	user := createUser(t, memStore, "erin@example.com", "old password")
+	token := actionToken(t, user, auth.PurposeVerifyEmail)
+
+	if err := memStore.ChangeEmail(user.ID, "erin@example.org"); err != nil {
+		t.Fatalf("ChangeEmail: %v", err)
+	}
+	if status := doJSON(t, h.Verify, http.MethodPost, "/api/auth/verify", TokenRequest{Token: token}, nil); status != http.StatusBadRequest {
+		t.Errorf("got status %d, want %d", status, http.StatusBadRequest)
+	}
+	if user, _ := memStore.GetUserByID(user.ID); user.EmailVerified() {
+		t.Error("new email verified with a token for the old one")
+	}
+}
+
+func TestVerifyRejectsResetToken(t *testing.T) {
+	h, memStore, _ := newTestAuthHandler()
+	user := createUser(t, memStore, "erin@example.com", "old password")
+	token := actionToken(t, user, auth.PurposeResetPassword)
+
+	if status := doJSON(t, h.Verify, http.MethodPost, "/api/auth/verify", TokenRequest{Token: token}, nil); status != http.StatusBadRequest {
+		t.Errorf("got status %d, want %d", status, http.StatusBadRequest)
+	}
+}
+
+func TestPasswordReset(t *testing.T) {
+	h, memStore, mailer := newTestAuthHandler()
+	user := createUser(t, memStore, "erin@example.com", "old password")
+	session := startSessionFor(t, h, user)
+
+	if status := doJSON(t, h.ForgotPassword, http.MethodPost, "/api/auth/forgot-password", ForgotPasswordRequest{Email: user.Email}, nil); status != http.StatusAccepted {
+		t.Fatalf("forgot password: got status %d, want %d", status, http.StatusAccepted)
+	}
+	msg := mailer.wait(t)
+	if msg.To != user.Email {
+		t.Fatalf("reset email sent to %q, want %q", msg.To, user.Email)
+	}
+	token := linkToken(t, msg.Body, "reset")
+
+	req := ResetPasswordRequest{Token: token, Password: "new password"}
+	if status := doJSON(t, h.ResetPassword, http.MethodPost, "/api/auth/reset-password", req, nil); status != http.StatusOK {
+		t.Fatalf("reset: got status %d, want %d", status, http.StatusOK)
+	}
+
+	updated, _ := memStore.GetUserByID(user.ID)
+	if !auth.CheckPasswordHash("new password", updated.Password) {
+		t.Error("password not changed")
+	}
+	if !updated.EmailVerified() {
+		t.Error("email not verified by the reset")
+	}
+	if !sessionRevoked(t, memStore, session.Token) {
+		t.Error("sessions not revoked by the reset")
+	}
+
+	// The token is single use
+	req.Password = "another password"
+	if status := doJSON(t, h.ResetPassword, http.MethodPost, "/api/auth/reset-password", req, nil); status != http.StatusBadRequest {
+		t.Errorf("second reset: got status %d, want %d", status, http.StatusBadRequest)
+	}
+}
+
+func TestPasswordResetTokenExpiresWithPassword(t *testing.T) {
+	h, memStore, _ := newTestAuthHandler()
+	user := createUser(t, memStore, "erin@example.com", "old password")
+	first := actionToken(t, user, auth.PurposeResetPassword)
+	second := actionToken(t, user, auth.PurposeResetPassword)
+
+	req := ResetPasswordRequest{Token: first, Password: "new password"}
+	if status := doJSON(t, h.ResetPassword, http.MethodPost, "/api/auth/reset-password", req, nil); status != http.StatusOK {
+		t.Fatalf("reset: got status %d, want %d", status, http.StatusOK)
+	}
+
+	// Issued for the old password, so it no longer works
+	req = ResetPasswordRequest{Token: second, Password: "attacker password"}
+	if status := doJSON(t, h.ResetPassword, http.MethodPost, "/api/auth/reset-password", req, nil); status != http.StatusBadRequest {
+		t.Errorf("reset with an older token: got status %d, want %d", status, http.StatusBadRequest)
+	}
+}
+
+func TestForgotPasswordIsLimitedPerEmail(t *testing.T) {
+	h, memStore, _ := newTestAuthHandler()
+	h.SetPasswordResetLimits(2, 100)
+	createUser(t, memStore, "erin@example.com", "old password")
+
+	// The limit ignores case and surrounding spaces
+	for _, email := range []string{"erin@example.com", " Erin@Example.com"} {
+		if status := doJSON(t, h.ForgotPassword, http.MethodPost, "/api/auth/forgot-password", ForgotPasswordRequest{Email: email}, nil); status != http.StatusAccepted {
+			t.Fatalf("%q: got status %d, want %d", email, status, http.StatusAccepted)
+		}
+	}
+	if status := doJSON(t, h.ForgotPassword, http.MethodPost, "/api/auth/forgot-password", ForgotPasswordRequest{Email: "ERIN@example.com"}, nil); status != http.StatusTooManyRequests {
+		t.Errorf("third request: got status %d, want %d", status, http.StatusTooManyRequests)
+	}
+
+	// Unknown addresses are limited the same way
+	for i, want := range []int{http.StatusAccepted, http.StatusAccepted, http.StatusTooManyRequests} {
+		if status := doJSON(t, h.ForgotPassword, http.MethodPost, "/api/auth/forgot-password", ForgotPasswordRequest{Email: "nobody@example.com"}, nil); status != want {
+			t.Errorf("unknown address, request %d: got status %d, want %d", i+1, status, want)
+		}
+	}
+}
@@ -0,0 +1,341 @@
+package handlers
+
+import (
+	"encoding/json"
+	"latlongapi/backend/auth"
+	"latlongapi/backend/models"
+	"latlongapi/backend/store"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultAdminPageSize = 50
+	maxAdminPageSize     = 200
+)
+
+// AdminHandler serves the user and organization management API for admins
+type AdminHandler struct {
+	userStore  models.UserStore
+	tokenStore models.TokenStore
+	orgStore   models.OrganizationStore
+}
+
+// NewAdminHandler creates a new admin handler
+func NewAdminHandler(userStore models.UserStore, tokenStore models.TokenStore, orgStore models.OrganizationStore) *AdminHandler {
+	return &AdminHandler{
+		userStore:  userStore,
+		tokenStore: tokenStore,
+		orgStore:   orgStore,
+	}
+}
+
+// UserListResponse is one page of users
+type UserListResponse struct {
+	Total  int            `json:"total"` // Users matching the filters, across all pages
+	Offset int            `json:"offset"`
+	Limit  int            `json:"limit"`
+	Users  []*models.User `json:"users"`
+}
+
+// UpdateUserRequest represents an admin change to a user. Omitted fields
+// are left unchanged.
+type UpdateUserRequest struct {
+	Plan      *string `json:"plan"`
+	Role      *string `json:"role"`
+	Suspended *bool   `json:"suspended"`
+}
+
+// UpdateOrgRequest represents an admin change to an organization
+type UpdateOrgRequest struct {
+	Plan string `json:"plan"`
+}
+
+// Users handles /api/admin/users: GET lists users, filtered by the q (email
+// search), role and plan query parameters and paged by offset and limit
+func (h *AdminHandler) Users(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Methods", "GET, OPTIONS")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	q := r.URL.Query()
+	query := models.UserQuery{
+		Search: strings.TrimSpace(q.Get("q")),
+		Role:   q.Get("role"),
+		Plan:   q.Get("plan"),
+		Limit:  defaultAdminPageSize,
+	}
+
+	if offsetStr := q.Get("offset"); offsetStr != "" {
+		n, err := strconv.Atoi(offsetStr)
+		if err != nil || n < 0 {
+			respondError(w, "Offset must be a non-negative number", http.StatusBadRequest)
+			return
+		}
+		query.Offset = n
+	}
+	if limitStr := q.Get("limit"); limitStr != "" {
+		n, err := strconv.Atoi(limitStr)
+		if err != nil || n < 1 || n > maxAdminPageSize {
+			respondError(w, "Limit must be between 1 and 200", http.StatusBadRequest)
+			return
+		}
+		query.Limit = n
+	}
+
+	users, total, err := h.userStore.ListUsers(query)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "error listing users", "error", err)
+		respondError(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	respondJSON(w, UserListResponse{
+		Total:  total,
+		Offset: query.Offset,
+		Limit:  query.Limit,
+		Users:  users,
+	}, http.StatusOK)
+}
+
+// User handles /api/admin/users/{id}: GET returns the user, PATCH changes
+// their plan, role or suspension, and DELETE deletes the account
+func (h *AdminHandler) User(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Methods", "GET, PATCH, DELETE, OPTIONS")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	admin, ok := r.Context().Value("user").(*models.User)
+	if !ok {
+		respondError(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	id, err := strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/api/admin/users/"))
+	if err != nil {
+		respondError(w, "User not found", http.StatusNotFound)
+		return
+	}
+
+	user, err := h.userStore.GetUserByID(id)
+	if err != nil {
+		if err == store.ErrUserNotFound {
+			respondError(w, "User not found", http.StatusNotFound)
+			return
+		}
+		slog.ErrorContext(r.Context(), "error getting user", "error", err)
+		respondError(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		respondJSON(w, user, http.StatusOK)
+
+	case http.MethodPatch:
+		h.updateUser(w, r, admin, user)
+
+	case http.MethodDelete:
+		// Admins cannot lock themselves out
+		if user.ID == admin.ID {
+			respondError(w, "You cannot delete your own account", http.StatusBadRequest)
+			return
+		}
+
+		// Deleting the only owner would leave an organization unmanageable
+		if org, err := soleOwnedOrg(h.orgStore, user.ID); err != nil {
+			slog.ErrorContext(r.Context(), "error listing organizations", "error", err)
+			respondError(w, "Internal server error", http.StatusInternalServerError)
+			return
+		} else if org != nil {
+			respondError(w, "The user is the only owner of organization "+strconv.Itoa(org.ID)+" ("+org.Name+"); transfer or delete it first", http.StatusConflict)
+			return
+		}
+
+		if err := h.userStore.DeleteUser(user.ID); err != nil {
+			if err == store.ErrUserNotFound {
+				respondError(w, "User not found", http.StatusNotFound)
+				return
+			}
+			slog.ErrorContext(r.Context(), "error deleting user", "error", err)
+			respondError(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		slog.InfoContext(r.Context(), "audit: admin deleted user", "actor_id", admin.ID, "target_user_id", user.ID, "email", user.Email)
+
+		respondJSON(w, map[string]string{"message": "User deleted"}, http.StatusOK)
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// updateUser applies an UpdateUserRequest to user. Suspending a user also
+// ends all of their sessions.
+func (h *AdminHandler) updateUser(w http.ResponseWriter, r *http.Request, admin, user *models.User) {
+	var req UpdateUserRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	// Changes go to a copy: user keeps the old values for the audit log and
+	// for the response when nothing changes
+	updated := *user
+	var changes []string
+
+	if req.Plan != nil && *req.Plan != updated.Plan {
+		if _, ok := models.Plans[*req.Plan]; !ok {
+			respondError(w, "Unknown plan", http.StatusBadRequest)
+			return
+		}
+		changes = append(changes, "plan "+updated.Plan+" -> "+*req.Plan)
+		updated.Plan = *req.Plan
+	}
+
+	if req.Role != nil && *req.Role != updated.Role {
+		if !models.Roles[*req.Role] {
+			respondError(w, "Unknown role", http.StatusBadRequest)
+			return
+		}
+		if user.ID == admin.ID {
+			respondError(w, "You cannot change your own role", http.StatusBadRequest)
+			return
+		}
+		changes = append(changes, "role "+updated.Role+" -> "+*req.Role)
+		now := time.Now()
+		updated.Role = *req.Role
+		updated.RoleChangedAt = &now
+	}
+
+	suspending := false
+	if req.Suspended != nil && *req.Suspended != updated.Suspended() {
+		if *req.Suspended {
+			if user.ID == admin.ID {
+				respondError(w, "You cannot suspend your own account", http.StatusBadRequest)
+				return
+			}
+			now := time.Now()
+			updated.SuspendedAt = &now
+			suspending = true
+			changes = append(changes, "suspended")
+		} else {
+			updated.SuspendedAt = nil
+			changes = append(changes, "unsuspended")
+		}
+	}
+
+	if len(changes) == 0 {
+		respondJSON(w, user, http.StatusOK)
+		return
+	}
+
+	if err := h.userStore.UpdateUser(&updated); err != nil {
+		if err == store.ErrUserNotFound {
+			respondError(w, "User not found", http.StatusNotFound)
+			return
+		}
+		slog.ErrorContext(r.Context(), "error updating user", "error", err)
+		respondError(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	slog.InfoContext(r.Context(), "audit: admin updated user", "actor_id", admin.ID, "target_user_id", user.ID, "email", user.Email, "changes", strings.Join(changes, ", "))
+
+	if suspending {
+		if err := h.tokenStore.RevokeUserSessions(user.ID, time.Now().Add(auth.AccessTokenTTL)); err != nil {
+			slog.ErrorContext(r.Context(), "error revoking sessions of suspended user", "target_user_id", user.ID, "error", err)
+		}
+	}
+
+	respondJSON(w, &updated, http.StatusOK)
+}
+
+// Org handles /api/admin/orgs/{id}: GET returns the organization and PATCH
+// changes its plan
+func (h *AdminHandler) Org(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Methods", "GET, PATCH, OPTIONS")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	admin, ok := r.Context().Value("user").(*models.User)
+	if !ok {
+		respondError(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	id, err := strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/api/admin/orgs/"))
+	if err != nil {
+		respondError(w, "Organization not found", http.StatusNotFound)
+		return
+	}
+
+	org, err := h.orgStore.GetOrganization(id)
+	if err != nil {
+		if err == store.ErrOrganizationNotFound {
+			respondError(w, "Organization not found", http.StatusNotFound)
+			return
+		}
+		slog.ErrorContext(r.Context(), "error getting organization", "error", err)
+		respondError(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		respondJSON(w, org, http.StatusOK)
+
+	case http.MethodPatch:
+		var req UpdateOrgRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			respondError(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		if _, ok := models.Plans[req.Plan]; !ok {
+			respondError(w, "Unknown plan", http.StatusBadRequest)
+			return
+		}
+
+		if req.Plan != org.Plan {
+			oldPlan := org.Plan
+			org.Plan = req.Plan
+			if err := h.orgStore.UpdateOrganization(org); err != nil {
+				if err == store.ErrOrganizationNotFound {
+					respondError(w, "Organization not found", http.StatusNotFound)
+					return
+				}
+				slog.ErrorContext(r.Context(), "error updating organization", "error", err)
+				respondError(w, "Internal server error", http.StatusInternalServerError)
+				return
+			}
+			slog.InfoContext(r.Context(), "audit: admin updated organization plan", "actor_id", admin.ID, "org_id", org.ID, "name", org.Name, "old_plan", oldPlan, "new_plan", org.Plan)
+		}
+
+		respondJSON(w, org, http.StatusOK)
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
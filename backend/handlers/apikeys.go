@@ -0,0 +1,180 @@
+package handlers
+
+import (
+	"encoding/json"
+	"latlongapi/backend/auth"
+	"latlongapi/backend/models"
+	"latlongapi/backend/store"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const maxAPIKeyLabelLength = 100
+
+// APIKeyHandler handles API key management for authenticated users
+type APIKeyHandler struct {
+	keyStore models.APIKeyStore
+}
+
+// NewAPIKeyHandler creates a new API key handler
+func NewAPIKeyHandler(keyStore models.APIKeyStore) *APIKeyHandler {
+	return &APIKeyHandler{
+		keyStore: keyStore,
+	}
+}
+
+// APIKeyRequest represents a request to create or relabel an API key
+type APIKeyRequest struct {
+	Label string `json:"label"`
+}
+
+// CreateAPIKeyResponse represents a newly created API key. The plaintext
+// key is only ever returned here.
+type CreateAPIKeyResponse struct {
+	Key    string         `json:"key"`
+	APIKey *models.APIKey `json:"api_key"`
+}
+
+// Keys handles /api/keys: GET lists the user's keys, POST creates a new one
+func (h *APIKeyHandler) Keys(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	user, ok := r.Context().Value("user").(*models.User)
+	if !ok {
+		respondError(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		keys, err := h.keyStore.ListAPIKeys(user.ID)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "error listing API keys", "error", err)
+			respondError(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		respondJSON(w, keys, http.StatusOK)
+
+	case http.MethodPost:
+		if !user.EmailVerified() {
+			respondError(w, "Verify your email address before creating API keys", http.StatusForbidden)
+			return
+		}
+
+		var req APIKeyRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			respondError(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		label, ok := validateAPIKeyLabel(w, req.Label)
+		if !ok {
+			return
+		}
+
+		key, prefix, hash, err := auth.GenerateAPIKey()
+		if err != nil {
+			slog.ErrorContext(r.Context(), "error generating API key", "error", err)
+			respondError(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+
+		apiKey, err := h.keyStore.CreateAPIKey(user.ID, label, prefix, hash)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "error creating API key", "error", err)
+			respondError(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+
+		respondJSON(w, CreateAPIKeyResponse{
+			Key:    key,
+			APIKey: apiKey,
+		}, http.StatusCreated)
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// Key handles /api/keys/{id}: PATCH changes the label, DELETE revokes the key
+func (h *APIKeyHandler) Key(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Methods", "PATCH, DELETE, OPTIONS")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	user, ok := r.Context().Value("user").(*models.User)
+	if !ok {
+		respondError(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	id, err := strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/api/keys/"))
+	if err != nil {
+		respondError(w, "API key not found", http.StatusNotFound)
+		return
+	}
+
+	var apiKey *models.APIKey
+	switch r.Method {
+	case http.MethodPatch:
+		var req APIKeyRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			respondError(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		label, ok := validateAPIKeyLabel(w, req.Label)
+		if !ok {
+			return
+		}
+		apiKey, err = h.keyStore.UpdateAPIKeyLabel(user.ID, id, label)
+
+	case http.MethodDelete:
+		apiKey, err = h.keyStore.RevokeAPIKey(user.ID, id)
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if err != nil {
+		if err == store.ErrAPIKeyNotFound {
+			respondError(w, "API key not found", http.StatusNotFound)
+			return
+		}
+		slog.ErrorContext(r.Context(), "error updating API key", "error", err)
+		respondError(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	respondJSON(w, apiKey, http.StatusOK)
+}
+
+// validateAPIKeyLabel trims and checks a key label, writing an error response
+// if it is invalid
+func validateAPIKeyLabel(w http.ResponseWriter, label string) (string, bool) {
+	label = strings.TrimSpace(label)
+	if label == "" {
+		respondError(w, "Label is required", http.StatusBadRequest)
+		return "", false
+	}
+	if len(label) > maxAPIKeyLabelLength {
+		respondError(w, "Label must be at most 100 characters", http.StatusBadRequest)
+		return "", false
+	}
+	return label, true
+}
@@ -1,27 +1,85 @@
 package handlers
 
 import (
+	"context"
 	"encoding/json"
 	"latlongapi/backend/auth"
+	"latlongapi/backend/logging"
+	"latlongapi/backend/mail"
 	"latlongapi/backend/models"
+	"latlongapi/backend/ratelimit"
 	"latlongapi/backend/store"
-	"log"
+	"log/slog"
+	"math"
+	"net"
 	"net/http"
+	"strconv"
 	"strings"
+	"time"
 )
 
 // AuthHandler handles authentication-related HTTP requests
 type AuthHandler struct {
-	userStore models.UserStore
+	userStore  models.UserStore
+	tokenStore models.TokenStore
+	mfaStore   models.MFAStore
+	mailer     mail.Mailer
+	baseURL    string // Public URL of the site, used in emailed links
+	loginGuard *ratelimit.LoginGuard
+
+	adminEmails    map[string]bool // Accounts promoted to admin once their email is verified
+	passwordPolicy *auth.PasswordPolicy
+
+	// Password reset requests allowed per email address and per client
+	resetsPerEmail *ratelimit.KeyLimiter
+	resetsPerIP    *ratelimit.KeyLimiter
 }
 
+// Default password reset request limits, per hour
+const (
+	defaultResetsPerEmail = 3
+	defaultResetsPerIP    = 20
+)
+
 // NewAuthHandler creates a new authentication handler
-func NewAuthHandler(userStore models.UserStore) *AuthHandler {
+func NewAuthHandler(userStore models.UserStore, tokenStore models.TokenStore, mfaStore models.MFAStore, mailer mail.Mailer, baseURL string, loginGuard *ratelimit.LoginGuard) *AuthHandler {
 	return &AuthHandler{
-		userStore: userStore,
+		userStore:  userStore,
+		tokenStore: tokenStore,
+		mfaStore:   mfaStore,
+		mailer:     mailer,
+		baseURL:    strings.TrimSuffix(baseURL, "/"),
+		loginGuard: loginGuard,
+
+		passwordPolicy: auth.DefaultPasswordPolicy(),
+		resetsPerEmail: ratelimit.NewKeyLimiter(defaultResetsPerEmail, time.Hour),
+		resetsPerIP:    ratelimit.NewKeyLimiter(defaultResetsPerIP, time.Hour),
 	}
 }
 
+// SetAdminEmails lists the email addresses whose accounts are given the admin
+// role. Promotion happens at the first login after the address is verified,
+// so nobody can claim the role by registering an address they do not own.
+func (h *AuthHandler) SetAdminEmails(emails []string) {
+	h.adminEmails = make(map[string]bool, len(emails))
+	for _, email := range emails {
+		h.adminEmails[strings.ToLower(strings.TrimSpace(email))] = true
+	}
+}
+
+// SetPasswordPolicy sets the rules new passwords must follow, replacing the
+// default six character minimum
+func (h *AuthHandler) SetPasswordPolicy(policy *auth.PasswordPolicy) {
+	h.passwordPolicy = policy
+}
+
+// SetPasswordResetLimits sets how many password reset emails can be requested
+// per hour for one email address and from one client address
+func (h *AuthHandler) SetPasswordResetLimits(perEmail, perIP int) {
+	h.resetsPerEmail = ratelimit.NewKeyLimiter(perEmail, time.Hour)
+	h.resetsPerIP = ratelimit.NewKeyLimiter(perIP, time.Hour)
+}
+
 // RegisterRequest represents a registration request
 type RegisterRequest struct {
 	Email    string `json:"email"`
@@ -34,10 +92,17 @@ type LoginRequest struct {
 	Password string `json:"password"`
 }
 
+// RefreshRequest represents a token refresh or logout request
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
 // AuthResponse represents an authentication response
 type AuthResponse struct {
-	Token string      `json:"token"`
-	User  *models.User `json:"user"`
+	Token        string       `json:"token"`
+	RefreshToken string       `json:"refresh_token"`
+	ExpiresIn    int          `json:"expires_in"` // Access token lifetime in seconds
+	User         *models.User `json:"user"`
 }
 
 // ErrorResponse represents an error response
@@ -73,8 +138,7 @@ func (h *AuthHandler) Register(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if len(req.Password) < 6 {
-		respondError(w, "Password must be at least 6 characters", http.StatusBadRequest)
+	if !h.validatePassword(w, req.Password) {
 		return
 	}
 
@@ -88,7 +152,7 @@ func (h *AuthHandler) Register(w http.ResponseWriter, r *http.Request) {
 	// Hash password
 	hashedPassword, err := auth.HashPassword(req.Password)
 	if err != nil {
-		log.Printf("Error hashing password: %v", err)
+		slog.ErrorContext(r.Context(), "error hashing password", "error", err)
 		respondError(w, "Internal server error", http.StatusInternalServerError)
 		return
 	}
@@ -100,23 +164,22 @@ func (h *AuthHandler) Register(w http.ResponseWriter, r *http.Request) {
 			respondError(w, "User already exists", http.StatusConflict)
 			return
 		}
-		log.Printf("Error creating user: %v", err)
+		slog.ErrorContext(r.Context(), "error creating user", "error", err)
 		respondError(w, "Internal server error", http.StatusInternalServerError)
 		return
 	}
 
-	// Generate token
-	token, err := auth.GenerateToken(user.ID, user.Email)
+	h.sendVerificationEmail(r.Context(), user)
+
+	// Start a session
+	resp, err := h.newSession(r.Context(), user)
 	if err != nil {
-		log.Printf("Error generating token: %v", err)
+		slog.ErrorContext(r.Context(), "error creating session", "error", err)
 		respondError(w, "Internal server error", http.StatusInternalServerError)
 		return
 	}
 
-	respondJSON(w, AuthResponse{
-		Token: token,
-		User:  user,
-	}, http.StatusCreated)
+	respondJSON(w, resp, http.StatusCreated)
 }
 
 // Login handles user login
@@ -147,42 +210,72 @@ func (h *AuthHandler) Login(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Throttle repeated failures for this account or client
+	ip := ClientIP(r)
+	if wait := h.loginGuard.Check(req.Email, ip, time.Now()); wait > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+		respondError(w, "Too many failed login attempts, try again later", http.StatusTooManyRequests)
+		return
+	}
+
 	// Get user
 	user, err := h.userStore.GetUserByEmail(req.Email)
-	if err != nil {
-		if err == store.ErrUserNotFound {
-			respondError(w, "Invalid email or password", http.StatusUnauthorized)
-			return
-		}
-		log.Printf("Error getting user: %v", err)
+	if err != nil && err != store.ErrUserNotFound {
+		slog.ErrorContext(r.Context(), "error getting user", "error", err)
 		respondError(w, "Internal server error", http.StatusInternalServerError)
 		return
 	}
 
-	// Check password
-	if !auth.CheckPasswordHash(req.Password, user.Password) {
+	// Check password. Unknown emails (and accounts without a password, created
+	// through an identity provider) still pay for a hash comparison, so they
+	// cannot be told apart from wrong passwords by response time.
+	if user == nil || user.Password == "" {
+		auth.CheckDummyPassword(req.Password)
+	}
+	if user == nil || !auth.CheckPasswordHash(req.Password, user.Password) {
+		h.recordLoginFailure(r.Context(), req.Email, ip)
 		respondError(w, "Invalid email or password", http.StatusUnauthorized)
 		return
 	}
 
-	// Generate token
-	token, err := auth.GenerateToken(user.ID, user.Email)
+	if user.Suspended() {
+		respondError(w, "Account suspended", http.StatusForbidden)
+		return
+	}
+
+	h.rehashPassword(r.Context(), user, req.Password)
+
+	// Accounts with two-factor authentication get a session only after
+	// exchanging the MFA token and a code at /api/auth/mfa/verify
+	if user.TOTPEnabled() {
+		challenge, err := h.newMFAChallenge(user)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "error creating MFA challenge", "error", err)
+			respondError(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		respondJSON(w, challenge, http.StatusOK)
+		return
+	}
+	h.loginGuard.Succeed(req.Email)
+
+	// Start a session
+	resp, err := h.newSession(r.Context(), user)
 	if err != nil {
-		log.Printf("Error generating token: %v", err)
+		slog.ErrorContext(r.Context(), "error creating session", "error", err)
 		respondError(w, "Internal server error", http.StatusInternalServerError)
 		return
 	}
 
-	respondJSON(w, AuthResponse{
-		Token: token,
-		User:  user,
-	}, http.StatusOK)
+	respondJSON(w, resp, http.StatusOK)
 }
 
-// Me returns the current authenticated user
-func (h *AuthHandler) Me(w http.ResponseWriter, r *http.Request) {
+// Refresh exchanges a refresh token for a new access token and a new refresh
+// token. Refresh tokens are single use: presenting one that was already
+// exchanged revokes its whole session, since it may have been stolen.
+func (h *AuthHandler) Refresh(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Access-Control-Allow-Origin", "*")
-	w.Header().Set("Access-Control-Allow-Methods", "GET, OPTIONS")
+	w.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS")
 	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
 
 	if r.Method == http.MethodOptions {
@@ -190,22 +283,80 @@ func (h *AuthHandler) Me(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if r.Method != http.MethodGet {
+	if r.Method != http.MethodPost {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
-	// Get user from context (set by middleware)
-	user, ok := r.Context().Value("user").(*models.User)
-	if !ok {
-		respondError(w, "Unauthorized", http.StatusUnauthorized)
+	var req RefreshRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.RefreshToken == "" {
+		respondError(w, "Refresh token is required", http.StatusBadRequest)
+		return
+	}
+
+	token, err := h.tokenStore.GetRefreshTokenByHash(auth.HashRefreshToken(req.RefreshToken))
+	if err != nil {
+		if err == store.ErrRefreshTokenNotFound {
+			respondError(w, "Invalid refresh token", http.StatusUnauthorized)
+			return
+		}
+		slog.ErrorContext(r.Context(), "error getting refresh token", "error", err)
+		respondError(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	if time.Now().After(token.ExpiresAt) {
+		respondError(w, "Refresh token has expired", http.StatusUnauthorized)
+		return
+	}
+
+	// Rotate: revoke the presented token before issuing its replacement
+	rotated := false
+	if token.RevokedAt == nil {
+		rotated, err = h.tokenStore.RevokeRefreshToken(token.ID)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "error revoking refresh token", "error", err)
+			respondError(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+	}
+	if !rotated {
+		slog.WarnContext(r.Context(), "refresh token reuse detected, revoking session", "target_user_id", token.UserID, "session_id", token.SessionID)
+		if err := h.tokenStore.RevokeSession(token.SessionID, time.Now().Add(auth.AccessTokenTTL)); err != nil {
+			slog.ErrorContext(r.Context(), "error revoking session", "error", err)
+		}
+		respondError(w, "Invalid refresh token", http.StatusUnauthorized)
+		return
+	}
+
+	user, err := h.userStore.GetUserByID(token.UserID)
+	if err != nil {
+		if err == store.ErrUserNotFound {
+			respondError(w, "Invalid refresh token", http.StatusUnauthorized)
+			return
+		}
+		slog.ErrorContext(r.Context(), "error getting user", "error", err)
+		respondError(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	if user.Suspended() {
+		respondError(w, "Account suspended", http.StatusForbidden)
+		return
+	}
+
+	resp, err := h.issueTokens(user, token.SessionID)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "error issuing tokens", "error", err)
+		respondError(w, "Internal server error", http.StatusInternalServerError)
 		return
 	}
 
-	respondJSON(w, user, http.StatusOK)
+	respondJSON(w, resp, http.StatusOK)
 }
 
-// Logout handles user logout (client-side token removal)
+// Logout ends the current session. The access token from the request and the
+// session it belongs to are revoked; a refresh token in the body is revoked too.
 func (h *AuthHandler) Logout(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Access-Control-Allow-Origin", "*")
 	w.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS")
@@ -221,18 +372,142 @@ func (h *AuthHandler) Logout(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Logout is handled client-side by removing the token
-	// This endpoint just confirms the logout
+	// Access tokens only need to stay revoked until they would have expired anyway
+	until := time.Now().Add(auth.AccessTokenTTL)
+
+	if tokenString := GetTokenFromRequest(r); tokenString != "" {
+		if claims, err := auth.ValidateToken(tokenString); err == nil {
+			if err := h.tokenStore.RevokeToken(claims.ID, until); err != nil {
+				slog.ErrorContext(r.Context(), "error revoking access token", "error", err)
+			}
+			if claims.SessionID != "" {
+				if err := h.tokenStore.RevokeSession(claims.SessionID, until); err != nil {
+					slog.ErrorContext(r.Context(), "error revoking session", "error", err)
+				}
+			}
+		}
+	}
+
+	var req RefreshRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err == nil && req.RefreshToken != "" {
+		token, err := h.tokenStore.GetRefreshTokenByHash(auth.HashRefreshToken(req.RefreshToken))
+		if err == nil {
+			if err := h.tokenStore.RevokeSession(token.SessionID, until); err != nil {
+				slog.ErrorContext(r.Context(), "error revoking session", "error", err)
+			}
+		}
+	}
+
 	respondJSON(w, map[string]string{"message": "Logged out successfully"}, http.StatusOK)
 }
 
+// recordLoginFailure counts a failed login and audits any lockout it causes
+func (h *AuthHandler) recordLoginFailure(ctx context.Context, email, ip string) {
+	lockout := h.loginGuard.Fail(email, ip, time.Now())
+	if lockout.Account {
+		slog.WarnContext(ctx, "audit: login locked for account after repeated failures", "email", email, "until", lockout.Until.Format(time.RFC3339), "ip", ip)
+	}
+	if lockout.IP {
+		slog.WarnContext(ctx, "audit: login locked for client after repeated failures", "ip", ip, "until", lockout.Until.Format(time.RFC3339))
+	}
+}
+
+// validatePassword checks a new password against the password policy,
+// writing an error response if it is not acceptable
+func (h *AuthHandler) validatePassword(w http.ResponseWriter, password string) bool {
+	if err := h.passwordPolicy.Validate(password); err != nil {
+		respondError(w, err.Error(), http.StatusBadRequest)
+		return false
+	}
+	return true
+}
+
+// rehashPassword upgrades the stored hash of a user's password, just checked
+// to be correct, if it was made with outdated hashing parameters
+func (h *AuthHandler) rehashPassword(ctx context.Context, user *models.User, password string) {
+	if !auth.PasswordNeedsRehash(user.Password) {
+		return
+	}
+
+	hashedPassword, err := auth.HashPassword(password)
+	if err != nil {
+		slog.ErrorContext(ctx, "error hashing password", "error", err)
+		return
+	}
+	if err := h.userStore.UpdatePassword(user.ID, hashedPassword); err != nil {
+		slog.ErrorContext(ctx, "error rehashing password", "target_user_id", user.ID, "error", err)
+		return
+	}
+	slog.InfoContext(ctx, "rehashed password with the current parameters", "target_user_id", user.ID)
+}
+
+// newSession starts a new login session for user and issues its first tokens.
+// The user is added to the request's log fields, as the login request was
+// not authenticated.
+func (h *AuthHandler) newSession(ctx context.Context, user *models.User) (*AuthResponse, error) {
+	logging.SetField(ctx, "user_id", user.ID)
+	user = h.promoteAdmin(ctx, user)
+
+	sessionID, err := auth.NewSessionID()
+	if err != nil {
+		return nil, err
+	}
+	return h.issueTokens(user, sessionID)
+}
+
+// promoteAdmin gives user the admin role if their verified email address is
+// listed in the admin emails, and returns the updated user. Users whose role
+// was ever changed are left alone, so an admin's demotion sticks.
+func (h *AuthHandler) promoteAdmin(ctx context.Context, user *models.User) *models.User {
+	if user.Role == models.RoleAdmin || user.RoleChangedAt != nil ||
+		!user.EmailVerified() || !h.adminEmails[strings.ToLower(user.Email)] {
+		return user
+	}
+
+	now := time.Now()
+	updated := *user
+	updated.Role = models.RoleAdmin
+	updated.RoleChangedAt = &now
+	if err := h.userStore.UpdateUser(&updated); err != nil {
+		slog.ErrorContext(ctx, "error promoting user to admin", "target_user_id", user.ID, "error", err)
+		return user
+	}
+	slog.InfoContext(ctx, "audit: user promoted to admin from ADMIN_EMAILS", "target_user_id", user.ID, "email", user.Email)
+	return &updated
+}
+
+// issueTokens creates an access token and a refresh token for a session
+func (h *AuthHandler) issueTokens(user *models.User, sessionID string) (*AuthResponse, error) {
+	accessToken, err := auth.GenerateToken(user.ID, user.Email, sessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	refreshToken, hash, err := auth.GenerateRefreshToken()
+	if err != nil {
+		return nil, err
+	}
+
+	expiresAt := time.Now().Add(auth.RefreshTokenTTL)
+	if _, err := h.tokenStore.CreateRefreshToken(user.ID, sessionID, hash, expiresAt); err != nil {
+		return nil, err
+	}
+
+	return &AuthResponse{
+		Token:        accessToken,
+		RefreshToken: refreshToken,
+		ExpiresIn:    int(auth.AccessTokenTTL.Seconds()),
+		User:         user,
+	}, nil
+}
+
 // Helper functions
 
 func respondJSON(w http.ResponseWriter, data interface{}, statusCode int) {
 	w.Header().Set("Content-Type", "application/json; charset=utf-8")
 	w.WriteHeader(statusCode)
 	if err := json.NewEncoder(w).Encode(data); err != nil {
-		log.Printf("Error encoding JSON response: %v", err)
+		slog.Error("error encoding JSON response", "error", err)
 	}
 }
 
@@ -260,3 +535,11 @@ func GetTokenFromRequest(r *http.Request) string {
 	return ""
 }
 
+// ClientIP returns the IP address of the client that sent r
+func ClientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
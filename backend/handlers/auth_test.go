@@ -0,0 +1,156 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"latlongapi/backend/auth"
+	"latlongapi/backend/models"
+	"latlongapi/backend/store"
+)
+
+// startSession creates a user and logs them in
+func startSession(t *testing.T, h *AuthHandler, memStore *store.MemoryStore) *AuthResponse {
+	t.Helper()
+	user, err := memStore.CreateUser("carol@example.com", "hash")
+	if err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+	return startSessionFor(t, h, user)
+}
+
+// startSessionFor logs user in
+func startSessionFor(t *testing.T, h *AuthHandler, user *models.User) *AuthResponse {
+	t.Helper()
+	resp, err := h.newSession(context.Background(), user)
+	if err != nil {
+		t.Fatalf("newSession: %v", err)
+	}
+	return resp
+}
+
+// sessionRevoked reports whether the session of an access token was revoked
+func sessionRevoked(t *testing.T, memStore *store.MemoryStore, accessToken string) bool {
+	t.Helper()
+	claims, err := auth.ValidateToken(accessToken)
+	if err != nil {
+		t.Fatalf("ValidateToken: %v", err)
+	}
+	revoked, err := memStore.IsTokenRevoked(claims.SessionID)
+	if err != nil {
+		t.Fatalf("IsTokenRevoked: %v", err)
+	}
+	return revoked
+}
+
+func TestRefreshRotatesToken(t *testing.T) {
+	h, memStore, _ := newTestAuthHandler()
+	first := startSession(t, h, memStore)
+
+	var second AuthResponse
+	status := doJSON(t, h.Refresh, http.MethodPost, "/api/auth/refresh", RefreshRequest{RefreshToken: first.RefreshToken}, &second)
+	if status != http.StatusOK {
+		t.Fatalf("refresh: got status %d, want %d", status, http.StatusOK)
+	}
+	if second.RefreshToken == "" || second.RefreshToken == first.RefreshToken {
+		t.Fatalf("refresh: got refresh token %q, want a new one", second.RefreshToken)
+	}
+	if sessionRevoked(t, memStore, second.Token) {
+		t.Error("session was revoked by a normal refresh")
+	}
+
+	var third AuthResponse
+	status = doJSON(t, h.Refresh, http.MethodPost, "/api/auth/refresh", RefreshRequest{RefreshToken: second.RefreshToken}, &third)
+	if status != http.StatusOK {
+		t.Errorf("refresh with the new token: got status %d, want %d", status, http.StatusOK)
+	}
+}
+
+func TestRefreshReuseRevokesSession(t *testing.T) {
+	h, memStore, _ := newTestAuthHandler()
+	first := startSession(t, h, memStore)
+
+	var second AuthResponse
+	if status := doJSON(t, h.Refresh, http.MethodPost, "/api/auth/refresh", RefreshRequest{RefreshToken: first.RefreshToken}, &second); status != http.StatusOK {
+		t.Fatalf("refresh: got status %d, want %d", status, http.StatusOK)
+	}
+
+	// Presenting the exchanged token again means it was copied: the whole
+	// session is revoked, including the tokens issued by the rotation
+	status := doJSON(t, h.Refresh, http.MethodPost, "/api/auth/refresh", RefreshRequest{RefreshToken: first.RefreshToken}, nil)
+	if status != http.StatusUnauthorized {
+		t.Fatalf("reused refresh: got status %d, want %d", status, http.StatusUnauthorized)
+	}
+	if !sessionRevoked(t, memStore, first.Token) || !sessionRevoked(t, memStore, second.Token) {
+		t.Error("session was not revoked after refresh token reuse")
+	}
+
+	status = doJSON(t, h.Refresh, http.MethodPost, "/api/auth/refresh", RefreshRequest{RefreshToken: second.RefreshToken}, nil)
+	if status != http.StatusUnauthorized {
+		t.Errorf("refresh with the rotated token: got status %d, want %d", status, http.StatusUnauthorized)
+	}
+}
+
+func TestRefreshRejectsUnknownToken(t *testing.T) {
+	h, _, _ := newTestAuthHandler()
+
+	status := doJSON(t, h.Refresh, http.MethodPost, "/api/auth/refresh", RefreshRequest{RefreshToken: "not-a-token"}, nil)
+	if status != http.StatusUnauthorized {
+		t.Errorf("got status %d, want %d", status, http.StatusUnauthorized)
+	}
+}
+
+func TestLogoutRevokesSession(t *testing.T) {
+	h, memStore, _ := newTestAuthHandler()
+	resp := startSession(t, h, memStore)
+
+	if status := doJSON(t, h.Logout, http.MethodPost, "/api/auth/logout", RefreshRequest{RefreshToken: resp.RefreshToken}, nil); status != http.StatusOK {
+		t.Fatalf("logout: got status %d, want %d", status, http.StatusOK)
+	}
+	if !sessionRevoked(t, memStore, resp.Token) {
+		t.Error("session was not revoked by logout")
+	}
+
+	status := doJSON(t, h.Refresh, http.MethodPost, "/api/auth/refresh", RefreshRequest{RefreshToken: resp.RefreshToken}, nil)
+	if status != http.StatusUnauthorized {
+		t.Errorf("refresh after logout: got status %d, want %d", status, http.StatusUnauthorized)
+	}
+}
+
+func TestLoginRehashesOutdatedPassword(t *testing.T) {
+	h, memStore, _ := newTestAuthHandler()
+	user := createUser(t, memStore, "heidi@example.com", "correct horse")
+
+	cfg := auth.DefaultPasswordHashConfig()
+	cfg.Algorithm = auth.HashArgon2id
+	cfg.Argon2Memory = 64
+	if err := auth.SetPasswordHashing(cfg); err != nil {
+		t.Fatalf("SetPasswordHashing: %v", err)
+	}
+	t.Cleanup(func() { auth.SetPasswordHashing(auth.DefaultPasswordHashConfig()) })
+
+	// A wrong password leaves the hash alone
+	if status := doJSON(t, h.Login, http.MethodPost, "/api/auth/login", LoginRequest{Email: user.Email, Password: "wrong horse"}, nil); status != http.StatusUnauthorized {
+		t.Fatalf("wrong password: got status %d, want %d", status, http.StatusUnauthorized)
+	}
+	if stored, _ := memStore.GetUserByID(user.ID); stored.Password != user.Password {
+		t.Fatal("hash changed by a failed login")
+	}
+
+	if status := doJSON(t, h.Login, http.MethodPost, "/api/auth/login", LoginRequest{Email: user.Email, Password: "correct horse"}, nil); status != http.StatusOK {
+		t.Fatalf("login: got status %d, want %d", status, http.StatusOK)
+	}
+	stored, _ := memStore.GetUserByID(user.ID)
+	if auth.PasswordNeedsRehash(stored.Password) || !auth.CheckPasswordHash("correct horse", stored.Password) {
+		t.Errorf("got hash %q, want an argon2id hash of the password", stored.Password)
+	}
+
+	// The next login finds the hash current
+	if status := doJSON(t, h.Login, http.MethodPost, "/api/auth/login", LoginRequest{Email: user.Email, Password: "correct horse"}, nil); status != http.StatusOK {
+		t.Fatalf("second login: got status %d, want %d", status, http.StatusOK)
+	}
+	if again, _ := memStore.GetUserByID(user.ID); again.Password != stored.Password {
+		t.Error("current hash was rehashed")
+	}
+}
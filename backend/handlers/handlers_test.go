@@ -0,0 +1,89 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"testing"
+
+	"latlongapi/backend/auth"
+	"latlongapi/backend/mail"
+	"latlongapi/backend/ratelimit"
+	"latlongapi/backend/store"
+)
+
+func TestMain(m *testing.M) {
+	keyRing, err := auth.LoadKeyRing(auth.KeyRingConfig{Secret: "test-secret"})
+	if err != nil {
+		log.Fatalf("error loading key ring: %v", err)
+	}
+	auth.SetKeyRing(keyRing)
+
+	os.Exit(m.Run())
+}
+
+// testMailer records the messages sent instead of sending them
+type testMailer struct {
+	mu   sync.Mutex
+	sent []mail.Message
+	done chan struct{}
+}
+
+func newTestMailer() *testMailer {
+	return &testMailer{done: make(chan struct{}, 100)}
+}
+
+func (m *testMailer) Send(ctx context.Context, msg mail.Message) error {
+	m.mu.Lock()
+	m.sent = append(m.sent, msg)
+	m.mu.Unlock()
+	m.done <- struct{}{}
+	return nil
+}
+
+// wait returns the next message, which is sent in the background
+func (m *testMailer) wait(t *testing.T) mail.Message {
+	t.Helper()
+	<-m.done
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.sent[len(m.sent)-1]
+}
+
+// newTestAuthHandler creates an auth handler backed by a memory store
+func newTestAuthHandler() (*AuthHandler, *store.MemoryStore, *testMailer) {
+	memStore := store.NewMemoryStore()
+	mailer := newTestMailer()
+	h := NewAuthHandler(memStore, memStore, memStore, mailer, "http://localhost", ratelimit.NewLoginGuard(ratelimit.DefaultLoginGuardConfig()))
+	return h, memStore, mailer
+}
+
+// doJSON calls handler with body encoded as JSON and decodes the response
+// into out, if not nil, returning the status code
+func doJSON(t *testing.T, handler http.HandlerFunc, method, path string, body, out any) int {
+	t.Helper()
+
+	var buf bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&buf).Encode(body); err != nil {
+			t.Fatalf("encoding request: %v", err)
+		}
+	}
+	req := httptest.NewRequest(method, path, &buf)
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	handler(rec, req)
+
+	if out != nil && rec.Code < 300 {
+		if err := json.NewDecoder(rec.Body).Decode(out); err != nil {
+			t.Fatalf("%s %s: decoding response: %v", method, path, err)
+		}
+	}
+	return rec.Code
+}
@@ -0,0 +1,39 @@
+package handlers
+
+import (
+	"latlongapi/backend/auth"
+	"net/http"
+)
+
+// JWKSHandler publishes the public keys used to verify access tokens
+type JWKSHandler struct {
+	keys *auth.KeyRing
+}
+
+// NewJWKSHandler creates a new JWKS handler
+func NewJWKSHandler(keys *auth.KeyRing) *JWKSHandler {
+	return &JWKSHandler{
+		keys: keys,
+	}
+}
+
+// JWKS serves /.well-known/jwks.json. HS256 secrets are never published, so
+// the set is empty when only HMAC keys are configured.
+func (h *JWKSHandler) JWKS(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Methods", "GET, OPTIONS")
+
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// Let verifiers cache the set, but pick up rotated keys reasonably soon
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	respondJSON(w, h.keys.JWKS(), http.StatusOK)
+}
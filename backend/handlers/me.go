@@ -0,0 +1,323 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"latlongapi/backend/auth"
+	"latlongapi/backend/mail"
+	"latlongapi/backend/models"
+	"latlongapi/backend/store"
+	"log/slog"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// AccountHandler lets users manage and export their own account
+type AccountHandler struct {
+	auth          *AuthHandler // Owns the user and token stores and issues sessions
+	keyStore      models.APIKeyStore
+	usageStore    models.UsageStore
+	identityStore models.IdentityStore
+	orgStore      models.OrganizationStore
+}
+
+// NewAccountHandler creates a new account handler
+func NewAccountHandler(authHandler *AuthHandler, keyStore models.APIKeyStore, usageStore models.UsageStore, identityStore models.IdentityStore, orgStore models.OrganizationStore) *AccountHandler {
+	return &AccountHandler{
+		auth:          authHandler,
+		keyStore:      keyStore,
+		usageStore:    usageStore,
+		identityStore: identityStore,
+		orgStore:      orgStore,
+	}
+}
+
+// UpdateAccountRequest represents a change to the user's own account. Empty
+// fields are left unchanged.
+type UpdateAccountRequest struct {
+	CurrentPassword string `json:"current_password"`
+	Email           string `json:"email"`
+	NewPassword     string `json:"new_password"`
+}
+
+// DeleteAccountRequest represents a request to delete the user's own account
+type DeleteAccountRequest struct {
+	Password string `json:"password"`
+}
+
+// AccountExport is everything stored about a user
+type AccountExport struct {
+	ExportedAt    time.Time                  `json:"exported_at"`
+	User          *models.User               `json:"user"`
+	Identities    []*models.Identity         `json:"identities"`
+	Organizations []*models.UserOrganization `json:"organizations"`
+	APIKeys       []*models.APIKey           `json:"api_keys"`
+	Usage         []models.UsageRecord       `json:"usage"`
+}
+
+// Me handles /api/auth/me: GET returns the current user, PATCH changes their
+// email address or password and DELETE deletes the account. Changes require
+// the current password.
+func (h *AccountHandler) Me(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Methods", "GET, PATCH, DELETE, OPTIONS")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	// Get user from context (set by middleware)
+	user, ok := r.Context().Value("user").(*models.User)
+	if !ok {
+		respondError(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		respondJSON(w, user, http.StatusOK)
+	case http.MethodPatch:
+		h.update(w, r, user)
+	case http.MethodDelete:
+		h.delete(w, r, user)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// update changes the user's email address and/or password. A new address
+// must be verified again. A new password signs out every session, so the
+// response carries a fresh one instead of the user.
+func (h *AccountHandler) update(w http.ResponseWriter, r *http.Request, user *models.User) {
+	var req UpdateAccountRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	email := strings.TrimSpace(req.Email)
+	changeEmail := email != "" && email != user.Email
+	changePassword := req.NewPassword != ""
+
+	if !changeEmail && !changePassword {
+		respondError(w, "Nothing to change", http.StatusBadRequest)
+		return
+	}
+	if changeEmail && !strings.Contains(email, "@") {
+		respondError(w, "A valid email address is required", http.StatusBadRequest)
+		return
+	}
+	if changePassword && !h.auth.validatePassword(w, req.NewPassword) {
+		return
+	}
+
+	if !h.confirmPassword(w, r, user, req.CurrentPassword) {
+		return
+	}
+
+	oldEmail := user.Email
+	if changeEmail {
+		if err := h.auth.userStore.ChangeEmail(user.ID, email); err != nil {
+			if err == store.ErrUserExists {
+				respondError(w, "Email address already in use", http.StatusConflict)
+				return
+			}
+			slog.ErrorContext(r.Context(), "error changing email", "error", err)
+			respondError(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		slog.InfoContext(r.Context(), "audit: email address changed", "actor_id", user.ID, "old_email", oldEmail, "new_email", email)
+	}
+
+	if changePassword {
+		hashedPassword, err := auth.HashPassword(req.NewPassword)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "error hashing password", "error", err)
+			respondError(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+
+		if err := h.auth.userStore.UpdatePassword(user.ID, hashedPassword); err != nil {
+			slog.ErrorContext(r.Context(), "error updating password", "error", err)
+			respondError(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		slog.InfoContext(r.Context(), "audit: password changed", "actor_id", user.ID)
+
+		if err := h.auth.tokenStore.RevokeUserSessions(user.ID, time.Now().Add(auth.AccessTokenTTL)); err != nil {
+			slog.ErrorContext(r.Context(), "error revoking sessions", "error", err)
+		}
+	}
+
+	updated, err := h.auth.userStore.GetUserByID(user.ID)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "error getting user", "error", err)
+		respondError(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	// Tell the old address, in case the account was taken over
+	if changeEmail {
+		h.auth.sendMail(r.Context(), mail.Message{
+			To:      oldEmail,
+			Subject: "Your LatLongAPI email address was changed",
+			Body: fmt.Sprintf("The email address of your LatLongAPI account was changed to %s.\n\nIf you did not do this, contact support right away.\n",
+				updated.Email),
+		})
+		h.auth.sendVerificationEmail(r.Context(), updated)
+	}
+	if changePassword {
+		h.auth.sendMail(r.Context(), mail.Message{
+			To:      updated.Email,
+			Subject: "Your LatLongAPI password was changed",
+			Body:    "The password of your LatLongAPI account was changed and all sessions were signed out.\n\nIf you did not do this, reset your password right away.\n",
+		})
+
+		resp, err := h.auth.newSession(r.Context(), updated)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "error creating session", "error", err)
+			respondError(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		respondJSON(w, resp, http.StatusOK)
+		return
+	}
+
+	respondJSON(w, updated, http.StatusOK)
+}
+
+// delete deletes the user's account with everything that belongs to it
+func (h *AccountHandler) delete(w http.ResponseWriter, r *http.Request, user *models.User) {
+	var req DeleteAccountRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if !h.confirmPassword(w, r, user, req.Password) {
+		return
+	}
+
+	if org, err := soleOwnedOrg(h.orgStore, user.ID); err != nil {
+		slog.ErrorContext(r.Context(), "error listing organizations", "error", err)
+		respondError(w, "Internal server error", http.StatusInternalServerError)
+		return
+	} else if org != nil {
+		respondError(w, "You are the only owner of "+org.Name+"; make someone else an owner or delete the organization first", http.StatusConflict)
+		return
+	}
+
+	if err := h.auth.userStore.DeleteUser(user.ID); err != nil {
+		slog.ErrorContext(r.Context(), "error deleting user", "error", err)
+		respondError(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	slog.InfoContext(r.Context(), "audit: account deleted", "actor_id", user.ID, "email", user.Email)
+
+	h.auth.sendMail(r.Context(), mail.Message{
+		To:      user.Email,
+		Subject: "Your LatLongAPI account was deleted",
+		Body:    "Your LatLongAPI account, its API keys and usage history have been deleted.\n",
+	})
+
+	respondJSON(w, map[string]string{"message": "Account deleted"}, http.StatusOK)
+}
+
+// Export handles GET /api/auth/me/export, returning everything stored about
+// the user as a JSON download
+func (h *AccountHandler) Export(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Methods", "GET, OPTIONS")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	user, ok := r.Context().Value("user").(*models.User)
+	if !ok {
+		respondError(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	identities, err := h.identityStore.ListIdentities(user.ID)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "error listing identities", "error", err)
+		respondError(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	orgs, err := h.orgStore.ListOrganizations(user.ID)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "error listing organizations", "error", err)
+		respondError(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	keys, err := h.keyStore.ListAPIKeys(user.ID)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "error listing API keys", "error", err)
+		respondError(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	usage, err := h.usageStore.ListUsage(user.ID, time.Unix(0, 0))
+	if err != nil {
+		slog.ErrorContext(r.Context(), "error listing usage", "error", err)
+		respondError(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if usage == nil {
+		usage = []models.UsageRecord{}
+	}
+
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="latlongapi-account-%d.json"`, user.ID))
+	respondJSON(w, AccountExport{
+		ExportedAt:    time.Now(),
+		User:          user,
+		Identities:    identities,
+		Organizations: orgs,
+		APIKeys:       keys,
+		Usage:         usage,
+	}, http.StatusOK)
+}
+
+// confirmPassword checks the user's current password before a sensitive
+// change, writing an error response if it is wrong. Failures count towards
+// the login throttling limits, so a stolen session cannot be used to guess
+// the password.
+func (h *AccountHandler) confirmPassword(w http.ResponseWriter, r *http.Request, user *models.User, password string) bool {
+	if user.Password == "" {
+		respondError(w, "Your account has no password; set one with a password reset first", http.StatusBadRequest)
+		return false
+	}
+	if password == "" {
+		respondError(w, "Current password is required", http.StatusBadRequest)
+		return false
+	}
+
+	ip := ClientIP(r)
+	if wait := h.auth.loginGuard.Check(user.Email, ip, time.Now()); wait > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+		respondError(w, "Too many failed attempts, try again later", http.StatusTooManyRequests)
+		return false
+	}
+
+	if !auth.CheckPasswordHash(password, user.Password) {
+		h.auth.recordLoginFailure(r.Context(), user.Email, ip)
+		respondError(w, "Invalid password", http.StatusUnauthorized)
+		return false
+	}
+	return true
+}
@@ -0,0 +1,380 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"latlongapi/backend/auth"
+	"latlongapi/backend/models"
+	"latlongapi/backend/store"
+	"log/slog"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// MFAChallengeResponse is returned by Login when the account requires a
+// second factor. The MFA token is exchanged for a session with a valid code.
+type MFAChallengeResponse struct {
+	MFARequired bool   `json:"mfa_required"`
+	MFAToken    string `json:"mfa_token"`
+	ExpiresIn   int    `json:"expires_in"` // MFA token lifetime in seconds
+}
+
+// MFAVerifyRequest represents a second-factor login step
+type MFAVerifyRequest struct {
+	MFAToken string `json:"mfa_token"`
+	Code     string `json:"code"` // TOTP code or recovery code
+}
+
+// TOTPEnrollResponse carries a new TOTP secret to add to an authenticator app
+type TOTPEnrollResponse struct {
+	Secret     string `json:"secret"`
+	OTPAuthURL string `json:"otpauth_url"` // Usually shown as a QR code
+}
+
+// TOTPCodeRequest represents a request confirming TOTP enrollment
+type TOTPCodeRequest struct {
+	Code string `json:"code"`
+}
+
+// TOTPDisableRequest represents a request to turn off TOTP
+type TOTPDisableRequest struct {
+	Password string `json:"password"`
+	Code     string `json:"code"` // TOTP code or recovery code
+}
+
+// RecoveryCodesResponse carries recovery codes. They are only shown once.
+type RecoveryCodesResponse struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+// VerifyMFA completes a login that requires a second factor, exchanging the
+// MFA token from Login and a TOTP or recovery code for a session
+func (h *AuthHandler) VerifyMFA(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req MFAVerifyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if req.MFAToken == "" || req.Code == "" {
+		respondError(w, "MFA token and code are required", http.StatusBadRequest)
+		return
+	}
+
+	claims, err := auth.ValidateActionToken(req.MFAToken, auth.PurposeMFA)
+	if err != nil {
+		respondError(w, "Invalid or expired MFA token", http.StatusUnauthorized)
+		return
+	}
+
+	userID, err := claims.UserID()
+	if err != nil {
+		respondError(w, "Invalid or expired MFA token", http.StatusUnauthorized)
+		return
+	}
+
+	// The MFA token is single use, and spent by any attempt. Consuming it
+	// before the code is checked means concurrent requests with the same
+	// token cannot each spend a recovery code or TOTP step.
+	consumed, err := h.tokenStore.ConsumeToken(claims.ID, claims.ExpiresAt.Time)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "error consuming MFA token", "error", err)
+		respondError(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if !consumed {
+		respondError(w, "Invalid or expired MFA token", http.StatusUnauthorized)
+		return
+	}
+
+	user, err := h.userStore.GetUserByID(userID)
+	if err != nil {
+		if err == store.ErrUserNotFound {
+			respondError(w, "Invalid or expired MFA token", http.StatusUnauthorized)
+			return
+		}
+		slog.ErrorContext(r.Context(), "error getting user", "error", err)
+		respondError(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	if !user.TOTPEnabled() {
+		respondError(w, "Invalid or expired MFA token", http.StatusUnauthorized)
+		return
+	}
+
+	if user.Suspended() {
+		respondError(w, "Account suspended", http.StatusForbidden)
+		return
+	}
+
+	// Code guesses count against the same limits as password guesses
+	ip := ClientIP(r)
+	if wait := h.loginGuard.Check(user.Email, ip, time.Now()); wait > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+		respondError(w, "Too many failed login attempts, try again later", http.StatusTooManyRequests)
+		return
+	}
+
+	ok, err := h.checkSecondFactor(r.Context(), user, req.Code)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "error checking second factor", "error", err)
+		respondError(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if !ok {
+		h.recordLoginFailure(r.Context(), user.Email, ip)
+		respondError(w, "Invalid code", http.StatusUnauthorized)
+		return
+	}
+
+	h.loginGuard.Succeed(user.Email)
+
+	resp, err := h.newSession(r.Context(), user)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "error creating session", "error", err)
+		respondError(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	respondJSON(w, resp, http.StatusOK)
+}
+
+// EnrollTOTP starts TOTP enrollment for the current user with a new secret.
+// Logins do not require codes until the enrollment is confirmed.
+func (h *AuthHandler) EnrollTOTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// Get user from context (set by middleware)
+	user, ok := r.Context().Value("user").(*models.User)
+	if !ok {
+		respondError(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	if user.TOTPEnabled() {
+		respondError(w, "Two-factor authentication is already enabled", http.StatusConflict)
+		return
+	}
+
+	secret, err := auth.GenerateTOTPSecret()
+	if err != nil {
+		slog.ErrorContext(r.Context(), "error generating TOTP secret", "error", err)
+		respondError(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	if err := h.mfaStore.SetTOTPSecret(user.ID, secret); err != nil {
+		slog.ErrorContext(r.Context(), "error saving TOTP secret", "error", err)
+		respondError(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	respondJSON(w, TOTPEnrollResponse{
+		Secret:     secret,
+		OTPAuthURL: auth.TOTPURI(secret, user.Email),
+	}, http.StatusOK)
+}
+
+// ConfirmTOTP turns on TOTP once the user proves their authenticator app
+// works, and returns a fresh set of recovery codes
+func (h *AuthHandler) ConfirmTOTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// Get user from context (set by middleware)
+	user, ok := r.Context().Value("user").(*models.User)
+	if !ok {
+		respondError(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req TOTPCodeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Code == "" {
+		respondError(w, "Code is required", http.StatusBadRequest)
+		return
+	}
+
+	if user.TOTPEnabled() {
+		respondError(w, "Two-factor authentication is already enabled", http.StatusConflict)
+		return
+	}
+	if user.TOTPSecret == "" {
+		respondError(w, "Start enrollment before confirming", http.StatusBadRequest)
+		return
+	}
+
+	step, ok := auth.ValidateTOTP(user.TOTPSecret, normalizeCode(req.Code), time.Now())
+	if !ok {
+		respondError(w, "Invalid code", http.StatusBadRequest)
+		return
+	}
+
+	codes, hashes, err := auth.GenerateRecoveryCodes()
+	if err != nil {
+		slog.ErrorContext(r.Context(), "error generating recovery codes", "error", err)
+		respondError(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	if err := h.mfaStore.EnableTOTP(user.ID, step, hashes); err != nil {
+		slog.ErrorContext(r.Context(), "error enabling TOTP", "error", err)
+		respondError(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	slog.InfoContext(r.Context(), "audit: two-factor authentication enabled", "actor_id", user.ID)
+
+	respondJSON(w, RecoveryCodesResponse{RecoveryCodes: codes}, http.StatusOK)
+}
+
+// DisableTOTP turns off TOTP. It requires the password and a current code,
+// so a stolen session alone cannot remove the second factor.
+func (h *AuthHandler) DisableTOTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// Get user from context (set by middleware)
+	user, ok := r.Context().Value("user").(*models.User)
+	if !ok {
+		respondError(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req TOTPDisableRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if req.Password == "" || req.Code == "" {
+		respondError(w, "Password and code are required", http.StatusBadRequest)
+		return
+	}
+
+	if !user.TOTPEnabled() {
+		respondError(w, "Two-factor authentication is not enabled", http.StatusBadRequest)
+		return
+	}
+
+	// Failures count towards the login throttling limits, so a stolen
+	// session cannot be used to guess the password
+	ip := ClientIP(r)
+	if wait := h.loginGuard.Check(user.Email, ip, time.Now()); wait > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+		respondError(w, "Too many failed attempts, try again later", http.StatusTooManyRequests)
+		return
+	}
+
+	if !auth.CheckPasswordHash(req.Password, user.Password) {
+		h.recordLoginFailure(r.Context(), user.Email, ip)
+		respondError(w, "Invalid password or code", http.StatusUnauthorized)
+		return
+	}
+
+	ok, err := h.checkSecondFactor(r.Context(), user, req.Code)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "error checking second factor", "error", err)
+		respondError(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if !ok {
+		h.recordLoginFailure(r.Context(), user.Email, ip)
+		respondError(w, "Invalid password or code", http.StatusUnauthorized)
+		return
+	}
+
+	if err := h.mfaStore.DisableTOTP(user.ID); err != nil {
+		slog.ErrorContext(r.Context(), "error disabling TOTP", "error", err)
+		respondError(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	slog.InfoContext(r.Context(), "audit: two-factor authentication disabled", "actor_id", user.ID)
+
+	respondJSON(w, map[string]string{"message": "Two-factor authentication disabled"}, http.StatusOK)
+}
+
+// checkSecondFactor accepts a TOTP code not used before, or an unused
+// recovery code, which is then spent
+func (h *AuthHandler) checkSecondFactor(ctx context.Context, user *models.User, code string) (bool, error) {
+	code = normalizeCode(code)
+
+	if step, ok := auth.ValidateTOTP(user.TOTPSecret, code, time.Now()); ok {
+		return h.mfaStore.UseTOTPStep(user.ID, step)
+	}
+
+	used, err := h.mfaStore.UseRecoveryCode(user.ID, auth.HashRecoveryCode(code))
+	if used {
+		slog.InfoContext(ctx, "audit: recovery code used", "actor_id", user.ID)
+	}
+	return used, err
+}
+
+// newMFAChallenge issues the token a user with TOTP exchanges, together with
+// a code, for a session
+func (h *AuthHandler) newMFAChallenge(user *models.User) (*MFAChallengeResponse, error) {
+	token, err := auth.GenerateActionToken(auth.PurposeMFA, user.ID, user.Email, "", auth.MFATokenTTL)
+	if err != nil {
+		return nil, err
+	}
+	return &MFAChallengeResponse{
+		MFARequired: true,
+		MFAToken:    token,
+		ExpiresIn:   int(auth.MFATokenTTL.Seconds()),
+	}, nil
+}
+
+// normalizeCode strips the spaces users often type into codes
+func normalizeCode(code string) string {
+	return strings.ReplaceAll(strings.TrimSpace(code), " ", "")
+}
@@ -0,0 +1,221 @@
+package handlers
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"latlongapi/backend/auth"
+	"latlongapi/backend/models"
+	"latlongapi/backend/store"
+)
+
+// totpCode computes the current code for secret, as an authenticator app would
+func totpCode(t *testing.T, secret string) string {
+	t.Helper()
+	key, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(secret)
+	if err != nil {
+		t.Fatalf("decoding secret: %v", err)
+	}
+
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], uint64(time.Now().Unix()/30))
+	mac := hmac.New(sha1.New, key)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+	offset := sum[len(sum)-1] & 0x0f
+	return fmt.Sprintf("%06d", (binary.BigEndian.Uint32(sum[offset:])&0x7fffffff)%1000000)
+}
+
+// enableTOTP turns on TOTP for user, returning the secret and recovery codes
+func enableTOTP(t *testing.T, memStore *store.MemoryStore, user *models.User) (string, []string) {
+	t.Helper()
+	secret, err := auth.GenerateTOTPSecret()
+	if err != nil {
+		t.Fatalf("GenerateTOTPSecret: %v", err)
+	}
+	codes, hashes, err := auth.GenerateRecoveryCodes()
+	if err != nil {
+		t.Fatalf("GenerateRecoveryCodes: %v", err)
+	}
+	if err := memStore.SetTOTPSecret(user.ID, secret); err != nil {
+		t.Fatalf("SetTOTPSecret: %v", err)
+	}
+	if err := memStore.EnableTOTP(user.ID, 0, hashes); err != nil {
+		t.Fatalf("EnableTOTP: %v", err)
+	}
+	return secret, codes
+}
+
+// mfaLogin logs in with a password and returns the MFA token
+func mfaLogin(t *testing.T, h *AuthHandler, email, password string) string {
+	t.Helper()
+	var challenge MFAChallengeResponse
+	if status := doJSON(t, h.Login, http.MethodPost, "/api/auth/login", LoginRequest{Email: email, Password: password}, &challenge); status != http.StatusOK {
+		t.Fatalf("login: got status %d, want %d", status, http.StatusOK)
+	}
+	if !challenge.MFARequired || challenge.MFAToken == "" {
+		t.Fatalf("login: got %+v, want an MFA challenge", challenge)
+	}
+	return challenge.MFAToken
+}
+
+func TestLoginWithTOTP(t *testing.T) {
+	h, memStore, _ := newTestAuthHandler()
+	user := createUser(t, memStore, "grace@example.com", "password")
+	secret, _ := enableTOTP(t, memStore, user)
+
+	// A wrong code spends the MFA token
+	mfaToken := mfaLogin(t, h, user.Email, "password")
+	if status := doJSON(t, h.VerifyMFA, http.MethodPost, "/api/auth/mfa/verify", MFAVerifyRequest{MFAToken: mfaToken, Code: "abcdef"}, nil); status != http.StatusUnauthorized {
+		t.Errorf("wrong code: got status %d, want %d", status, http.StatusUnauthorized)
+	}
+	code := totpCode(t, secret)
+	if status := doJSON(t, h.VerifyMFA, http.MethodPost, "/api/auth/mfa/verify", MFAVerifyRequest{MFAToken: mfaToken, Code: code}, nil); status != http.StatusUnauthorized {
+		t.Errorf("retry with the same MFA token: got status %d, want %d", status, http.StatusUnauthorized)
+	}
+
+	mfaToken = mfaLogin(t, h, user.Email, "password")
+	var resp AuthResponse
+	if status := doJSON(t, h.VerifyMFA, http.MethodPost, "/api/auth/mfa/verify", MFAVerifyRequest{MFAToken: mfaToken, Code: code}, &resp); status != http.StatusOK {
+		t.Fatalf("verify: got status %d, want %d", status, http.StatusOK)
+	}
+	if resp.Token == "" || resp.RefreshToken == "" {
+		t.Fatalf("verify: got %+v, want a session", resp)
+	}
+
+	// Neither the MFA token nor the code can be used again
+	if status := doJSON(t, h.VerifyMFA, http.MethodPost, "/api/auth/mfa/verify", MFAVerifyRequest{MFAToken: mfaToken, Code: code}, nil); status != http.StatusUnauthorized {
+		t.Errorf("reused MFA token: got status %d, want %d", status, http.StatusUnauthorized)
+	}
+	mfaToken = mfaLogin(t, h, user.Email, "password")
+	if status := doJSON(t, h.VerifyMFA, http.MethodPost, "/api/auth/mfa/verify", MFAVerifyRequest{MFAToken: mfaToken, Code: code}, nil); status != http.StatusUnauthorized {
+		t.Errorf("replayed code: got status %d, want %d", status, http.StatusUnauthorized)
+	}
+}
+
+func TestLoginWithRecoveryCode(t *testing.T) {
+	h, memStore, _ := newTestAuthHandler()
+	user := createUser(t, memStore, "grace@example.com", "password")
+	_, codes := enableTOTP(t, memStore, user)
+
+	mfaToken := mfaLogin(t, h, user.Email, "password")
+	if status := doJSON(t, h.VerifyMFA, http.MethodPost, "/api/auth/mfa/verify", MFAVerifyRequest{MFAToken: mfaToken, Code: codes[0]}, nil); status != http.StatusOK {
+		t.Fatalf("verify: got status %d, want %d", status, http.StatusOK)
+	}
+
+	// Recovery codes are single use
+	mfaToken = mfaLogin(t, h, user.Email, "password")
+	if status := doJSON(t, h.VerifyMFA, http.MethodPost, "/api/auth/mfa/verify", MFAVerifyRequest{MFAToken: mfaToken, Code: codes[0]}, nil); status != http.StatusUnauthorized {
+		t.Errorf("reused recovery code: got status %d, want %d", status, http.StatusUnauthorized)
+	}
+	mfaToken = mfaLogin(t, h, user.Email, "password")
+	if status := doJSON(t, h.VerifyMFA, http.MethodPost, "/api/auth/mfa/verify", MFAVerifyRequest{MFAToken: mfaToken, Code: codes[1]}, nil); status != http.StatusOK {
+		t.Errorf("another recovery code: got status %d, want %d", status, http.StatusOK)
+	}
+}
+
+// slowRecoveryStore holds each recovery code check until a second one
+// arrives, or a short while has passed, so concurrent requests overlap
+type slowRecoveryStore struct {
+	*store.MemoryStore
+	arrived chan struct{}
+}
+
+func (s *slowRecoveryStore) UseRecoveryCode(userID int, hash string) (bool, error) {
+	select {
+	case s.arrived <- struct{}{}:
+	case <-s.arrived:
+	case <-time.After(200 * time.Millisecond):
+	}
+	return s.MemoryStore.UseRecoveryCode(userID, hash)
+}
+
+func TestVerifyMFATokenSpendsOneRecoveryCode(t *testing.T) {
+	h, memStore, _ := newTestAuthHandler()
+	h.mfaStore = &slowRecoveryStore{MemoryStore: memStore, arrived: make(chan struct{})}
+	user := createUser(t, memStore, "grace@example.com", "password")
+	_, codes := enableTOTP(t, memStore, user)
+	mfaToken := mfaLogin(t, h, user.Email, "password")
+
+	// Two recovery codes sent at once with the same MFA token sign in once
+	// and spend only one code
+	statuses := make(chan int, 2)
+	for _, code := range codes[:2] {
+		go func() {
+			statuses <- doJSON(t, h.VerifyMFA, http.MethodPost, "/api/auth/mfa/verify", MFAVerifyRequest{MFAToken: mfaToken, Code: code}, nil)
+		}()
+	}
+	signedIn := 0
+	for range 2 {
+		if <-statuses == http.StatusOK {
+			signedIn++
+		}
+	}
+	if signedIn != 1 {
+		t.Errorf("got %d sessions, want 1", signedIn)
+	}
+
+	unused := 0
+	for _, code := range codes[:2] {
+		if ok, _ := memStore.UseRecoveryCode(user.ID, auth.HashRecoveryCode(code)); ok {
+			unused++
+		}
+	}
+	if unused != 1 {
+		t.Errorf("got %d unused recovery codes, want 1", unused)
+	}
+}
+
+func TestVerifyMFARejectsOtherTokens(t *testing.T) {
+	h, memStore, _ := newTestAuthHandler()
+	user := createUser(t, memStore, "grace@example.com", "password")
+	secret, _ := enableTOTP(t, memStore, user)
+
+	// A password reset token must not stand in for the MFA token
+	token := actionToken(t, user, auth.PurposeResetPassword)
+	if status := doJSON(t, h.VerifyMFA, http.MethodPost, "/api/auth/mfa/verify", MFAVerifyRequest{MFAToken: token, Code: totpCode(t, secret)}, nil); status != http.StatusUnauthorized {
+		t.Errorf("got status %d, want %d", status, http.StatusUnauthorized)
+	}
+}
+
+// asUser runs handler with user authenticated, as the auth middleware would
+func asUser(user *models.User, handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		handler(w, r.WithContext(context.WithValue(r.Context(), "user", user)))
+	}
+}
+
+func TestDisableTOTPIsThrottled(t *testing.T) {
+	h, memStore, _ := newTestAuthHandler()
+	user := createUser(t, memStore, "grace@example.com", "password")
+	secret, codes := enableTOTP(t, memStore, user)
+	user, _ = memStore.GetUserByID(user.ID)
+	disable := asUser(user, h.DisableTOTP)
+
+	// Wrong passwords and wrong codes both count as failures
+	for _, req := range []TOTPDisableRequest{
+		{Password: "wrong", Code: codes[0]},
+		{Password: "wrong", Code: codes[0]},
+		{Password: "password", Code: "abcdef"},
+	} {
+		if status := doJSON(t, disable, http.MethodPost, "/api/auth/mfa/totp/disable", req, nil); status != http.StatusUnauthorized {
+			t.Fatalf("%+v: got status %d, want %d", req, status, http.StatusUnauthorized)
+		}
+	}
+
+	// Past the free attempts, even the right password and code must wait
+	req := TOTPDisableRequest{Password: "password", Code: totpCode(t, secret)}
+	if status := doJSON(t, disable, http.MethodPost, "/api/auth/mfa/totp/disable", req, nil); status != http.StatusTooManyRequests {
+		t.Errorf("got status %d, want %d", status, http.StatusTooManyRequests)
+	}
+	if user, _ := memStore.GetUserByID(user.ID); !user.TOTPEnabled() {
+		t.Error("TOTP disabled while throttled")
+	}
+}
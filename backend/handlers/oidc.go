@@ -0,0 +1,304 @@
+package handlers
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"latlongapi/backend/models"
+	"latlongapi/backend/oidc"
+	"latlongapi/backend/store"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	oidcFlowCookie  = "oidc_flow"
+	oidcCookiePath  = "/api/auth/oidc/"
+	oidcFlowTimeout = 10 * time.Minute
+)
+
+var (
+	errOIDCNoEmail         = errors.New("the identity provider did not share an email address")
+	errOIDCUnverifiedEmail = errors.New("an account with this email already exists; sign in with your password first")
+)
+
+// OIDCHandler signs users in through external OpenID Connect providers
+type OIDCHandler struct {
+	auth          *AuthHandler
+	identityStore models.IdentityStore
+	providers     map[string]*oidc.Provider
+	names         []string // provider names in configuration order
+}
+
+// NewOIDCHandler creates a new OIDC handler. Sessions are issued by authHandler.
+func NewOIDCHandler(authHandler *AuthHandler, identityStore models.IdentityStore, providers []*oidc.Provider) *OIDCHandler {
+	h := &OIDCHandler{
+		auth:          authHandler,
+		identityStore: identityStore,
+		providers:     make(map[string]*oidc.Provider),
+	}
+	for _, p := range providers {
+		h.providers[p.Name()] = p
+		h.names = append(h.names, p.Name())
+	}
+	return h
+}
+
+// ProviderInfo describes a configured provider for the login page
+type ProviderInfo struct {
+	Name        string `json:"name"`
+	DisplayName string `json:"display_name"`
+	LoginURL    string `json:"login_url"`
+}
+
+// oidcFlow is the state of one sign-in, kept in a short-lived cookie in the
+// user's browser. It never leaves that browser, so it needs no signature: the
+// state check ties the callback to the browser that started the flow.
+type oidcFlow struct {
+	Provider string `json:"provider"`
+	State    string `json:"state"`
+	Nonce    string `json:"nonce"`
+	Verifier string `json:"verifier"` // PKCE code verifier
+}
+
+// Providers lists the configured providers
+func (h *OIDCHandler) Providers(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Methods", "GET, OPTIONS")
+
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	providers := []ProviderInfo{}
+	for _, name := range h.names {
+		providers = append(providers, ProviderInfo{
+			Name:        name,
+			DisplayName: h.providers[name].DisplayName(),
+			LoginURL:    oidcCookiePath + url.PathEscape(name) + "/login",
+		})
+	}
+	respondJSON(w, providers, http.StatusOK)
+}
+
+// Route handles /api/auth/oidc/{provider}/login and /api/auth/oidc/{provider}/callback
+func (h *OIDCHandler) Route(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	name, action, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, oidcCookiePath), "/")
+	provider, ok := h.providers[name]
+	if !ok {
+		respondError(w, "Unknown identity provider", http.StatusNotFound)
+		return
+	}
+
+	switch action {
+	case "login":
+		h.login(w, r, provider)
+	case "callback":
+		h.callback(w, r, provider)
+	default:
+		respondError(w, "Not found", http.StatusNotFound)
+	}
+}
+
+// login starts the authorization code flow and redirects to the provider
+func (h *OIDCHandler) login(w http.ResponseWriter, r *http.Request, provider *oidc.Provider) {
+	flow := oidcFlow{Provider: provider.Name()}
+	for _, v := range []*string{&flow.State, &flow.Nonce, &flow.Verifier} {
+		s, err := oidc.RandomString()
+		if err != nil {
+			slog.ErrorContext(r.Context(), "error generating OIDC state", "error", err)
+			respondError(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		*v = s
+	}
+
+	authURL, err := provider.AuthCodeURL(r.Context(), flow.State, flow.Nonce, flow.Verifier)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "error starting sign-in", "provider", provider.Name(), "error", err)
+		redirectToLogin(w, r, url.Values{"error": {"The identity provider is unavailable, try again later"}})
+		return
+	}
+
+	value, _ := json.Marshal(flow)
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcFlowCookie,
+		Value:    base64.RawURLEncoding.EncodeToString(value),
+		Path:     oidcCookiePath,
+		MaxAge:   int(oidcFlowTimeout.Seconds()),
+		HttpOnly: true,
+		Secure:   strings.HasPrefix(h.auth.baseURL, "https://"),
+		SameSite: http.SameSiteLaxMode, // Sent on the provider's top-level redirect back
+	})
+	http.Redirect(w, r, authURL, http.StatusFound)
+}
+
+// callback completes the flow: it checks the state, redeems the code, finds
+// or creates the user, and hands the session to the login page
+func (h *OIDCHandler) callback(w http.ResponseWriter, r *http.Request, provider *oidc.Provider) {
+	flow, ok := readOIDCFlow(r)
+	// The flow cookie is single use
+	http.SetCookie(w, &http.Cookie{Name: oidcFlowCookie, Path: oidcCookiePath, MaxAge: -1})
+
+	query := r.URL.Query()
+	if !ok || flow.Provider != provider.Name() ||
+		subtle.ConstantTimeCompare([]byte(flow.State), []byte(query.Get("state"))) != 1 {
+		redirectToLogin(w, r, url.Values{"error": {"Sign-in session expired, try again"}})
+		return
+	}
+
+	if errCode := query.Get("error"); errCode != "" {
+		message := query.Get("error_description")
+		if message == "" {
+			message = "Sign-in failed: " + errCode
+		}
+		redirectToLogin(w, r, url.Values{"error": {message}})
+		return
+	}
+
+	claims, err := provider.Exchange(r.Context(), query.Get("code"), flow.Verifier, flow.Nonce)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "error completing sign-in", "provider", provider.Name(), "error", err)
+		redirectToLogin(w, r, url.Values{"error": {"Sign-in failed, try again"}})
+		return
+	}
+
+	user, err := h.userFor(r.Context(), provider.Name(), claims)
+	if err != nil {
+		switch err {
+		case errOIDCNoEmail:
+			redirectToLogin(w, r, url.Values{"error": {"The identity provider did not share an email address"}})
+			return
+		case errOIDCUnverifiedEmail:
+			redirectToLogin(w, r, url.Values{"error": {"An account with this email already exists; log in with your password first"}})
+			return
+		}
+		slog.ErrorContext(r.Context(), "error linking identity", "provider", provider.Name(), "error", err)
+		redirectToLogin(w, r, url.Values{"error": {"Sign-in failed, try again"}})
+		return
+	}
+
+	if user.Suspended() {
+		redirectToLogin(w, r, url.Values{"error": {"Account suspended"}})
+		return
+	}
+
+	// Accounts with two-factor authentication still need a code
+	if user.TOTPEnabled() {
+		challenge, err := h.auth.newMFAChallenge(user)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "error creating MFA challenge", "error", err)
+			redirectToLogin(w, r, url.Values{"error": {"Sign-in failed, try again"}})
+			return
+		}
+		redirectToLogin(w, r, url.Values{"mfa_token": {challenge.MFAToken}})
+		return
+	}
+
+	resp, err := h.auth.newSession(r.Context(), user)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "error creating session", "error", err)
+		redirectToLogin(w, r, url.Values{"error": {"Sign-in failed, try again"}})
+		return
+	}
+
+	redirectToLogin(w, r, url.Values{
+		"token":         {resp.Token},
+		"refresh_token": {resp.RefreshToken},
+		"expires_in":    {strconv.Itoa(resp.ExpiresIn)},
+	})
+}
+
+// userFor returns the user linked to an external identity. On first sign-in
+// the identity is linked to the account with the same email if the provider
+// verified that email, or to a new passwordless account otherwise.
+func (h *OIDCHandler) userFor(ctx context.Context, provider string, claims *oidc.Claims) (*models.User, error) {
+	userStore := h.auth.userStore
+
+	identity, err := h.identityStore.GetIdentity(provider, claims.Subject)
+	if err == nil {
+		return userStore.GetUserByID(identity.UserID)
+	}
+	if err != store.ErrIdentityNotFound {
+		return nil, err
+	}
+
+	if claims.Email == "" {
+		return nil, errOIDCNoEmail
+	}
+
+	user, err := userStore.GetUserByEmail(claims.Email)
+	switch {
+	case err == nil:
+		// Linking on an unverified email would let anyone who can set that
+		// address at the provider take over the account
+		if !claims.EmailVerified {
+			return nil, errOIDCUnverifiedEmail
+		}
+	case err == store.ErrUserNotFound:
+		// Created without a password; one can be set with a password reset
+		user, err = userStore.CreateUser(claims.Email, "")
+		if err != nil {
+			return nil, err
+		}
+		slog.InfoContext(ctx, "audit: user created from identity", "target_user_id", user.ID, "provider", provider, "subject", claims.Subject)
+	default:
+		return nil, err
+	}
+
+	if claims.EmailVerified {
+		if err := userStore.MarkEmailVerified(user.ID); err != nil {
+			return nil, err
+		}
+	}
+
+	if _, err := h.identityStore.CreateIdentity(user.ID, provider, claims.Subject, claims.Email); err != nil {
+		// A concurrent sign-in linked it first
+		if err == store.ErrIdentityExists {
+			return h.userFor(ctx, provider, claims)
+		}
+		return nil, err
+	}
+	slog.InfoContext(ctx, "audit: identity linked", "target_user_id", user.ID, "provider", provider, "subject", claims.Subject)
+
+	return userStore.GetUserByID(user.ID)
+}
+
+// readOIDCFlow decodes the flow cookie
+func readOIDCFlow(r *http.Request) (oidcFlow, bool) {
+	var flow oidcFlow
+	cookie, err := r.Cookie(oidcFlowCookie)
+	if err != nil {
+		return flow, false
+	}
+	data, err := base64.RawURLEncoding.DecodeString(cookie.Value)
+	if err != nil || json.Unmarshal(data, &flow) != nil || flow.State == "" {
+		return flow, false
+	}
+	return flow, true
+}
+
+// redirectToLogin sends the browser to the login page with params in the URL
+// fragment, which browsers never send to servers
+func redirectToLogin(w http.ResponseWriter, r *http.Request, params url.Values) {
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Referrer-Policy", "no-referrer")
+	http.Redirect(w, r, "/login#"+params.Encode(), http.StatusFound)
+}
@@ -0,0 +1,255 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"latlongapi/backend/oidc"
+	"latlongapi/backend/oidc/oidctest"
+	"latlongapi/backend/store"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+var bob = oidctest.Identity{Subject: "bob-1", Email: "bob@example.com", EmailVerified: true}
+
+// oidcTest is an OIDC handler signing in through a mock provider
+type oidcTest struct {
+	handler *OIDCHandler
+	store   *store.MemoryStore
+	srv     *oidctest.Server
+}
+
+func newOIDCTest(t *testing.T) *oidcTest {
+	t.Helper()
+	srv := oidctest.NewServer("latlongapi", "secret")
+	t.Cleanup(srv.Close)
+
+	authHandler, memStore, _ := newTestAuthHandler()
+	provider := oidc.NewProvider(oidc.Config{
+		Name:         "test",
+		Issuer:       srv.URL,
+		ClientID:     "latlongapi",
+		ClientSecret: "secret",
+		RedirectURL:  "http://localhost/api/auth/oidc/test/callback",
+	})
+	return &oidcTest{
+		handler: NewOIDCHandler(authHandler, memStore, []*oidc.Provider{provider}),
+		store:   memStore,
+		srv:     srv,
+	}
+}
+
+// login starts a sign-in and returns the provider URL the browser is sent
+// to and the flow cookie
+func (o *oidcTest) login(t *testing.T) (string, *http.Cookie) {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	o.handler.Route(rec, httptest.NewRequest(http.MethodGet, "/api/auth/oidc/test/login", nil))
+
+	if rec.Code != http.StatusFound {
+		t.Fatalf("login: got status %d, want %d", rec.Code, http.StatusFound)
+	}
+	cookies := rec.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != oidcFlowCookie {
+		t.Fatalf("login: got cookies %v, want the flow cookie", cookies)
+	}
+	return rec.Header().Get("Location"), cookies[0]
+}
+
+// callback returns to the handler from the provider with query, presenting
+// cookie, and returns the parameters handed to the login page
+func (o *oidcTest) callback(t *testing.T, query url.Values, cookie *http.Cookie) url.Values {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodGet, "/api/auth/oidc/test/callback?"+query.Encode(), nil)
+	if cookie != nil {
+		req.AddCookie(cookie)
+	}
+	rec := httptest.NewRecorder()
+	o.handler.Route(rec, req)
+
+	location := rec.Header().Get("Location")
+	if rec.Code != http.StatusFound || !strings.HasPrefix(location, "/login#") {
+		t.Fatalf("callback: got status %d to %q, want a redirect to the login page", rec.Code, location)
+	}
+	params, err := url.ParseQuery(strings.TrimPrefix(location, "/login#"))
+	if err != nil {
+		t.Fatalf("callback: parsing %q: %v", location, err)
+	}
+	return params
+}
+
+// signIn runs a whole sign-in for id, with edit applied to the ID token claims
+func (o *oidcTest) signIn(t *testing.T, id oidctest.Identity, edit func(jwt.MapClaims)) url.Values {
+	t.Helper()
+	authURL, cookie := o.login(t)
+	code, err := o.srv.Authorize(authURL, id, edit)
+	if err != nil {
+		t.Fatalf("Authorize: %v", err)
+	}
+	return o.callback(t, url.Values{"code": {code}, "state": {stateOf(t, authURL)}}, cookie)
+}
+
+// stateOf returns the state sent in an authorization URL
+func stateOf(t *testing.T, authURL string) string {
+	t.Helper()
+	u, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatalf("parsing %q: %v", authURL, err)
+	}
+	return u.Query().Get("state")
+}
+
+func TestOIDCSignInCreatesAndLinksUser(t *testing.T) {
+	o := newOIDCTest(t)
+
+	params := o.signIn(t, bob, nil)
+	if params.Get("token") == "" || params.Get("refresh_token") == "" {
+		t.Fatalf("got %v, want a session", params)
+	}
+
+	user, err := o.store.GetUserByEmail(bob.Email)
+	if err != nil {
+		t.Fatalf("GetUserByEmail: %v", err)
+	}
+	if !user.EmailVerified() {
+		t.Error("user created with a verified email is not verified")
+	}
+	identity, err := o.store.GetIdentity("test", bob.Subject)
+	if err != nil || identity.UserID != user.ID {
+		t.Fatalf("GetIdentity: got %+v, %v, want user %d", identity, err, user.ID)
+	}
+
+	// Signing in again, even after the email changes at the provider, uses
+	// the linked identity
+	renamed := bob
+	renamed.Email = "robert@example.com"
+	if params := o.signIn(t, renamed, nil); params.Get("token") == "" {
+		t.Fatalf("second sign-in: got %v, want a session", params)
+	}
+	if _, err := o.store.GetUserByEmail(renamed.Email); err != store.ErrUserNotFound {
+		t.Errorf("second sign-in created another user (error %v)", err)
+	}
+}
+
+func TestOIDCSignInRejectsStateMismatch(t *testing.T) {
+	o := newOIDCTest(t)
+	authURL, cookie := o.login(t)
+	code, err := o.srv.Authorize(authURL, bob, nil)
+	if err != nil {
+		t.Fatalf("Authorize: %v", err)
+	}
+
+	for name, tc := range map[string]struct {
+		state  string
+		cookie *http.Cookie
+	}{
+		"wrong state":   {"forged", cookie},
+		"missing state": {"", cookie},
+		"no cookie":     {stateOf(t, authURL), nil},
+	} {
+		params := o.callback(t, url.Values{"code": {code}, "state": {tc.state}}, tc.cookie)
+		if params.Get("token") != "" || params.Get("error") != "Sign-in session expired, try again" {
+			t.Errorf("%s: got %v, want a session expired error", name, params)
+		}
+	}
+}
+
+func TestOIDCSignInRejectsPKCEMismatch(t *testing.T) {
+	o := newOIDCTest(t)
+
+	// An attacker's code injected into the victim's flow is redeemed with
+	// the victim's verifier, which does not match the attacker's challenge
+	attackerURL, _ := o.login(t)
+	code, err := o.srv.Authorize(attackerURL, bob, nil)
+	if err != nil {
+		t.Fatalf("Authorize: %v", err)
+	}
+	victimURL, victimCookie := o.login(t)
+
+	params := o.callback(t, url.Values{"code": {code}, "state": {stateOf(t, victimURL)}}, victimCookie)
+	if params.Get("token") != "" || params.Get("error") != "Sign-in failed, try again" {
+		t.Errorf("got %v, want a sign-in error", params)
+	}
+	if _, err := o.store.GetUserByEmail(bob.Email); err != store.ErrUserNotFound {
+		t.Errorf("user was created (error %v)", err)
+	}
+}
+
+func TestOIDCSignInRejectsInvalidIDToken(t *testing.T) {
+	for name, edit := range map[string]func(jwt.MapClaims){
+		"nonce mismatch": func(c jwt.MapClaims) { c["nonce"] = "replayed" },
+		"wrong audience": func(c jwt.MapClaims) { c["aud"] = "someone-else" },
+		"wrong issuer":   func(c jwt.MapClaims) { c["iss"] = "https://evil.example.com" },
+	} {
+		t.Run(name, func(t *testing.T) {
+			o := newOIDCTest(t)
+
+			params := o.signIn(t, bob, edit)
+			if params.Get("token") != "" || params.Get("error") != "Sign-in failed, try again" {
+				t.Errorf("got %v, want a sign-in error", params)
+			}
+			if _, err := o.store.GetUserByEmail(bob.Email); err != store.ErrUserNotFound {
+				t.Errorf("user was created (error %v)", err)
+			}
+		})
+	}
+}
+
+func TestOIDCSignInWithUnverifiedEmail(t *testing.T) {
+	o := newOIDCTest(t)
+	existing, err := o.store.CreateUser(bob.Email, "hash")
+	if err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+
+	// An unverified email must not take over the existing account
+	unverified := bob
+	unverified.EmailVerified = false
+	params := o.signIn(t, unverified, nil)
+	if params.Get("token") != "" || !strings.Contains(params.Get("error"), "already exists") {
+		t.Errorf("got %v, want an account exists error", params)
+	}
+	if _, err := o.store.GetIdentity("test", bob.Subject); err != store.ErrIdentityNotFound {
+		t.Errorf("identity was linked (error %v)", err)
+	}
+
+	// A verified one is linked to it
+	if params := o.signIn(t, bob, nil); params.Get("token") == "" {
+		t.Fatalf("got %v, want a session", params)
+	}
+	identity, err := o.store.GetIdentity("test", bob.Subject)
+	if err != nil || identity.UserID != existing.ID {
+		t.Errorf("GetIdentity: got %+v, %v, want user %d", identity, err, existing.ID)
+	}
+}
+
+func TestOIDCSignInWithUnverifiedEmailCreatesUnverifiedUser(t *testing.T) {
+	o := newOIDCTest(t)
+
+	unverified := bob
+	unverified.EmailVerified = false
+	if params := o.signIn(t, unverified, nil); params.Get("token") == "" {
+		t.Fatalf("got %v, want a session", params)
+	}
+
+	user, err := o.store.GetUserByEmail(bob.Email)
+	if err != nil {
+		t.Fatalf("GetUserByEmail: %v", err)
+	}
+	if user.EmailVerified() {
+		t.Error("user created with an unverified email is verified")
+	}
+}
+
+func TestOIDCSignInRequiresEmail(t *testing.T) {
+	o := newOIDCTest(t)
+
+	params := o.signIn(t, oidctest.Identity{Subject: "no-email"}, nil)
+	if params.Get("token") != "" || params.Get("error") != "The identity provider did not share an email address" {
+		t.Errorf("got %v, want a missing email error", params)
+	}
+}
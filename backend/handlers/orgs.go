@@ -0,0 +1,735 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"latlongapi/backend/auth"
+	"latlongapi/backend/mail"
+	"latlongapi/backend/models"
+	"latlongapi/backend/store"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const maxOrgNameLength = 100
+
+// OrgHandler serves organizations: their members, invitations, shared API
+// keys and usage
+type OrgHandler struct {
+	auth       *AuthHandler // Sends invitation emails
+	orgStore   models.OrganizationStore
+	keyStore   models.APIKeyStore
+	usageStore models.UsageStore
+}
+
+// NewOrgHandler creates a new organization handler
+func NewOrgHandler(authHandler *AuthHandler, orgStore models.OrganizationStore, keyStore models.APIKeyStore, usageStore models.UsageStore) *OrgHandler {
+	return &OrgHandler{
+		auth:       authHandler,
+		orgStore:   orgStore,
+		keyStore:   keyStore,
+		usageStore: usageStore,
+	}
+}
+
+// OrgRequest represents a request to create or rename an organization
+type OrgRequest struct {
+	Name string `json:"name"`
+}
+
+// MemberRequest represents a change of a member's role
+type MemberRequest struct {
+	Role string `json:"role"`
+}
+
+// InvitationRequest represents a request to invite someone to an organization
+type InvitationRequest struct {
+	Email string `json:"email"`
+	Role  string `json:"role"` // Defaults to member
+}
+
+// AcceptInvitationRequest represents a request to join an organization
+type AcceptInvitationRequest struct {
+	Token string `json:"token"`
+}
+
+// Orgs handles /api/orgs: GET lists the user's organizations, POST creates a
+// new one with the user as its owner
+func (h *OrgHandler) Orgs(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	user, ok := r.Context().Value("user").(*models.User)
+	if !ok {
+		respondError(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		orgs, err := h.orgStore.ListOrganizations(user.ID)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "error listing organizations", "error", err)
+			respondError(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		respondJSON(w, orgs, http.StatusOK)
+
+	case http.MethodPost:
+		if !user.EmailVerified() {
+			respondError(w, "Verify your email address before creating organizations", http.StatusForbidden)
+			return
+		}
+
+		var req OrgRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			respondError(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		name, ok := validateOrgName(w, req.Name)
+		if !ok {
+			return
+		}
+
+		org, err := h.orgStore.CreateOrganization(name, user.ID)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "error creating organization", "error", err)
+			respondError(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		slog.InfoContext(r.Context(), "audit: organization created", "actor_id", user.ID, "org_id", org.ID, "name", org.Name)
+
+		respondJSON(w, models.UserOrganization{Organization: *org, Role: models.OrgRoleOwner}, http.StatusCreated)
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// AcceptInvitation handles POST /api/orgs/invitations/accept. The signed-in
+// user joins the organization if the invitation was sent to their verified
+// email address.
+func (h *OrgHandler) AcceptInvitation(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	user, ok := r.Context().Value("user").(*models.User)
+	if !ok {
+		respondError(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req AcceptInvitationRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Token == "" {
+		respondError(w, "Token is required", http.StatusBadRequest)
+		return
+	}
+
+	invitation, err := h.orgStore.GetInvitationByHash(auth.HashInvitationToken(req.Token))
+	if err != nil {
+		if err == store.ErrInvitationNotFound {
+			respondError(w, "Invalid or expired invitation", http.StatusBadRequest)
+			return
+		}
+		slog.ErrorContext(r.Context(), "error getting invitation", "error", err)
+		respondError(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	if time.Now().After(invitation.ExpiresAt) {
+		respondError(w, "Invalid or expired invitation", http.StatusBadRequest)
+		return
+	}
+
+	if !strings.EqualFold(invitation.Email, user.Email) {
+		respondError(w, "This invitation was sent to a different email address", http.StatusForbidden)
+		return
+	}
+	if !user.EmailVerified() {
+		respondError(w, "Verify your email address before accepting invitations", http.StatusForbidden)
+		return
+	}
+
+	membership, err := h.orgStore.AcceptInvitation(invitation.ID, user.ID)
+	if err != nil {
+		switch err {
+		case store.ErrInvitationNotFound:
+			respondError(w, "Invalid or expired invitation", http.StatusBadRequest)
+		case store.ErrMemberExists:
+			respondError(w, "You are already a member of this organization", http.StatusConflict)
+		default:
+			slog.ErrorContext(r.Context(), "error accepting invitation", "error", err)
+			respondError(w, "Internal server error", http.StatusInternalServerError)
+		}
+		return
+	}
+	slog.InfoContext(r.Context(), "audit: organization joined", "actor_id", user.ID, "org_id", membership.OrgID, "role", membership.Role)
+
+	respondJSON(w, membership, http.StatusOK)
+}
+
+// Org handles everything under /api/orgs/{id}:
+//
+//	GET, PATCH, DELETE  /api/orgs/{id}
+//	GET                 /api/orgs/{id}/members
+//	PATCH, DELETE       /api/orgs/{id}/members/{userID}
+//	GET, POST           /api/orgs/{id}/invitations
+//	DELETE              /api/orgs/{id}/invitations/{invitationID}
+//	GET, POST           /api/orgs/{id}/keys
+//	PATCH, DELETE       /api/orgs/{id}/keys/{keyID}
+//	GET                 /api/orgs/{id}/usage
+func (h *OrgHandler) Org(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PATCH, DELETE, OPTIONS")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	user, ok := r.Context().Value("user").(*models.User)
+	if !ok {
+		respondError(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/orgs/"), "/"), "/")
+	orgID, err := strconv.Atoi(parts[0])
+	if err != nil {
+		respondError(w, "Organization not found", http.StatusNotFound)
+		return
+	}
+
+	// Non-members cannot tell whether an organization exists
+	membership, err := h.orgStore.GetMembership(orgID, user.ID)
+	if err != nil {
+		if err == store.ErrMembershipNotFound {
+			respondError(w, "Organization not found", http.StatusNotFound)
+			return
+		}
+		slog.ErrorContext(r.Context(), "error getting membership", "error", err)
+		respondError(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	var id int
+	if len(parts) == 3 {
+		if id, err = strconv.Atoi(parts[2]); err != nil {
+			respondError(w, "Not found", http.StatusNotFound)
+			return
+		}
+	}
+
+	switch {
+	case len(parts) == 1:
+		h.org(w, r, membership)
+	case len(parts) == 2 && parts[1] == "members":
+		h.members(w, r, membership)
+	case len(parts) == 3 && parts[1] == "members":
+		h.member(w, r, membership, id)
+	case len(parts) == 2 && parts[1] == "invitations":
+		h.invitations(w, r, user, membership)
+	case len(parts) == 3 && parts[1] == "invitations":
+		h.invitation(w, r, membership, id)
+	case len(parts) == 2 && parts[1] == "keys":
+		h.keys(w, r, membership)
+	case len(parts) == 3 && parts[1] == "keys":
+		h.key(w, r, membership, id)
+	case len(parts) == 2 && parts[1] == "usage":
+		h.usage(w, r, membership)
+	default:
+		respondError(w, "Not found", http.StatusNotFound)
+	}
+}
+
+// org serves the organization itself
+func (h *OrgHandler) org(w http.ResponseWriter, r *http.Request, membership *models.Membership) {
+	switch r.Method {
+	case http.MethodGet:
+		org, ok := h.getOrg(w, r, membership.OrgID)
+		if !ok {
+			return
+		}
+		respondJSON(w, models.UserOrganization{Organization: *org, Role: membership.Role}, http.StatusOK)
+
+	case http.MethodPatch:
+		if !requireOrgRole(w, membership, models.OrgRoleAdmin) {
+			return
+		}
+
+		var req OrgRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			respondError(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		name, ok := validateOrgName(w, req.Name)
+		if !ok {
+			return
+		}
+
+		org, ok := h.getOrg(w, r, membership.OrgID)
+		if !ok {
+			return
+		}
+		org.Name = name
+		if err := h.orgStore.UpdateOrganization(org); err != nil {
+			slog.ErrorContext(r.Context(), "error updating organization", "error", err)
+			respondError(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		respondJSON(w, models.UserOrganization{Organization: *org, Role: membership.Role}, http.StatusOK)
+
+	case http.MethodDelete:
+		if !requireOrgRole(w, membership, models.OrgRoleOwner) {
+			return
+		}
+
+		if err := h.orgStore.DeleteOrganization(membership.OrgID); err != nil {
+			slog.ErrorContext(r.Context(), "error deleting organization", "error", err)
+			respondError(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		slog.InfoContext(r.Context(), "audit: organization deleted", "actor_id", membership.UserID, "org_id", membership.OrgID)
+
+		respondJSON(w, map[string]string{"message": "Organization deleted"}, http.StatusOK)
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// members lists the organization's members
+func (h *OrgHandler) members(w http.ResponseWriter, r *http.Request, membership *models.Membership) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	members, err := h.orgStore.ListMembers(membership.OrgID)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "error listing members", "error", err)
+		respondError(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	respondJSON(w, members, http.StatusOK)
+}
+
+// member changes a member's role (PATCH) or removes them (DELETE). Anyone may
+// leave; otherwise admins manage members and admins, and only owners manage
+// owners. The last owner can neither leave nor be demoted.
+func (h *OrgHandler) member(w http.ResponseWriter, r *http.Request, membership *models.Membership, userID int) {
+	if r.Method != http.MethodPatch && r.Method != http.MethodDelete {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	target, err := h.orgStore.GetMembership(membership.OrgID, userID)
+	if err != nil {
+		if err == store.ErrMembershipNotFound {
+			respondError(w, "Member not found", http.StatusNotFound)
+			return
+		}
+		slog.ErrorContext(r.Context(), "error getting membership", "error", err)
+		respondError(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	leaving := r.Method == http.MethodDelete && target.UserID == membership.UserID
+	if !leaving {
+		if !requireOrgRole(w, membership, models.OrgRoleAdmin) {
+			return
+		}
+		if target.Role == models.OrgRoleOwner && !requireOrgRole(w, membership, models.OrgRoleOwner) {
+			return
+		}
+	}
+
+	newRole := ""
+	if r.Method == http.MethodPatch {
+		var req MemberRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			respondError(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		if _, ok := models.OrgRoles[req.Role]; !ok {
+			respondError(w, "Role must be owner, admin or member", http.StatusBadRequest)
+			return
+		}
+		if req.Role == models.OrgRoleOwner && !requireOrgRole(w, membership, models.OrgRoleOwner) {
+			return
+		}
+		newRole = req.Role
+	}
+
+	if target.Role == models.OrgRoleOwner && newRole != models.OrgRoleOwner {
+		last, err := h.isLastOwner(membership.OrgID)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "error listing members", "error", err)
+			respondError(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		if last {
+			respondError(w, "An organization needs at least one owner; make someone else an owner first", http.StatusConflict)
+			return
+		}
+	}
+
+	if r.Method == http.MethodPatch {
+		if err := h.orgStore.UpdateMemberRole(membership.OrgID, userID, newRole); err != nil {
+			slog.ErrorContext(r.Context(), "error updating member role", "error", err)
+			respondError(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		slog.InfoContext(r.Context(), "audit: member role changed", "actor_id", membership.UserID, "target_user_id", userID, "org_id", membership.OrgID, "old_role", target.Role, "new_role", newRole)
+
+		target.Role = newRole
+		respondJSON(w, target, http.StatusOK)
+		return
+	}
+
+	if err := h.orgStore.RemoveMember(membership.OrgID, userID); err != nil {
+		slog.ErrorContext(r.Context(), "error removing member", "error", err)
+		respondError(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if leaving {
+		slog.InfoContext(r.Context(), "audit: organization left", "actor_id", userID, "org_id", membership.OrgID)
+	} else {
+		slog.InfoContext(r.Context(), "audit: member removed", "actor_id", membership.UserID, "target_user_id", userID, "org_id", membership.OrgID)
+	}
+
+	respondJSON(w, map[string]string{"message": "Member removed"}, http.StatusOK)
+}
+
+// invitations lists pending invitations (GET) or invites someone by email (POST)
+func (h *OrgHandler) invitations(w http.ResponseWriter, r *http.Request, user *models.User, membership *models.Membership) {
+	if !requireOrgRole(w, membership, models.OrgRoleAdmin) {
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		invitations, err := h.orgStore.ListInvitations(membership.OrgID)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "error listing invitations", "error", err)
+			respondError(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		respondJSON(w, invitations, http.StatusOK)
+
+	case http.MethodPost:
+		var req InvitationRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			respondError(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		email := strings.TrimSpace(req.Email)
+		if email == "" || !strings.Contains(email, "@") {
+			respondError(w, "A valid email address is required", http.StatusBadRequest)
+			return
+		}
+
+		role := req.Role
+		if role == "" {
+			role = models.OrgRoleMember
+		}
+		if _, ok := models.OrgRoles[role]; !ok {
+			respondError(w, "Role must be owner, admin or member", http.StatusBadRequest)
+			return
+		}
+		if role == models.OrgRoleOwner && !requireOrgRole(w, membership, models.OrgRoleOwner) {
+			return
+		}
+
+		org, ok := h.getOrg(w, r, membership.OrgID)
+		if !ok {
+			return
+		}
+
+		token, hash, err := auth.GenerateInvitationToken()
+		if err != nil {
+			slog.ErrorContext(r.Context(), "error generating invitation token", "error", err)
+			respondError(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+
+		invitation, err := h.orgStore.CreateInvitation(org.ID, email, role, user.ID, hash, time.Now().Add(auth.InvitationTTL))
+		if err != nil {
+			slog.ErrorContext(r.Context(), "error creating invitation", "error", err)
+			respondError(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		slog.InfoContext(r.Context(), "audit: member invited", "actor_id", user.ID, "email", email, "org_id", org.ID, "role", role)
+
+		h.auth.sendMail(r.Context(), mail.Message{
+			To:      email,
+			Subject: fmt.Sprintf("Join %s on LatLongAPI", org.Name),
+			Body: fmt.Sprintf("%s invited you to join the %s organization on LatLongAPI as %s %s.\n\nAccept the invitation by opening this link and logging in (or signing up) with this email address:\n\n%s\n\nThe link expires in %s.\n",
+				user.Email, org.Name, article(role), role, h.auth.link("invite", token), formatTTL(auth.InvitationTTL)),
+		})
+
+		respondJSON(w, invitation, http.StatusCreated)
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// invitation withdraws a pending invitation
+func (h *OrgHandler) invitation(w http.ResponseWriter, r *http.Request, membership *models.Membership, id int) {
+	if r.Method != http.MethodDelete {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !requireOrgRole(w, membership, models.OrgRoleAdmin) {
+		return
+	}
+
+	if err := h.orgStore.DeleteInvitation(membership.OrgID, id); err != nil {
+		if err == store.ErrInvitationNotFound {
+			respondError(w, "Invitation not found", http.StatusNotFound)
+			return
+		}
+		slog.ErrorContext(r.Context(), "error deleting invitation", "error", err)
+		respondError(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	respondJSON(w, map[string]string{"message": "Invitation withdrawn"}, http.StatusOK)
+}
+
+// keys lists the organization's API keys (GET) or creates one (POST). Every
+// member can see the keys; admins create and revoke them.
+func (h *OrgHandler) keys(w http.ResponseWriter, r *http.Request, membership *models.Membership) {
+	switch r.Method {
+	case http.MethodGet:
+		keys, err := h.keyStore.ListOrgAPIKeys(membership.OrgID)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "error listing API keys", "error", err)
+			respondError(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		respondJSON(w, keys, http.StatusOK)
+
+	case http.MethodPost:
+		if !requireOrgRole(w, membership, models.OrgRoleAdmin) {
+			return
+		}
+
+		var req APIKeyRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			respondError(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		label, ok := validateAPIKeyLabel(w, req.Label)
+		if !ok {
+			return
+		}
+
+		key, prefix, hash, err := auth.GenerateAPIKey()
+		if err != nil {
+			slog.ErrorContext(r.Context(), "error generating API key", "error", err)
+			respondError(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+
+		apiKey, err := h.keyStore.CreateOrgAPIKey(membership.OrgID, label, prefix, hash)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "error creating API key", "error", err)
+			respondError(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		slog.InfoContext(r.Context(), "audit: organization API key created", "actor_id", membership.UserID, "key_id", apiKey.ID, "org_id", membership.OrgID)
+
+		respondJSON(w, CreateAPIKeyResponse{
+			Key:    key,
+			APIKey: apiKey,
+		}, http.StatusCreated)
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// key changes the label of an organization's key (PATCH) or revokes it (DELETE)
+func (h *OrgHandler) key(w http.ResponseWriter, r *http.Request, membership *models.Membership, id int) {
+	if r.Method != http.MethodPatch && r.Method != http.MethodDelete {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !requireOrgRole(w, membership, models.OrgRoleAdmin) {
+		return
+	}
+
+	var apiKey *models.APIKey
+	var err error
+	if r.Method == http.MethodPatch {
+		var req APIKeyRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			respondError(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		label, ok := validateAPIKeyLabel(w, req.Label)
+		if !ok {
+			return
+		}
+		apiKey, err = h.keyStore.UpdateOrgAPIKeyLabel(membership.OrgID, id, label)
+	} else {
+		apiKey, err = h.keyStore.RevokeOrgAPIKey(membership.OrgID, id)
+	}
+
+	if err != nil {
+		if err == store.ErrAPIKeyNotFound {
+			respondError(w, "API key not found", http.StatusNotFound)
+			return
+		}
+		slog.ErrorContext(r.Context(), "error updating API key", "error", err)
+		respondError(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if r.Method == http.MethodDelete {
+		slog.InfoContext(r.Context(), "audit: organization API key revoked", "actor_id", membership.UserID, "key_id", id, "org_id", membership.OrgID)
+	}
+
+	respondJSON(w, apiKey, http.StatusOK)
+}
+
+// usage reports the usage of the organization's keys, like /api/v1/usage
+func (h *OrgHandler) usage(w http.ResponseWriter, r *http.Request, membership *models.Membership) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	from, now, ok := usageWindow(w, r)
+	if !ok {
+		return
+	}
+
+	records, err := h.usageStore.ListOrgUsage(membership.OrgID, from)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "error listing usage", "error", err)
+		respondError(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	respondJSON(w, summarizeUsage(records, from, now), http.StatusOK)
+}
+
+// getOrg loads an organization, writing an error response if that fails
+func (h *OrgHandler) getOrg(w http.ResponseWriter, r *http.Request, id int) (*models.Organization, bool) {
+	org, err := h.orgStore.GetOrganization(id)
+	if err != nil {
+		if err == store.ErrOrganizationNotFound {
+			respondError(w, "Organization not found", http.StatusNotFound)
+			return nil, false
+		}
+		slog.ErrorContext(r.Context(), "error getting organization", "error", err)
+		respondError(w, "Internal server error", http.StatusInternalServerError)
+		return nil, false
+	}
+	return org, true
+}
+
+// isLastOwner reports whether the organization has a single owner
+func (h *OrgHandler) isLastOwner(orgID int) (bool, error) {
+	owners, err := countOwners(h.orgStore, orgID)
+	return owners <= 1, err
+}
+
+// countOwners returns the number of owners of an organization
+func countOwners(orgStore models.OrganizationStore, orgID int) (int, error) {
+	members, err := orgStore.ListMembers(orgID)
+	if err != nil {
+		return 0, err
+	}
+	owners := 0
+	for _, m := range members {
+		if m.Role == models.OrgRoleOwner {
+			owners++
+		}
+	}
+	return owners, nil
+}
+
+// soleOwnedOrg returns an organization of which userID is the only owner,
+// or nil if there is none. Such users cannot be deleted, as that would leave
+// the organization unmanageable.
+func soleOwnedOrg(orgStore models.OrganizationStore, userID int) (*models.UserOrganization, error) {
+	orgs, err := orgStore.ListOrganizations(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, org := range orgs {
+		if org.Role != models.OrgRoleOwner {
+			continue
+		}
+		owners, err := countOwners(orgStore, org.ID)
+		if err != nil {
+			return nil, err
+		}
+		if owners == 1 {
+			return org, nil
+		}
+	}
+	return nil, nil
+}
+
+// requireOrgRole writes a 403 response unless membership grants at least role
+func requireOrgRole(w http.ResponseWriter, membership *models.Membership, role string) bool {
+	if !membership.HasRole(role) {
+		respondError(w, fmt.Sprintf("Only organization %ss can do this", role), http.StatusForbidden)
+		return false
+	}
+	return true
+}
+
+// validateOrgName trims and checks an organization name, writing an error
+// response if it is invalid
+func validateOrgName(w http.ResponseWriter, name string) (string, bool) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		respondError(w, "Name is required", http.StatusBadRequest)
+		return "", false
+	}
+	if len(name) > maxOrgNameLength {
+		respondError(w, "Name must be at most 100 characters", http.StatusBadRequest)
+		return "", false
+	}
+	return name, true
+}
+
+// article returns the indefinite article for word
+func article(word string) string {
+	if strings.ContainsRune("aeiou", rune(word[0])) {
+		return "an"
+	}
+	return "a"
+}
@@ -0,0 +1,214 @@
+package handlers
+
+import (
+	"latlongapi/backend/models"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+)
+
+const (
+	defaultUsageDays = 30
+	maxUsageDays     = 366
+)
+
+// UsageHandler serves usage statistics for the authenticated user
+type UsageHandler struct {
+	usageStore models.UsageStore
+}
+
+// NewUsageHandler creates a new usage handler
+func NewUsageHandler(usageStore models.UsageStore) *UsageHandler {
+	return &UsageHandler{
+		usageStore: usageStore,
+	}
+}
+
+// UsageStats aggregates a set of usage records
+type UsageStats struct {
+	Requests     int     `json:"requests"`
+	Units        int     `json:"units"`  // Quota units charged; a batch is charged one per item
+	Errors       int     `json:"errors"` // Responses with status >= 400
+	CacheHits    int     `json:"cache_hits"`
+	AvgLatencyMs float64 `json:"avg_latency_ms"`
+
+	totalLatency time.Duration
+}
+
+// PeriodUsage is the usage within one day or month
+type PeriodUsage struct {
+	Period string `json:"period"` // YYYY-MM-DD or YYYY-MM (UTC)
+	UsageStats
+}
+
+// EndpointUsage is the usage of one endpoint
+type EndpointUsage struct {
+	Endpoint string `json:"endpoint"`
+	UsageStats
+}
+
+// KeyUsage is the usage of one API key
+type KeyUsage struct {
+	APIKeyID int `json:"api_key_id"`
+	UsageStats
+}
+
+// UsageResponse represents a usage report
+type UsageResponse struct {
+	From      time.Time       `json:"from"`
+	To        time.Time       `json:"to"`
+	Total     UsageStats      `json:"total"`
+	Daily     []PeriodUsage   `json:"daily"`
+	Monthly   []PeriodUsage   `json:"monthly"`
+	Endpoints []EndpointUsage `json:"endpoints"`
+	Keys      []KeyUsage      `json:"keys"`
+}
+
+// Usage returns aggregated API usage for the current user over the last
+// days days (query parameter, default 30)
+func (h *UsageHandler) Usage(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Methods", "GET, OPTIONS")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// Get user from context (set by middleware)
+	user, ok := r.Context().Value("user").(*models.User)
+	if !ok {
+		respondError(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	from, now, ok := usageWindow(w, r)
+	if !ok {
+		return
+	}
+
+	records, err := h.usageStore.ListUsage(user.ID, from)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "error listing usage", "error", err)
+		respondError(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	respondJSON(w, summarizeUsage(records, from, now), http.StatusOK)
+}
+
+// usageWindow returns the start of the report period selected by the days
+// query parameter and the current time, writing an error response if the
+// parameter is invalid
+func usageWindow(w http.ResponseWriter, r *http.Request) (from, now time.Time, ok bool) {
+	days := defaultUsageDays
+	if daysStr := r.URL.Query().Get("days"); daysStr != "" {
+		n, err := strconv.Atoi(daysStr)
+		if err != nil || n < 1 || n > maxUsageDays {
+			respondError(w, "Days must be between 1 and 366", http.StatusBadRequest)
+			return time.Time{}, time.Time{}, false
+		}
+		days = n
+	}
+
+	now = time.Now().UTC()
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	return today.AddDate(0, 0, -(days - 1)), now, true
+}
+
+// summarizeUsage aggregates records into totals and daily, monthly,
+// per-endpoint and per-key breakdowns
+func summarizeUsage(records []models.UsageRecord, from, to time.Time) UsageResponse {
+	var total UsageStats
+	daily := map[string]*UsageStats{}
+	monthly := map[string]*UsageStats{}
+	endpoints := map[string]*UsageStats{}
+	keys := map[int]*UsageStats{}
+
+	for _, record := range records {
+		ts := record.Timestamp.UTC()
+		total.add(record)
+		statsFor(daily, ts.Format("2006-01-02")).add(record)
+		statsFor(monthly, ts.Format("2006-01")).add(record)
+		statsFor(endpoints, record.Endpoint).add(record)
+		if keys[record.APIKeyID] == nil {
+			keys[record.APIKeyID] = &UsageStats{}
+		}
+		keys[record.APIKeyID].add(record)
+	}
+
+	resp := UsageResponse{
+		From:      from,
+		To:        to,
+		Total:     total.finish(),
+		Daily:     []PeriodUsage{},
+		Monthly:   []PeriodUsage{},
+		Endpoints: []EndpointUsage{},
+		Keys:      []KeyUsage{},
+	}
+
+	for _, period := range sortedKeys(daily) {
+		resp.Daily = append(resp.Daily, PeriodUsage{Period: period, UsageStats: daily[period].finish()})
+	}
+	for _, period := range sortedKeys(monthly) {
+		resp.Monthly = append(resp.Monthly, PeriodUsage{Period: period, UsageStats: monthly[period].finish()})
+	}
+	for _, endpoint := range sortedKeys(endpoints) {
+		resp.Endpoints = append(resp.Endpoints, EndpointUsage{Endpoint: endpoint, UsageStats: endpoints[endpoint].finish()})
+	}
+	for id, stats := range keys {
+		resp.Keys = append(resp.Keys, KeyUsage{APIKeyID: id, UsageStats: stats.finish()})
+	}
+	sort.Slice(resp.Keys, func(i, j int) bool { return resp.Keys[i].APIKeyID < resp.Keys[j].APIKeyID })
+
+	return resp
+}
+
+// add counts one record
+func (s *UsageStats) add(record models.UsageRecord) {
+	s.Requests++
+	if record.Status != http.StatusTooManyRequests {
+		s.Units += record.Units
+	}
+	if record.Status >= http.StatusBadRequest {
+		s.Errors++
+	}
+	if record.CacheHit {
+		s.CacheHits++
+	}
+	s.totalLatency += record.Latency
+}
+
+// finish computes derived fields and returns the completed stats
+func (s *UsageStats) finish() UsageStats {
+	if s.Requests > 0 {
+		s.AvgLatencyMs = float64(s.totalLatency.Microseconds()) / float64(s.Requests) / 1000
+	}
+	return *s
+}
+
+// statsFor returns the stats for key, creating them if needed
+func statsFor(m map[string]*UsageStats, key string) *UsageStats {
+	if m[key] == nil {
+		m[key] = &UsageStats{}
+	}
+	return m[key]
+}
+
+// sortedKeys returns the keys of m in ascending order
+func sortedKeys(m map[string]*UsageStats) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,181 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Status is the outcome of a check or of a whole report
+type Status string
+
+const (
+	StatusOK       Status = "ok"
+	StatusDegraded Status = "degraded" // A non-critical check failed; the service still works
+	StatusFailed   Status = "failed"   // A critical check failed; the service should not take traffic
+)
+
+// DefaultTimeout bounds checks registered without a timeout
+const DefaultTimeout = 5 * time.Second
+
+// CheckFunc returns nil when the dependency it checks is healthy
+type CheckFunc func(ctx context.Context) error
+
+// Check is a named health check
+type Check struct {
+	Name     string
+	Check    CheckFunc
+	Critical bool          // A failure fails readiness; otherwise it only degrades it
+	Timeout  time.Duration // Defaults to DefaultTimeout
+	CacheTTL time.Duration // Reuse the last result for this long, for checks that are costly or rate limited
+}
+
+// Result is the outcome of one check
+type Result struct {
+	Status    Status    `json:"status"`
+	Critical  bool      `json:"critical"`
+	Error     string    `json:"error,omitempty"`
+	Duration  Duration  `json:"duration_ms"`
+	CheckedAt time.Time `json:"checked_at"`
+	Cached    bool      `json:"cached,omitempty"`
+}
+
+// Report is the outcome of every registered check
+type Report struct {
+	Status   Status            `json:"status"`
+	Duration Duration          `json:"duration_ms"`
+	Checks   map[string]Result `json:"checks"`
+}
+
+// Duration is a time.Duration that marshals to JSON as fractional milliseconds
+type Duration time.Duration
+
+// MarshalJSON writes the duration in milliseconds
+func (d Duration) MarshalJSON() ([]byte, error) {
+	ms := float64(time.Duration(d).Microseconds()) / 1000
+	return json.Marshal(ms)
+}
+
+// Registry runs a set of checks
+type Registry struct {
+	mu     sync.Mutex
+	checks []*entry
+}
+
+// entry is a registered check with its cached result
+type entry struct {
+	Check
+	mu   sync.Mutex // Held while the check runs, so callers share one run
+	last *Result
+}
+
+// NewRegistry creates an empty registry
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+// Register adds a check to the registry
+func (r *Registry) Register(c Check) {
+	if c.Timeout <= 0 {
+		c.Timeout = DefaultTimeout
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.checks = append(r.checks, &entry{Check: c})
+	sort.Slice(r.checks, func(i, j int) bool { return r.checks[i].Name < r.checks[j].Name })
+}
+
+// Run runs every check concurrently and combines the results. The report
+// fails if any critical check fails and is degraded if any other check fails.
+func (r *Registry) Run(ctx context.Context) Report {
+	start := time.Now()
+
+	r.mu.Lock()
+	checks := append([]*entry(nil), r.checks...)
+	r.mu.Unlock()
+
+	results := make([]Result, len(checks))
+	var wg sync.WaitGroup
+	for i, e := range checks {
+		wg.Add(1)
+		go func(i int, e *entry) {
+			defer wg.Done()
+			results[i] = e.run(ctx)
+		}(i, e)
+	}
+	wg.Wait()
+
+	report := Report{Status: StatusOK, Checks: make(map[string]Result, len(checks))}
+	for i, e := range checks {
+		res := results[i]
+		report.Checks[e.Name] = res
+		switch {
+		case res.Status == StatusFailed && e.Critical:
+			report.Status = StatusFailed
+		case res.Status == StatusFailed && report.Status == StatusOK:
+			report.Status = StatusDegraded
+		}
+	}
+	report.Duration = Duration(time.Since(start))
+	return report
+}
+
+// run runs the check, or returns its last result while that is still fresh
+func (e *entry) run(ctx context.Context) Result {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.last != nil && e.CacheTTL > 0 && time.Since(e.last.CheckedAt) < e.CacheTTL {
+		res := *e.last
+		res.Cached = true
+		return res
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, e.Timeout)
+	defer cancel()
+
+	start := time.Now()
+	err := e.Check.Check(ctx)
+	res := Result{
+		Status:    StatusOK,
+		Critical:  e.Critical,
+		Duration:  Duration(time.Since(start)),
+		CheckedAt: start,
+	}
+	if err != nil {
+		res.Status = StatusFailed
+		res.Error = err.Error()
+	}
+
+	e.last = &res
+	return res
+}
+
+// Handler serves a JSON report, with status 503 when the report has failed.
+// Degraded reports are served with 200 so that the service keeps taking
+// traffic.
+func (r *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodGet && req.Method != http.MethodHead {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		report := r.Run(req.Context())
+
+		status := http.StatusOK
+		if report.Status == StatusFailed {
+			status = http.StatusServiceUnavailable
+		}
+
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.Header().Set("Cache-Control", "no-store")
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(report)
+	})
+}
@@ -0,0 +1,152 @@
+package logging
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+	"sync"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Log output formats
+const (
+	FormatJSON = "json"
+	FormatText = "text"
+)
+
+var (
+	ErrUnknownFormat = errors.New("unknown log format")
+	ErrUnknownLevel  = errors.New("unknown log level")
+)
+
+// Config selects how logs are written
+type Config struct {
+	Format string // json (default) or text
+	Level  string // debug, info (default), warn or error
+}
+
+// New creates a logger writing to w. Records logged with a context carrying
+// a request ID or trace get request_id, trace_id and span_id attributes, and
+// the request's Fields.
+func New(cfg Config, w io.Writer) (*slog.Logger, error) {
+	var level slog.Level
+	if cfg.Level != "" {
+		if err := level.UnmarshalText([]byte(cfg.Level)); err != nil {
+			return nil, fmt.Errorf("%w: %s", ErrUnknownLevel, cfg.Level)
+		}
+	}
+	opts := &slog.HandlerOptions{Level: level}
+
+	var handler slog.Handler
+	switch strings.ToLower(cfg.Format) {
+	case "", FormatJSON:
+		handler = slog.NewJSONHandler(w, opts)
+	case FormatText:
+		handler = slog.NewTextHandler(w, opts)
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnknownFormat, cfg.Format)
+	}
+
+	return slog.New(contextHandler{handler}), nil
+}
+
+// contextHandler adds the request ID and trace from the record's context
+type contextHandler struct {
+	slog.Handler
+}
+
+// Handle adds request_id, trace_id, span_id and the request's Fields when
+// ctx carries them
+func (h contextHandler) Handle(ctx context.Context, r slog.Record) error {
+	if id := RequestID(ctx); id != "" {
+		r.AddAttrs(slog.String("request_id", id))
+	}
+	if f := FieldsFrom(ctx); f != nil {
+		r.AddAttrs(f.Attrs()...)
+	}
+	if sc := trace.SpanContextFromContext(ctx); sc.IsValid() {
+		r.AddAttrs(slog.String("trace_id", sc.TraceID().String()), slog.String("span_id", sc.SpanID().String()))
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+// WithAttrs keeps the wrapper around the derived handler
+func (h contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return contextHandler{h.Handler.WithAttrs(attrs)}
+}
+
+// WithGroup keeps the wrapper around the derived handler
+func (h contextHandler) WithGroup(name string) slog.Handler {
+	return contextHandler{h.Handler.WithGroup(name)}
+}
+
+// requestIDKey is the context key of the request ID
+type requestIDKey struct{}
+
+// WithRequestID returns a copy of ctx carrying the request ID
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestID returns the request ID carried by ctx, or "" if there is none
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// Fields holds attributes learned while a request is handled, such as the
+// authenticated user, which are added to every record logged with the
+// request's context, including the access log entry. It is shared by all
+// contexts derived from the one WithFields returns, so middleware deeper in
+// the chain can fill it in for the handlers around it.
+type Fields struct {
+	mu    sync.Mutex
+	attrs []slog.Attr
+}
+
+// fieldsKey is the context key of the request's Fields
+type fieldsKey struct{}
+
+// WithFields returns a copy of ctx carrying a new, empty Fields
+func WithFields(ctx context.Context) context.Context {
+	return context.WithValue(ctx, fieldsKey{}, &Fields{})
+}
+
+// FieldsFrom returns the Fields carried by ctx, or nil if there are none
+func FieldsFrom(ctx context.Context) *Fields {
+	f, _ := ctx.Value(fieldsKey{}).(*Fields)
+	return f
+}
+
+// SetField sets key to value in the Fields carried by ctx, replacing any
+// earlier value. It does nothing if ctx carries no Fields.
+func SetField(ctx context.Context, key string, value any) {
+	f := FieldsFrom(ctx)
+	if f == nil {
+		return
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	attr := slog.Any(key, value)
+	for i := range f.attrs {
+		if f.attrs[i].Key == key {
+			f.attrs[i] = attr
+			return
+		}
+	}
+	f.attrs = append(f.attrs, attr)
+}
+
+// Attrs returns a copy of the attributes set so far
+func (f *Fields) Attrs() []slog.Attr {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return append([]slog.Attr(nil), f.attrs...)
+}
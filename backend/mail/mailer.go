@@ -0,0 +1,47 @@
+package mail
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+var (
+	ErrUnknownMailer = errors.New("unknown mailer")
+)
+
+// Message is a plain-text email
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer defines the interface for sending email
+type Mailer interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// Config holds the settings used to build a mailer at startup
+type Config struct {
+	Mailer       string // "log" (default), "file" or "smtp"
+	From         string
+	Dir          string // Directory messages are written to by the file mailer
+	SMTPAddr     string // host:port of the SMTP server
+	SMTPUsername string
+	SMTPPassword string
+}
+
+// New creates the mailer selected by cfg.Mailer
+func New(cfg Config) (Mailer, error) {
+	switch cfg.Mailer {
+	case "", "log":
+		return NewLogMailer(), nil
+	case "file":
+		return NewFileMailer(cfg.Dir, cfg.From)
+	case "smtp":
+		return NewSMTPMailer(cfg.SMTPAddr, cfg.SMTPUsername, cfg.SMTPPassword, cfg.From)
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnknownMailer, cfg.Mailer)
+	}
+}
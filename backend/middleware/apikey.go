@@ -0,0 +1,81 @@
+package middleware
+
+import (
+	"context"
+	"encoding/json"
+	"latlongapi/backend/auth"
+	"latlongapi/backend/logging"
+	"latlongapi/backend/models"
+	"latlongapi/backend/store"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// APIKeyMiddleware requires a valid, unrevoked API key sent in the X-API-Key
+// header or the key query parameter, and sets the key in context
+func APIKeyMiddleware(keyStore models.APIKeyStore) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method == http.MethodOptions {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			key := GetAPIKeyFromRequest(r)
+			if key == "" {
+				respondAPIError(w, "Missing API key", http.StatusUnauthorized)
+				return
+			}
+
+			apiKey, err := keyStore.GetAPIKeyByHash(auth.HashAPIKey(key))
+			if err != nil {
+				if err == store.ErrAPIKeyNotFound {
+					respondAPIError(w, "Invalid API key", http.StatusUnauthorized)
+					return
+				}
+				slog.ErrorContext(r.Context(), "error looking up API key", "error", err)
+				respondAPIError(w, "Internal server error", http.StatusInternalServerError)
+				return
+			}
+
+			logging.SetField(r.Context(), "api_key_id", apiKey.ID)
+			if apiKey.OrgID != 0 {
+				logging.SetField(r.Context(), "org_id", apiKey.OrgID)
+			} else {
+				logging.SetField(r.Context(), "user_id", apiKey.UserID)
+			}
+
+			if apiKey.Revoked() {
+				respondAPIError(w, "API key has been revoked", http.StatusUnauthorized)
+				return
+			}
+
+			if err := keyStore.TouchAPIKey(apiKey.ID, time.Now()); err != nil {
+				slog.ErrorContext(r.Context(), "error recording API key use", "error", err)
+			}
+
+			// Add API key to context
+			ctx := context.WithValue(r.Context(), "apiKey", apiKey)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// GetAPIKeyFromRequest extracts an API key from the X-API-Key header or the key query parameter
+func GetAPIKeyFromRequest(r *http.Request) string {
+	if key := r.Header.Get("X-API-Key"); key != "" {
+		return key
+	}
+	return r.URL.Query().Get("key")
+}
+
+// respondAPIError writes a JSON error matching the /api/v1 error format
+func respondAPIError(w http.ResponseWriter, message string, statusCode int) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.WriteHeader(statusCode)
+	json.NewEncoder(w).Encode(map[string]string{
+		"error": message,
+	})
+}
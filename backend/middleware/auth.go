@@ -4,54 +4,103 @@ import (
 	"context"
 	"latlongapi/backend/auth"
 	"latlongapi/backend/handlers"
+	"latlongapi/backend/logging"
 	"latlongapi/backend/models"
 	"latlongapi/backend/store"
+	"latlongapi/backend/tracing"
+	"log/slog"
 	"net/http"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 )
 
-// AuthMiddleware validates JWT tokens and sets user in context
-func AuthMiddleware(userStore models.UserStore) func(http.Handler) http.Handler {
+// AuthMiddleware validates JWT tokens, rejects revoked tokens and sessions,
+// and sets user in context. The checks are traced in their own span.
+func AuthMiddleware(userStore models.UserStore, tokenStore models.TokenStore) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx, span := tracing.Tracer().Start(r.Context(), "AuthMiddleware")
+
 			tokenString := handlers.GetTokenFromRequest(r)
 			if tokenString == "" {
-				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				reject(ctx, w, span, "missing_token", nil, "Unauthorized", http.StatusUnauthorized)
 				return
 			}
 
 			claims, err := auth.ValidateToken(tokenString)
 			if err != nil {
-				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				reject(ctx, w, span, "invalid_token", nil, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
+
+			revoked, err := isRevoked(tokenStore, claims)
+			if err != nil {
+				reject(ctx, w, span, "error", err, "Internal server error", http.StatusInternalServerError)
+				return
+			}
+			if revoked {
+				reject(ctx, w, span, "revoked", nil, "Unauthorized", http.StatusUnauthorized)
 				return
 			}
 
 			user, err := userStore.GetUserByID(claims.UserID)
 			if err != nil {
 				if err == store.ErrUserNotFound {
-					http.Error(w, "Unauthorized", http.StatusUnauthorized)
+					reject(ctx, w, span, "unknown_user", nil, "Unauthorized", http.StatusUnauthorized)
 					return
 				}
-				http.Error(w, "Internal server error", http.StatusInternalServerError)
+				reject(ctx, w, span, "error", err, "Internal server error", http.StatusInternalServerError)
+				return
+			}
+			logging.SetField(r.Context(), "user_id", user.ID)
+
+			if user.Suspended() {
+				reject(ctx, w, span, "suspended", nil, "Account suspended", http.StatusForbidden)
 				return
 			}
 
+			span.SetAttributes(attribute.String("auth.result", "ok"), attribute.Int("enduser.id", user.ID))
+			span.End()
+
 			// Add user to context
-			ctx := context.WithValue(r.Context(), "user", user)
+			ctx = context.WithValue(r.Context(), "user", user)
 			next.ServeHTTP(w, r.WithContext(ctx))
 		})
 	}
 }
 
+// reject ends the authentication span with the reason the request was
+// rejected and writes the error response. err is only set for internal
+// errors, which are logged and mark the span as failed.
+func reject(ctx context.Context, w http.ResponseWriter, span trace.Span, reason string, err error, message string, status int) {
+	span.SetAttributes(attribute.String("auth.result", reason))
+	if err != nil {
+		slog.ErrorContext(ctx, "error authenticating request", "error", err)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+
+	http.Error(w, message, status)
+}
+
 // OptionalAuthMiddleware validates JWT tokens if present but doesn't require them
-func OptionalAuthMiddleware(userStore models.UserStore) func(http.Handler) http.Handler {
+func OptionalAuthMiddleware(userStore models.UserStore, tokenStore models.TokenStore) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			tokenString := handlers.GetTokenFromRequest(r)
 			if tokenString != "" {
 				claims, err := auth.ValidateToken(tokenString)
 				if err == nil {
+					if revoked, err := isRevoked(tokenStore, claims); err != nil || revoked {
+						next.ServeHTTP(w, r)
+						return
+					}
 					user, err := userStore.GetUserByID(claims.UserID)
-					if err == nil {
+					if err == nil && !user.Suspended() {
+						logging.SetField(r.Context(), "user_id", user.ID)
 						ctx := context.WithValue(r.Context(), "user", user)
 						r = r.WithContext(ctx)
 					}
@@ -62,3 +111,13 @@ func OptionalAuthMiddleware(userStore models.UserStore) func(http.Handler) http.
 	}
 }
 
+// isRevoked reports whether the token or its session is on the revocation list
+func isRevoked(tokenStore models.TokenStore, claims *auth.Claims) (bool, error) {
+	if revoked, err := tokenStore.IsTokenRevoked(claims.ID); err != nil || revoked {
+		return revoked, err
+	}
+	if claims.SessionID == "" {
+		return false, nil
+	}
+	return tokenStore.IsTokenRevoked(claims.SessionID)
+}
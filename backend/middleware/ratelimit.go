@@ -0,0 +1,146 @@
+package middleware
+
+import (
+	"context"
+	"latlongapi/backend/models"
+	"latlongapi/backend/ratelimit"
+	"log/slog"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// RateLimitMiddleware enforces the plan limits of the API key's owner, a
+// user or an organization, and rejects keys of suspended users. It must run
+// after APIKeyMiddleware, which puts the key in context.
+func RateLimitMiddleware(userStore models.UserStore, orgStore models.OrganizationStore, limiter *ratelimit.Limiter) func(http.Handler) http.Handler {
+	return rateLimit(userStore, orgStore, limiter, 1)
+}
+
+// BatchRateLimitMiddleware is RateLimitMiddleware for endpoints that charge
+// one quota unit per item. It checks the per-second rate and that some quota
+// is left; the handler charges the items with ChargeQuota once it has read
+// them.
+func BatchRateLimitMiddleware(userStore models.UserStore, orgStore models.OrganizationStore, limiter *ratelimit.Limiter) func(http.Handler) http.Handler {
+	return rateLimit(userStore, orgStore, limiter, 0)
+}
+
+// quotaAccount is the quota a request is charged against, kept in the
+// request context for ChargeQuota
+type quotaAccount struct {
+	limiter *ratelimit.Limiter
+	account string
+	plan    models.Plan
+}
+
+// rateLimit returns the rate limiting middleware charging units quota units
+// per request
+func rateLimit(userStore models.UserStore, orgStore models.OrganizationStore, limiter *ratelimit.Limiter, units int) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			apiKey, ok := r.Context().Value("apiKey").(*models.APIKey)
+			if !ok {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			var account, planName string
+			if apiKey.OrgID != 0 {
+				org, err := orgStore.GetOrganization(apiKey.OrgID)
+				if err != nil {
+					slog.ErrorContext(r.Context(), "error getting API key organization", "error", err)
+					respondAPIError(w, "Internal server error", http.StatusInternalServerError)
+					return
+				}
+				account, planName = ratelimit.OrgAccount(org.ID), org.Plan
+			} else {
+				user, err := userStore.GetUserByID(apiKey.UserID)
+				if err != nil {
+					slog.ErrorContext(r.Context(), "error getting API key owner", "error", err)
+					respondAPIError(w, "Internal server error", http.StatusInternalServerError)
+					return
+				}
+
+				if user.Suspended() {
+					respondAPIError(w, "Account suspended", http.StatusForbidden)
+					return
+				}
+				account, planName = ratelimit.UserAccount(user.ID), user.Plan
+			}
+
+			plan := models.GetPlan(planName)
+			decision, err := limiter.AllowN(apiKey.ID, account, plan, time.Now(), units)
+			if err != nil {
+				slog.ErrorContext(r.Context(), "error reading usage for rate limiting", "error", err)
+				respondAPIError(w, "Internal server error", http.StatusInternalServerError)
+				return
+			}
+			if !allowed(w, decision) {
+				return
+			}
+
+			quota := &quotaAccount{limiter: limiter, account: account, plan: plan}
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), "quota", quota)))
+		})
+	}
+}
+
+// ChargeQuota charges n quota units for a request admitted by
+// BatchRateLimitMiddleware, and records them in the request's usage. If they
+// do not fit in the remaining monthly quota it writes a 429 response and
+// returns false. Requests without a quota, such as keyless ones, are not
+// charged.
+func ChargeQuota(w http.ResponseWriter, r *http.Request, n int) bool {
+	quota, ok := r.Context().Value("quota").(*quotaAccount)
+	if !ok {
+		return true
+	}
+
+	decision, err := quota.limiter.Charge(quota.account, quota.plan, time.Now(), n)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "error reading usage for rate limiting", "error", err)
+		respondAPIError(w, "Internal server error", http.StatusInternalServerError)
+		return false
+	}
+	if !allowed(w, decision) {
+		return false
+	}
+
+	if cost, ok := r.Context().Value("usageCost").(*usageCost); ok {
+		cost.units = n
+	}
+	return true
+}
+
+// allowed sets the rate limit headers of decision and, if it rejects the
+// request, writes a 429 response
+func allowed(w http.ResponseWriter, decision ratelimit.Decision) bool {
+	setRateLimitHeaders(w, decision)
+	if decision.Allowed {
+		return true
+	}
+
+	retryAfter := int(math.Ceil(decision.RetryAfter.Seconds()))
+	if retryAfter < 1 {
+		retryAfter = 1
+	}
+	w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+	respondAPIError(w, decision.Reason, http.StatusTooManyRequests)
+	return false
+}
+
+// setRateLimitHeaders reports the per-second and monthly limits. Unlimited
+// dimensions are omitted.
+func setRateLimitHeaders(w http.ResponseWriter, d ratelimit.Decision) {
+	h := w.Header()
+	if d.SecondLimit > 0 {
+		h.Set("X-RateLimit-Limit-Second", strconv.Itoa(d.SecondLimit))
+		h.Set("X-RateLimit-Remaining-Second", strconv.Itoa(d.SecondRemaining))
+	}
+	if d.MonthLimit > 0 {
+		h.Set("X-RateLimit-Limit", strconv.Itoa(d.MonthLimit))
+		h.Set("X-RateLimit-Remaining", strconv.Itoa(d.MonthRemaining))
+		h.Set("X-RateLimit-Reset", strconv.FormatInt(d.MonthReset.Unix(), 10))
+	}
+}
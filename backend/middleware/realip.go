@@ -0,0 +1,34 @@
+package middleware
+
+import (
+	"net"
+	"net/http"
+	"strings"
+)
+
+// RealIPMiddleware sets r.RemoteAddr to the client address reported by a
+// reverse proxy in X-Forwarded-For. Only enable it when the server is
+// reachable solely through a proxy that sets the header, since clients can
+// otherwise forge it. The proxy's own entry (the last one) is used.
+func RealIPMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if ip := forwardedFor(r); ip != "" {
+			r.RemoteAddr = net.JoinHostPort(ip, "0")
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// forwardedFor returns the last valid address in X-Forwarded-For
+func forwardedFor(r *http.Request) string {
+	values := r.Header.Values("X-Forwarded-For")
+	if len(values) == 0 {
+		return ""
+	}
+	parts := strings.Split(values[len(values)-1], ",")
+	ip := net.ParseIP(strings.TrimSpace(parts[len(parts)-1]))
+	if ip == nil {
+		return ""
+	}
+	return ip.String()
+}
@@ -0,0 +1,50 @@
+package middleware
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"latlongapi/backend/logging"
+	"net/http"
+)
+
+// maxRequestIDLength bounds the client-supplied request IDs that are kept
+const maxRequestIDLength = 128
+
+// RequestIDMiddleware gives every request an ID, taken from the X-Request-ID
+// header when the client or a proxy sent a usable one and generated
+// otherwise. The ID is echoed in the response header and carried in the
+// request context for logging, along with logging.Fields that later
+// middleware fill in.
+func RequestIDMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get("X-Request-ID")
+		if !validRequestID(id) {
+			id = newRequestID()
+		}
+
+		w.Header().Set("X-Request-ID", id)
+		ctx := logging.WithFields(logging.WithRequestID(r.Context(), id))
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// validRequestID reports whether id is short and printable ASCII, so that it
+// is safe to log and echo back
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] <= ' ' || id[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+// newRequestID returns a random 128-bit ID in hex
+func newRequestID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
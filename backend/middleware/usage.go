@@ -0,0 +1,65 @@
+package middleware
+
+import (
+	"context"
+	"latlongapi/backend/models"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// UsageMiddleware records every request made with an API key in the usage
+// store. It must run after APIKeyMiddleware, which puts the key in context.
+func UsageMiddleware(usageStore models.UsageStore) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			apiKey, ok := r.Context().Value("apiKey").(*models.APIKey)
+			if !ok || r.Method == http.MethodOptions {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			start := time.Now()
+			rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+			cost := &usageCost{units: 1}
+			next.ServeHTTP(rec, r.WithContext(context.WithValue(r.Context(), "usageCost", cost)))
+
+			err := usageStore.RecordUsage(models.UsageRecord{
+				UserID:    apiKey.UserID,
+				OrgID:     apiKey.OrgID,
+				APIKeyID:  apiKey.ID,
+				Endpoint:  r.URL.Path,
+				Timestamp: start,
+				Status:    rec.status,
+				Latency:   time.Since(start),
+				CacheHit:  w.Header().Get("X-Cache") == "HIT",
+				Units:     cost.units,
+			})
+			if err != nil {
+				slog.ErrorContext(r.Context(), "error recording usage", "error", err)
+			}
+		})
+	}
+}
+
+// usageCost holds the quota units a metered request is recorded with.
+// ChargeQuota raises it to the number of items of a batch.
+type usageCost struct {
+	units int
+}
+
+// statusRecorder wraps an http.ResponseWriter to capture the status code
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (rec *statusRecorder) WriteHeader(code int) {
+	rec.status = code
+	rec.ResponseWriter.WriteHeader(code)
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer
+func (rec *statusRecorder) Unwrap() http.ResponseWriter {
+	return rec.ResponseWriter
+}
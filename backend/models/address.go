@@ -0,0 +1,143 @@
+package models
+
+import "strings"
+
+// Address holds the components of a geocoded address, named after
+// Nominatim's address keys. Unknown components are omitted from JSON.
+type Address struct {
+	HouseNumber   string `json:"house_number,omitempty"`
+	HouseName     string `json:"house_name,omitempty"`
+	Road          string `json:"road,omitempty"`
+	Neighbourhood string `json:"neighbourhood,omitempty"`
+	Quarter       string `json:"quarter,omitempty"`
+	Suburb        string `json:"suburb,omitempty"`
+	CityDistrict  string `json:"city_district,omitempty"`
+	Hamlet        string `json:"hamlet,omitempty"`
+	Village       string `json:"village,omitempty"`
+	Town          string `json:"town,omitempty"`
+	// City is the city, or the town, village or hamlet when the place has no city
+	City          string `json:"city,omitempty"`
+	Municipality  string `json:"municipality,omitempty"`
+	County        string `json:"county,omitempty"`
+	StateDistrict string `json:"state_district,omitempty"`
+	State         string `json:"state,omitempty"`
+	Region        string `json:"region,omitempty"`
+	Postcode      string `json:"postcode,omitempty"`
+	Country       string `json:"country,omitempty"`
+	CountryCode   string `json:"country_code,omitempty"` // ISO 3166-1 alpha-2, lower case
+}
+
+// NewAddress builds an Address from Nominatim-style address components
+func NewAddress(components map[string]string) Address {
+	a := Address{
+		HouseNumber:   components["house_number"],
+		HouseName:     components["house_name"],
+		Road:          components["road"],
+		Neighbourhood: components["neighbourhood"],
+		Quarter:       components["quarter"],
+		Suburb:        components["suburb"],
+		CityDistrict:  components["city_district"],
+		Hamlet:        components["hamlet"],
+		Village:       components["village"],
+		Town:          components["town"],
+		City:          components["city"],
+		Municipality:  components["municipality"],
+		County:        components["county"],
+		StateDistrict: components["state_district"],
+		State:         components["state"],
+		Region:        components["region"],
+		Postcode:      components["postcode"],
+		Country:       components["country"],
+		CountryCode:   components["country_code"],
+	}
+
+	// Fall back to the closest smaller settlement
+	if a.City == "" {
+		switch {
+		case a.Town != "":
+			a.City = a.Town
+		case a.Village != "":
+			a.City = a.Village
+		case a.Hamlet != "":
+			a.City = a.Hamlet
+		}
+	}
+
+	return a
+}
+
+// Format joins the main components into a single comma-separated line
+func (a Address) Format() string {
+	var parts []string
+	for _, part := range []string{a.HouseNumber, a.Road, a.City, a.State, a.Country} {
+		if part != "" {
+			parts = append(parts, part)
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+// BoundingBox is the extent of a place in decimal degrees
+type BoundingBox struct {
+	South float64 `json:"south"`
+	North float64 `json:"north"`
+	West  float64 `json:"west"`
+	East  float64 `json:"east"`
+}
+
+// Place is a geocoded location. Address components are flattened into the
+// top level of the JSON object alongside the formatted address.
+type Place struct {
+	Latitude         float64 `json:"latitude"`
+	Longitude        float64 `json:"longitude"`
+	FormattedAddress string  `json:"address,omitempty"`
+	Address
+	BoundingBox *BoundingBox `json:"bounding_box,omitempty"`
+	OSMType     string       `json:"osm_type,omitempty"` // node, way or relation
+	OSMID       int64        `json:"osm_id,omitempty"`
+	PlaceRank   int          `json:"place_rank,omitempty"` // 0 (country) to 30 (building)
+	Importance  float64      `json:"importance,omitempty"`
+}
+
+// ConvertResponse is the /api/v1/convert response. Latitude and Longitude
+// echo the requested coordinates rather than those of the matched place.
+type ConvertResponse struct {
+	Place
+}
+
+// NewConvertResponse builds the response for a reverse geocoding request
+func NewConvertResponse(lat, lng float64, place *Place) ConvertResponse {
+	resp := ConvertResponse{Place: *place}
+	resp.Latitude = lat
+	resp.Longitude = lng
+	return resp
+}
+
+// SearchResult is one ranked candidate of a forward geocoding request
+type SearchResult struct {
+	Rank int `json:"rank"` // 1 is the best match
+	Place
+}
+
+// SearchResponse is the /api/v1/search response
+type SearchResponse struct {
+	Query   string         `json:"query"`
+	Count   int            `json:"count"`
+	Results []SearchResult `json:"results"`
+}
+
+// BatchResult is the outcome of one item of a batch conversion. Exactly one
+// of Error and the embedded response is set.
+type BatchResult struct {
+	Index int    `json:"index"`
+	Error string `json:"error,omitempty"`
+	*ConvertResponse
+}
+
+// BatchResponse is the /api/v1/convert/batch response for JSON requests
+type BatchResponse struct {
+	Count     int           `json:"count"`
+	Succeeded int           `json:"succeeded"`
+	Failed    int           `json:"failed"`
+	Results   []BatchResult `json:"results"`
+}
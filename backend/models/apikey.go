@@ -0,0 +1,38 @@
+package models
+
+import "time"
+
+// APIKey represents an API key issued to a user or an organization; exactly
+// one of UserID and OrgID is set. Only a hash of the key is stored; the
+// plaintext key is shown once at creation.
+type APIKey struct {
+	ID         int        `json:"id"`
+	UserID     int        `json:"user_id,omitempty"`
+	OrgID      int        `json:"org_id,omitempty"`
+	Label      string     `json:"label"`
+	Prefix     string     `json:"prefix"` // Leading characters of the key, for identification
+	Hash       string     `json:"-"`      // Never serialize key hash
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+}
+
+// Revoked reports whether the key has been revoked
+func (k *APIKey) Revoked() bool {
+	return k.RevokedAt != nil
+}
+
+// APIKeyStore defines the interface for API key storage operations
+type APIKeyStore interface {
+	CreateAPIKey(userID int, label, prefix, hash string) (*APIKey, error)
+	ListAPIKeys(userID int) ([]*APIKey, error)
+	GetAPIKeyByHash(hash string) (*APIKey, error)
+	UpdateAPIKeyLabel(userID, id int, label string) (*APIKey, error)
+	RevokeAPIKey(userID, id int) (*APIKey, error)
+	TouchAPIKey(id int, usedAt time.Time) error
+
+	CreateOrgAPIKey(orgID int, label, prefix, hash string) (*APIKey, error)
+	ListOrgAPIKeys(orgID int) ([]*APIKey, error)
+	UpdateOrgAPIKeyLabel(orgID, id int, label string) (*APIKey, error)
+	RevokeOrgAPIKey(orgID, id int) (*APIKey, error)
+}
@@ -0,0 +1,20 @@
+package models
+
+import "time"
+
+// Identity links a user to an account at an external OpenID Connect provider
+type Identity struct {
+	ID        int       `json:"id"`
+	UserID    int       `json:"user_id"`
+	Provider  string    `json:"provider"`
+	Subject   string    `json:"subject"` // The provider's stable user ID (sub claim)
+	Email     string    `json:"email"`   // Email reported by the provider when linked
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// IdentityStore defines the interface for external identity storage
+type IdentityStore interface {
+	CreateIdentity(userID int, provider, subject, email string) (*Identity, error)
+	GetIdentity(provider, subject string) (*Identity, error)
+	ListIdentities(userID int) ([]*Identity, error)
+}
@@ -0,0 +1,17 @@
+package models
+
+// MFAStore defines the interface for two-factor authentication storage
+type MFAStore interface {
+	// SetTOTPSecret starts enrollment with a new, unconfirmed secret
+	SetTOTPSecret(userID int, secret string) error
+	// EnableTOTP confirms enrollment, recording the time step of the
+	// confirming code and replacing the user's recovery codes
+	EnableTOTP(userID int, step int64, recoveryCodeHashes []string) error
+	// DisableTOTP removes the secret and recovery codes
+	DisableTOTP(userID int) error
+	// UseTOTPStep records the time step of an accepted code, returning false
+	// if it is not newer than the last one so codes cannot be replayed
+	UseTOTPStep(userID int, step int64) (bool, error)
+	// UseRecoveryCode removes a recovery code, returning false if it does not exist
+	UseRecoveryCode(userID int, hash string) (bool, error)
+}
@@ -0,0 +1,91 @@
+package models
+
+import "time"
+
+// Organization membership roles. Owners manage everything, including other
+// owners; admins manage members, invitations and API keys; members can view
+// the organization and its keys.
+const (
+	OrgRoleOwner  = "owner"
+	OrgRoleAdmin  = "admin"
+	OrgRoleMember = "member"
+)
+
+// OrgRoles ranks the valid organization roles, higher ranks including the
+// permissions of lower ones
+var OrgRoles = map[string]int{
+	OrgRoleMember: 1,
+	OrgRoleAdmin:  2,
+	OrgRoleOwner:  3,
+}
+
+// Organization is a team of users sharing a plan and API keys
+type Organization struct {
+	ID        int       `json:"id"`
+	Name      string    `json:"name"`
+	Plan      string    `json:"plan"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// UserOrganization is an organization together with a user's role in it
+type UserOrganization struct {
+	Organization
+	Role string `json:"role"`
+}
+
+// Membership is a user's role in an organization
+type Membership struct {
+	OrgID     int       `json:"org_id"`
+	UserID    int       `json:"user_id"`
+	Email     string    `json:"email"` // The member's email address, for display
+	Role      string    `json:"role"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// HasRole reports whether the membership grants at least role
+func (m *Membership) HasRole(role string) bool {
+	return OrgRoles[m.Role] >= OrgRoles[role]
+}
+
+// Invitation offers membership of an organization to an email address. Only
+// a hash of the emailed token is stored.
+type Invitation struct {
+	ID        int       `json:"id"`
+	OrgID     int       `json:"org_id"`
+	Email     string    `json:"email"`
+	Role      string    `json:"role"`
+	InvitedBy int       `json:"invited_by"` // User ID of the member who sent the invitation
+	Hash      string    `json:"-"`          // Never serialize token hash
+	CreatedAt time.Time `json:"created_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// OrganizationStore defines the interface for organization storage
+type OrganizationStore interface {
+	// CreateOrganization creates an organization on the free plan with
+	// ownerID as its first owner
+	CreateOrganization(name string, ownerID int) (*Organization, error)
+	GetOrganization(id int) (*Organization, error)
+	// ListOrganizations returns the organizations a user belongs to, oldest first
+	ListOrganizations(userID int) ([]*UserOrganization, error)
+	// UpdateOrganization saves an organization's name and plan
+	UpdateOrganization(org *Organization) error
+	// DeleteOrganization removes an organization with its memberships,
+	// invitations, API keys and usage
+	DeleteOrganization(id int) error
+
+	GetMembership(orgID, userID int) (*Membership, error)
+	ListMembers(orgID int) ([]*Membership, error)
+	UpdateMemberRole(orgID, userID int, role string) error
+	RemoveMember(orgID, userID int) error
+
+	// CreateInvitation stores an invitation, replacing any earlier
+	// invitation of the same address to the organization
+	CreateInvitation(orgID int, email, role string, invitedBy int, hash string, expiresAt time.Time) (*Invitation, error)
+	GetInvitationByHash(hash string) (*Invitation, error)
+	ListInvitations(orgID int) ([]*Invitation, error)
+	DeleteInvitation(orgID, id int) error
+	// AcceptInvitation deletes an invitation and adds userID to its
+	// organization with the invited role
+	AcceptInvitation(id, userID int) (*Membership, error)
+}
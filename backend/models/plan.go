@@ -0,0 +1,32 @@
+package models
+
+// Plan names
+const (
+	PlanFree       = "free"
+	PlanPro        = "pro"
+	PlanScale      = "scale"
+	PlanEnterprise = "enterprise"
+)
+
+// Plan describes the API limits of a pricing tier. A zero limit means unlimited.
+type Plan struct {
+	Name              string `json:"name"`
+	MonthlyRequests   int    `json:"monthly_requests"`
+	RequestsPerSecond int    `json:"requests_per_second"`
+}
+
+// Plans lists the available pricing tiers, matching pricing.html
+var Plans = map[string]Plan{
+	PlanFree:       {Name: PlanFree, MonthlyRequests: 5000, RequestsPerSecond: 2},
+	PlanPro:        {Name: PlanPro, MonthlyRequests: 500000, RequestsPerSecond: 20},
+	PlanScale:      {Name: PlanScale, MonthlyRequests: 5000000, RequestsPerSecond: 100},
+	PlanEnterprise: {Name: PlanEnterprise},
+}
+
+// GetPlan returns the named plan, falling back to the free plan for unknown names
+func GetPlan(name string) Plan {
+	if plan, ok := Plans[name]; ok {
+		return plan
+	}
+	return Plans[PlanFree]
+}
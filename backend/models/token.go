@@ -0,0 +1,37 @@
+package models
+
+import "time"
+
+// RefreshToken is a single-use token that can be exchanged for a new access
+// token. Each exchange revokes it and issues a replacement in the same session.
+type RefreshToken struct {
+	ID        int        `json:"id"`
+	UserID    int        `json:"user_id"`
+	SessionID string     `json:"session_id"`
+	Hash      string     `json:"-"` // Never serialize token hash
+	CreatedAt time.Time  `json:"created_at"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	RevokedAt *time.Time `json:"revoked_at,omitempty"`
+}
+
+// TokenStore defines the interface for refresh token and revocation storage
+type TokenStore interface {
+	CreateRefreshToken(userID int, sessionID, hash string, expiresAt time.Time) (*RefreshToken, error)
+	GetRefreshTokenByHash(hash string) (*RefreshToken, error)
+	// RevokeRefreshToken revokes a refresh token, returning false if it was already revoked
+	RevokeRefreshToken(id int) (bool, error)
+	// RevokeSession revokes a session's refresh tokens and keeps the session ID
+	// on the revocation list until the given time
+	RevokeSession(sessionID string, until time.Time) error
+	// RevokeUserSessions revokes every session of a user
+	RevokeUserSessions(userID int, until time.Time) error
+	// RevokeToken keeps a token or session ID on the revocation list until the given time
+	RevokeToken(id string, until time.Time) error
+	IsTokenRevoked(id string) (bool, error)
+	// ConsumeToken records a single-use token ID until the given time,
+	// returning false if it was already recorded
+	ConsumeToken(id string, until time.Time) (bool, error)
+	// CountActiveSessions counts sessions with an unrevoked refresh token
+	// that has not expired by now
+	CountActiveSessions(now time.Time) (int, error)
+}
@@ -0,0 +1,29 @@
+package models
+
+import "time"
+
+// UsageRecord is a single metered API request. Requests made with an
+// organization's key are recorded against the organization instead of a user.
+type UsageRecord struct {
+	UserID    int           `json:"user_id,omitempty"`
+	OrgID     int           `json:"org_id,omitempty"`
+	APIKeyID  int           `json:"api_key_id"`
+	Endpoint  string        `json:"endpoint"`
+	Timestamp time.Time     `json:"timestamp"`
+	Status    int           `json:"status"`
+	Latency   time.Duration `json:"latency"`
+	CacheHit  bool          `json:"cache_hit"`
+	Units     int           `json:"units"` // Quota units charged: the number of items of a batch, 1 otherwise
+}
+
+// UsageStore defines the interface for usage metering storage
+type UsageStore interface {
+	RecordUsage(record UsageRecord) error
+	ListUsage(userID int, since time.Time) ([]UsageRecord, error)
+	ListOrgUsage(orgID int, since time.Time) ([]UsageRecord, error)
+
+	// CountUsage and CountOrgUsage add up the quota units of the requests
+	// at or after since that were not rejected by rate limiting
+	CountUsage(userID int, since time.Time) (int, error)
+	CountOrgUsage(orgID int, since time.Time) (int, error)
+}
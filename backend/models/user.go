@@ -2,12 +2,64 @@ package models
 
 import "time"
 
+// Role names
+const (
+	RoleUser  = "user"
+	RoleAdmin = "admin"
+)
+
+// Roles lists the valid user roles
+var Roles = map[string]bool{
+	RoleUser:  true,
+	RoleAdmin: true,
+}
+
 // User represents a user in the system
 type User struct {
 	ID        int       `json:"id"`
 	Email     string    `json:"email"`
 	Password  string    `json:"-"` // Never serialize password
+	Plan      string    `json:"plan"`
+	Role      string    `json:"role"`
 	CreatedAt time.Time `json:"created_at"`
+
+	// Set when the role was first changed, by an admin or by promotion from
+	// ADMIN_EMAILS, so that an admin's demotion is not undone at next login
+	RoleChangedAt *time.Time `json:"role_changed_at,omitempty"`
+
+	// Suspended accounts cannot log in or use their API keys
+	SuspendedAt *time.Time `json:"suspended_at,omitempty"`
+
+	EmailVerifiedAt *time.Time `json:"email_verified_at,omitempty"`
+
+	// TOTP two-factor authentication. The secret is set on enrollment and
+	// only takes effect once the user confirms a code.
+	TOTPSecret    string     `json:"-"` // Never serialize TOTP secret
+	TOTPEnabledAt *time.Time `json:"totp_enabled_at,omitempty"`
+}
+
+// EmailVerified reports whether the user has confirmed their email address
+func (u *User) EmailVerified() bool {
+	return u.EmailVerifiedAt != nil
+}
+
+// TOTPEnabled reports whether logins require a TOTP code
+func (u *User) TOTPEnabled() bool {
+	return u.TOTPEnabledAt != nil
+}
+
+// Suspended reports whether the account has been suspended by an admin
+func (u *User) Suspended() bool {
+	return u.SuspendedAt != nil
+}
+
+// UserQuery selects and pages the users returned by ListUsers
+type UserQuery struct {
+	Search string // Case-insensitive substring of the email address
+	Role   string // Only users with this role, if set
+	Plan   string // Only users on this plan, if set
+	Offset int
+	Limit  int // Zero means no limit
 }
 
 // UserStore defines the interface for user storage operations
@@ -15,5 +67,17 @@ type UserStore interface {
 	CreateUser(email, hashedPassword string) (*User, error)
 	GetUserByEmail(email string) (*User, error)
 	GetUserByID(id int) (*User, error)
+	UpdatePassword(id int, hashedPassword string) error
+	MarkEmailVerified(id int) error
+	// ListUsers returns one page of the users matching query, oldest first,
+	// and the total number of matches
+	ListUsers(query UserQuery) ([]*User, int, error)
+	// UpdateUser saves a user's email, plan, role and suspension. Passwords
+	// and two-factor settings have their own methods.
+	UpdateUser(user *User) error
+	// ChangeEmail replaces a user's email address and marks it unverified
+	ChangeEmail(id int, email string) error
+	// DeleteUser removes a user along with their API keys, usage, sessions,
+	// linked identities and organization memberships
+	DeleteUser(id int) error
 }
-
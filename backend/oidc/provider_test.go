@@ -0,0 +1,165 @@
+package oidc
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"latlongapi/backend/oidc/oidctest"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+var alice = oidctest.Identity{Subject: "alice-1", Email: "alice@example.com", EmailVerified: true}
+
+// newTestProvider starts a mock provider and a client configured for it
+func newTestProvider(t *testing.T, secret string) (*oidctest.Server, *Provider) {
+	t.Helper()
+	srv := oidctest.NewServer("latlongapi", secret)
+	t.Cleanup(srv.Close)
+
+	p := NewProvider(Config{
+		Name:         "test",
+		Issuer:       srv.URL,
+		ClientID:     "latlongapi",
+		ClientSecret: secret,
+		RedirectURL:  "http://localhost/api/auth/oidc/test/callback",
+	})
+	return srv, p
+}
+
+// signIn runs the flow for id and exchanges the code with verifier and nonce,
+// which are the ones sent in the authorization request unless given
+func signIn(t *testing.T, srv *oidctest.Server, p *Provider, id oidctest.Identity, edit func(jwt.MapClaims), verifier, nonce string) (*Claims, error) {
+	t.Helper()
+	ctx := context.Background()
+
+	authURL, err := p.AuthCodeURL(ctx, "state", "nonce", "verifier")
+	if err != nil {
+		t.Fatalf("AuthCodeURL: %v", err)
+	}
+	code, err := srv.Authorize(authURL, id, edit)
+	if err != nil {
+		t.Fatalf("Authorize: %v", err)
+	}
+
+	if verifier == "" {
+		verifier = "verifier"
+	}
+	if nonce == "" {
+		nonce = "nonce"
+	}
+	return p.Exchange(ctx, code, verifier, nonce)
+}
+
+func TestExchange(t *testing.T) {
+	for _, secret := range []string{"", "s3cret/with+chars"} {
+		srv, p := newTestProvider(t, secret)
+
+		claims, err := signIn(t, srv, p, alice, nil, "", "")
+		if err != nil {
+			t.Fatalf("secret %q: Exchange: %v", secret, err)
+		}
+		if claims.Subject != alice.Subject || claims.Email != alice.Email || !claims.EmailVerified {
+			t.Errorf("secret %q: got claims %+v, want %+v", secret, claims, alice)
+		}
+	}
+}
+
+func TestExchangeRejectsPKCEMismatch(t *testing.T) {
+	srv, p := newTestProvider(t, "")
+
+	_, err := signIn(t, srv, p, alice, nil, "other-verifier", "")
+	if !errors.Is(err, ErrTokenExchange) {
+		t.Errorf("got error %v, want %v", err, ErrTokenExchange)
+	}
+}
+
+func TestExchangeRejectsReusedCode(t *testing.T) {
+	srv, p := newTestProvider(t, "")
+	ctx := context.Background()
+
+	authURL, err := p.AuthCodeURL(ctx, "state", "nonce", "verifier")
+	if err != nil {
+		t.Fatalf("AuthCodeURL: %v", err)
+	}
+	code, err := srv.Authorize(authURL, alice, nil)
+	if err != nil {
+		t.Fatalf("Authorize: %v", err)
+	}
+
+	if _, err := p.Exchange(ctx, code, "verifier", "nonce"); err != nil {
+		t.Fatalf("first Exchange: %v", err)
+	}
+	if _, err := p.Exchange(ctx, code, "verifier", "nonce"); !errors.Is(err, ErrTokenExchange) {
+		t.Errorf("second Exchange: got error %v, want %v", err, ErrTokenExchange)
+	}
+}
+
+func TestExchangeRejectsInvalidIDToken(t *testing.T) {
+	tests := []struct {
+		name  string
+		edit  func(jwt.MapClaims)
+		nonce string
+	}{
+		{name: "nonce mismatch", nonce: "other-nonce"},
+		{name: "missing nonce", edit: func(c jwt.MapClaims) { delete(c, "nonce") }},
+		{name: "wrong audience", edit: func(c jwt.MapClaims) { c["aud"] = "someone-else" }},
+		{name: "wrong issuer", edit: func(c jwt.MapClaims) { c["iss"] = "https://evil.example.com" }},
+		{name: "expired", edit: func(c jwt.MapClaims) { c["exp"] = time.Now().Add(-time.Hour).Unix() }},
+		{name: "no expiry", edit: func(c jwt.MapClaims) { delete(c, "exp") }},
+		{name: "missing subject", edit: func(c jwt.MapClaims) { delete(c, "sub") }},
+		{
+			name: "several audiences without azp",
+			edit: func(c jwt.MapClaims) { c["aud"] = []string{"latlongapi", "someone-else"} },
+		},
+		{
+			name: "issued to another party",
+			edit: func(c jwt.MapClaims) {
+				c["aud"] = []string{"latlongapi", "someone-else"}
+				c["azp"] = "someone-else"
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, p := newTestProvider(t, "")
+
+			_, err := signIn(t, srv, p, alice, tt.edit, "", tt.nonce)
+			if !errors.Is(err, ErrInvalidIDToken) {
+				t.Errorf("got error %v, want %v", err, ErrInvalidIDToken)
+			}
+		})
+	}
+}
+
+func TestExchangeAcceptsSeveralAudiencesWithAZP(t *testing.T) {
+	srv, p := newTestProvider(t, "")
+
+	_, err := signIn(t, srv, p, alice, func(c jwt.MapClaims) {
+		c["aud"] = []string{"latlongapi", "someone-else"}
+		c["azp"] = "latlongapi"
+	}, "", "")
+	if err != nil {
+		t.Errorf("Exchange: %v", err)
+	}
+}
+
+func TestDiscoveryRejectsIssuerMismatch(t *testing.T) {
+	srv := oidctest.NewServer("latlongapi", "")
+	defer srv.Close()
+
+	// Reached through a different host name than the issuer it reports
+	_, port, _ := net.SplitHostPort(srv.Listener.Addr().String())
+	p := NewProvider(Config{
+		Name:     "test",
+		Issuer:   "http://localhost:" + port,
+		ClientID: "latlongapi",
+	})
+	if _, err := p.AuthCodeURL(context.Background(), "state", "nonce", "verifier"); !errors.Is(err, ErrDiscovery) {
+		t.Errorf("got error %v, want %v", err, ErrDiscovery)
+	}
+}
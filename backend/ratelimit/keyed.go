@@ -0,0 +1,69 @@
+package ratelimit
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// KeyLimiter allows each key, such as a client address, up to limit events
+// per period. Allowance is refilled continuously, so a key that has used up
+// its limit gets one more event every period/limit. State is kept in memory,
+// so each server instance has its own.
+type KeyLimiter struct {
+	rate   float64 // events per second
+	burst  float64
+	period time.Duration
+
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastPrune time.Time
+}
+
+// NewKeyLimiter creates a limiter allowing limit events per period for each key
+func NewKeyLimiter(limit int, period time.Duration) *KeyLimiter {
+	return &KeyLimiter{
+		rate:    float64(limit) / period.Seconds(),
+		burst:   float64(limit),
+		period:  period,
+		buckets: make(map[string]*bucket),
+	}
+}
+
+// Allow records an event for key if it is within the limit. Otherwise it
+// returns false and how long until the key may try again.
+func (l *KeyLimiter) Allow(key string, now time.Time) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.prune(now)
+
+	b := l.buckets[key]
+	if b == nil {
+		b = &bucket{tokens: l.burst, last: now}
+		l.buckets[key] = b
+	}
+	b.tokens = math.Min(l.burst, b.tokens+now.Sub(b.last).Seconds()*l.rate)
+	b.last = now
+
+	if b.tokens < 1 {
+		return false, time.Duration((1 - b.tokens) / l.rate * float64(time.Second))
+	}
+	b.tokens--
+	return true, 0
+}
+
+// prune forgets keys that have been idle long enough to be fully refilled,
+// at most once per period
+func (l *KeyLimiter) prune(now time.Time) {
+	if now.Sub(l.lastPrune) < l.period {
+		return
+	}
+	l.lastPrune = now
+
+	for key, b := range l.buckets {
+		if now.Sub(b.last) >= l.period {
+			delete(l.buckets, key)
+		}
+	}
+}
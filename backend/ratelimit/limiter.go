@@ -0,0 +1,235 @@
+package ratelimit
+
+import (
+	"fmt"
+	"latlongapi/backend/models"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Decision is the outcome of a rate limit check
+type Decision struct {
+	Allowed bool
+
+	// Per-second limit for the API key (zero when unlimited)
+	SecondLimit     int
+	SecondRemaining int
+
+	// Monthly quota for the user or organization (zero when unlimited)
+	MonthLimit     int
+	MonthRemaining int
+	MonthReset     time.Time // Start of the next calendar month (UTC)
+
+	// RetryAfter is set when the request was rejected
+	RetryAfter time.Duration
+	Reason     string
+}
+
+// bucket is a non-blocking token bucket refilled at rate tokens per second
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// monthCounter counts requests within one calendar month
+type monthCounter struct {
+	month time.Time
+	count int
+}
+
+// Limiter enforces plan limits: a per-second rate for each API key and a
+// monthly request quota for each account, shared by all of its keys. An
+// account is a user or an organization, see UserAccount and OrgAccount.
+//
+// Monthly counts are kept in memory. Each account's count is seeded from the
+// usage store the first time the account is seen in a month, so quotas
+// survive restarts.
+type Limiter struct {
+	usageStore models.UsageStore
+
+	mu      sync.Mutex
+	buckets map[int]*bucket          // api key id -> bucket
+	months  map[string]*monthCounter // account -> counter
+}
+
+// NewLimiter creates a limiter seeding monthly counts from usageStore
+func NewLimiter(usageStore models.UsageStore) *Limiter {
+	return &Limiter{
+		usageStore: usageStore,
+		buckets:    make(map[int]*bucket),
+		months:     make(map[string]*monthCounter),
+	}
+}
+
+// UserAccount names the quota account of a user's personal keys
+func UserAccount(userID int) string {
+	return "user:" + strconv.Itoa(userID)
+}
+
+// OrgAccount names the quota account shared by an organization's keys
+func OrgAccount(orgID int) string {
+	return "org:" + strconv.Itoa(orgID)
+}
+
+// Allow checks and records one request made with keyID against account's
+// quota on plan. It returns an error only if the account's usage so far this
+// month could not be read.
+func (l *Limiter) Allow(keyID int, account string, plan models.Plan, now time.Time) (Decision, error) {
+	return l.AllowN(keyID, account, plan, now, 1)
+}
+
+// AllowN is Allow for a request charged n quota units. With n = 0 it only
+// checks that some quota is left, for requests whose units are charged with
+// Charge once they are known.
+func (l *Limiter) AllowN(keyID int, account string, plan models.Plan, now time.Time, n int) (Decision, error) {
+	month := startOfMonth(now)
+	counter, err := l.lockCounter(account, month)
+	if err != nil {
+		return Decision{}, err
+	}
+	defer l.mu.Unlock()
+
+	d := Decision{
+		Allowed:     true,
+		SecondLimit: plan.RequestsPerSecond,
+		MonthLimit:  plan.MonthlyRequests,
+		MonthReset:  month.AddDate(0, 1, 0),
+	}
+
+	// Monthly quota
+	if !checkMonth(&d, plan, counter, now, max(n, 1)) {
+		return d, nil
+	}
+
+	// Per-second rate
+	if plan.RequestsPerSecond > 0 {
+		rate := float64(plan.RequestsPerSecond)
+		b := l.buckets[keyID]
+		if b == nil {
+			b = &bucket{tokens: rate, last: now}
+			l.buckets[keyID] = b
+		}
+		b.tokens = math.Min(rate, b.tokens+now.Sub(b.last).Seconds()*rate)
+		b.last = now
+
+		if b.tokens < 1 {
+			d.Allowed = false
+			d.RetryAfter = time.Duration((1 - b.tokens) / rate * float64(time.Second))
+			d.Reason = "Rate limit exceeded"
+			d.MonthRemaining = remaining(plan.MonthlyRequests, counter.count)
+			return d, nil
+		}
+		b.tokens--
+		d.SecondRemaining = int(b.tokens)
+	}
+
+	counter.count += n
+	d.MonthRemaining = remaining(plan.MonthlyRequests, counter.count)
+	return d, nil
+}
+
+// Charge checks and records n quota units against account's monthly quota
+// on plan, for a request admitted by AllowN with n = 0. The per-second rate
+// is not checked again, and the decision carries only the monthly fields.
+func (l *Limiter) Charge(account string, plan models.Plan, now time.Time, n int) (Decision, error) {
+	month := startOfMonth(now)
+	counter, err := l.lockCounter(account, month)
+	if err != nil {
+		return Decision{}, err
+	}
+	defer l.mu.Unlock()
+
+	d := Decision{
+		Allowed:    true,
+		MonthLimit: plan.MonthlyRequests,
+		MonthReset: month.AddDate(0, 1, 0),
+	}
+	if !checkMonth(&d, plan, counter, now, n) {
+		return d, nil
+	}
+
+	counter.count += n
+	d.MonthRemaining = remaining(plan.MonthlyRequests, counter.count)
+	return d, nil
+}
+
+// checkMonth rejects d if n more units do not fit in the monthly quota
+func checkMonth(d *Decision, plan models.Plan, counter *monthCounter, now time.Time, n int) bool {
+	if plan.MonthlyRequests <= 0 || counter.count+n <= plan.MonthlyRequests {
+		return true
+	}
+
+	d.Allowed = false
+	d.RetryAfter = d.MonthReset.Sub(now)
+	d.MonthRemaining = remaining(plan.MonthlyRequests, counter.count)
+	if counter.count >= plan.MonthlyRequests {
+		d.Reason = "Monthly request quota exceeded"
+	} else {
+		d.Reason = fmt.Sprintf("Request counts as %d requests, but only %d remain in the monthly quota", n, d.MonthRemaining)
+	}
+	return false
+}
+
+// lockCounter locks the limiter and returns account's counter for month. A
+// new counter is seeded from the usage store, which is read without the
+// lock held so that a slow store does not hold up other accounts. The lock
+// is held on return unless there is an error.
+func (l *Limiter) lockCounter(account string, month time.Time) (*monthCounter, error) {
+	l.mu.Lock()
+	counter := l.months[account]
+	if counter != nil && counter.month.Equal(month) {
+		return counter, nil
+	}
+	l.mu.Unlock()
+
+	seed, err := l.storedUsage(account, month)
+	if err != nil {
+		return nil, err
+	}
+
+	l.mu.Lock()
+	// A concurrent request may have created the counter meanwhile
+	counter = l.months[account]
+	if counter == nil || !counter.month.Equal(month) {
+		counter = &monthCounter{month: month, count: seed}
+		l.months[account] = counter
+	}
+	return counter, nil
+}
+
+// storedUsage returns the requests account has made since month began, as
+// recorded in the usage store
+func (l *Limiter) storedUsage(account string, month time.Time) (int, error) {
+	if l.usageStore == nil {
+		return 0, nil
+	}
+	kind, id, _ := strings.Cut(account, ":")
+	n, err := strconv.Atoi(id)
+	if err != nil {
+		return 0, err
+	}
+	if kind == "org" {
+		return l.usageStore.CountOrgUsage(n, month)
+	}
+	return l.usageStore.CountUsage(n, month)
+}
+
+// remaining returns how much of limit is left after used
+func remaining(limit, used int) int {
+	if limit <= 0 {
+		return 0
+	}
+	if used >= limit {
+		return 0
+	}
+	return limit - used
+}
+
+// startOfMonth returns midnight UTC on the first day of t's month
+func startOfMonth(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+}
@@ -0,0 +1,219 @@
+package ratelimit
+
+import (
+	"latlongapi/backend/models"
+	"latlongapi/backend/store"
+	"net/http"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// midMonth leaves room either side for offsets that stay in the month
+var midMonth = time.Date(2024, time.March, 15, 12, 0, 0, 0, time.UTC)
+
+func TestLimiterPerSecondRate(t *testing.T) {
+	plan := models.Plan{RequestsPerSecond: 2}
+	tests := []struct {
+		keyID      int
+		offset     time.Duration
+		allowed    bool
+		retryAfter time.Duration
+	}{
+		{1, 0, true, 0},
+		{1, 0, true, 0},
+		{1, 0, false, 500 * time.Millisecond}, // the burst is spent
+		{2, 0, true, 0},                       // each key has its own bucket
+		{1, 250 * time.Millisecond, false, 250 * time.Millisecond},
+		{1, 500 * time.Millisecond, true, 0}, // refilled at 2 per second
+		{1, 500 * time.Millisecond, false, 500 * time.Millisecond},
+		{1, 5 * time.Second, true, 0}, // refills no further than the burst
+		{1, 5 * time.Second, true, 0},
+		{1, 5 * time.Second, false, 500 * time.Millisecond},
+	}
+
+	l := NewLimiter(nil)
+	for i, tt := range tests {
+		d, err := l.Allow(tt.keyID, UserAccount(1), plan, midMonth.Add(tt.offset))
+		if err != nil {
+			t.Fatalf("%d: Allow: %v", i, err)
+		}
+		if d.Allowed != tt.allowed || d.RetryAfter != tt.retryAfter {
+			t.Errorf("%d: got allowed %v, retry after %s; want %v, %s", i, d.Allowed, d.RetryAfter, tt.allowed, tt.retryAfter)
+		}
+		if d.SecondLimit != 2 {
+			t.Errorf("%d: got per-second limit %d, want 2", i, d.SecondLimit)
+		}
+	}
+}
+
+func TestLimiterMonthlyQuota(t *testing.T) {
+	plan := models.Plan{MonthlyRequests: 3, RequestsPerSecond: 100}
+	nextMonth := time.Date(2024, time.April, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		keyID     int
+		at        time.Time
+		allowed   bool
+		remaining int
+	}{
+		{1, midMonth, true, 2},
+		{2, midMonth, true, 1}, // keys of one account share its quota
+		{1, midMonth, true, 0},
+		{2, midMonth, false, 0},
+		{1, nextMonth.Add(-time.Nanosecond), false, 0},
+		{1, nextMonth, true, 2}, // a new month starts afresh
+	}
+
+	l := NewLimiter(nil)
+	for i, tt := range tests {
+		d, err := l.Allow(tt.keyID, UserAccount(1), plan, tt.at)
+		if err != nil {
+			t.Fatalf("%d: Allow: %v", i, err)
+		}
+		if d.Allowed != tt.allowed || d.MonthRemaining != tt.remaining {
+			t.Errorf("%d: got allowed %v, %d remaining; want %v, %d", i, d.Allowed, d.MonthRemaining, tt.allowed, tt.remaining)
+		}
+		if !d.Allowed && (d.Reason != "Monthly request quota exceeded" || d.RetryAfter != nextMonth.Sub(tt.at)) {
+			t.Errorf("%d: got reason %q, retry after %s", i, d.Reason, d.RetryAfter)
+		}
+	}
+
+	// Other accounts are unaffected
+	if d, _ := l.Allow(3, OrgAccount(1), plan, midMonth); !d.Allowed {
+		t.Errorf("another account: got %+v", d)
+	}
+}
+
+func TestLimiterRateLimitedRequestsAreNotCharged(t *testing.T) {
+	plan := models.Plan{MonthlyRequests: 10, RequestsPerSecond: 1}
+	l := NewLimiter(nil)
+
+	for i, want := range []bool{true, false, false} {
+		d, err := l.Allow(1, UserAccount(1), plan, midMonth)
+		if err != nil {
+			t.Fatalf("Allow: %v", err)
+		}
+		if d.Allowed != want || d.MonthRemaining != 9 {
+			t.Errorf("%d: got allowed %v, %d remaining; want %v, 9", i, d.Allowed, d.MonthRemaining, want)
+		}
+	}
+}
+
+func TestLimiterUnits(t *testing.T) {
+	plan := models.Plan{MonthlyRequests: 10, RequestsPerSecond: 100}
+
+	// Each step either admits a request for n units with AllowN, or charges
+	// n units for an admitted request with Charge
+	type step struct {
+		charge    bool
+		n         int
+		allowed   bool
+		remaining int
+		reason    string
+	}
+	tests := []struct {
+		name  string
+		steps []step
+	}{
+		{"allow several units", []step{
+			{false, 4, true, 6, ""},
+			{false, 6, true, 0, ""},
+			{false, 1, false, 0, "Monthly request quota exceeded"},
+		}},
+		{"more units than remain", []step{
+			{false, 8, true, 2, ""},
+			{false, 3, false, 2, "Request counts as 3 requests, but only 2 remain in the monthly quota"},
+			{false, 2, true, 0, ""},
+		}},
+		{"check then charge", []step{
+			{false, 0, true, 10, ""}, // checks without charging
+			{true, 7, true, 3, ""},
+			{false, 0, true, 3, ""},
+			{true, 4, false, 3, "Request counts as 4 requests, but only 3 remain in the monthly quota"},
+			{true, 3, true, 0, ""},
+			{false, 0, false, 0, "Monthly request quota exceeded"},
+		}},
+	}
+
+	for _, tt := range tests {
+		l := NewLimiter(nil)
+		for i, s := range tt.steps {
+			var d Decision
+			var err error
+			if s.charge {
+				d, err = l.Charge(UserAccount(1), plan, midMonth, s.n)
+			} else {
+				d, err = l.AllowN(1, UserAccount(1), plan, midMonth, s.n)
+			}
+			if err != nil {
+				t.Fatalf("%s, step %d: %v", tt.name, i, err)
+			}
+			if d.Allowed != s.allowed || d.MonthRemaining != s.remaining || d.Reason != s.reason {
+				t.Errorf("%s, step %d: got allowed %v, %d remaining, reason %q; want %v, %d, %q",
+					tt.name, i, d.Allowed, d.MonthRemaining, d.Reason, s.allowed, s.remaining, s.reason)
+			}
+		}
+	}
+}
+
+func TestLimiterSeedsFromUsageStore(t *testing.T) {
+	sqliteStore, err := store.NewSQLiteStore(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("NewSQLiteStore: %v", err)
+	}
+	defer sqliteStore.Close()
+
+	for _, tt := range []struct {
+		name  string
+		store models.UsageStore
+	}{
+		{"memory", store.NewMemoryStore()},
+		{"sqlite", sqliteStore},
+	} {
+		// Usage this month that counts against the quota: 1 + 5 units for
+		// the user, 2 for the organization
+		records := []models.UsageRecord{
+			{UserID: 1, Timestamp: midMonth.Add(-time.Hour), Status: http.StatusOK, Units: 1},
+			{UserID: 1, Timestamp: midMonth.Add(-time.Minute), Status: http.StatusBadRequest, Units: 5},
+			{UserID: 1, Timestamp: midMonth.Add(-time.Second), Status: http.StatusTooManyRequests, Units: 1},
+			{UserID: 1, Timestamp: startOfMonth(midMonth).Add(-time.Nanosecond), Status: http.StatusOK, Units: 100},
+			{UserID: 2, Timestamp: midMonth.Add(-time.Hour), Status: http.StatusOK, Units: 100},
+			{UserID: 1, OrgID: 1, Timestamp: midMonth.Add(-time.Hour), Status: http.StatusOK, Units: 2},
+		}
+		for _, record := range records {
+			record.Endpoint = "/api/convert"
+			if err := tt.store.RecordUsage(record); err != nil {
+				t.Fatalf("%s: RecordUsage: %v", tt.name, err)
+			}
+		}
+
+		// A fresh limiter, as after a restart, picks up where the store left off
+		plan := models.Plan{MonthlyRequests: 10, RequestsPerSecond: 100}
+		l := NewLimiter(tt.store)
+		for _, c := range []struct {
+			account   string
+			remaining int
+		}{
+			{UserAccount(1), 3},
+			{OrgAccount(1), 7},
+			{UserAccount(3), 9},
+		} {
+			d, err := l.Allow(1, c.account, plan, midMonth)
+			if err != nil {
+				t.Fatalf("%s: %s: Allow: %v", tt.name, c.account, err)
+			}
+			if !d.Allowed || d.MonthRemaining != c.remaining {
+				t.Errorf("%s: %s: got allowed %v, %d remaining; want true, %d", tt.name, c.account, d.Allowed, d.MonthRemaining, c.remaining)
+			}
+		}
+
+		// The store is read once per account and month: later requests are
+		// counted in memory
+		if err := tt.store.RecordUsage(models.UsageRecord{UserID: 1, Endpoint: "/api/convert", Timestamp: midMonth, Status: http.StatusOK, Units: 1}); err != nil {
+			t.Fatalf("%s: RecordUsage: %v", tt.name, err)
+		}
+		if d, _ := l.Allow(1, UserAccount(1), plan, midMonth); d.MonthRemaining != 2 {
+			t.Errorf("%s: second request: got %d remaining, want 2", tt.name, d.MonthRemaining)
+		}
+	}
+}
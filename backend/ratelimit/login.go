@@ -0,0 +1,202 @@
+package ratelimit
+
+import (
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	maxBackoffShift  = 20
+	loginPrunePeriod = time.Minute
+)
+
+// LoginPolicy sets how failed logins from one source are throttled
+type LoginPolicy struct {
+	FreeAttempts     int // Failures allowed before backoff starts
+	LockoutThreshold int // Failures that trigger a lockout
+}
+
+// LoginGuardConfig holds the settings of a LoginGuard
+type LoginGuardConfig struct {
+	Account LoginPolicy // Failures against one email address, from anywhere
+	IP      LoginPolicy // Failures from one client address, against any account
+
+	BaseDelay       time.Duration // Backoff after the first failure past FreeAttempts, doubled for each further one
+	MaxDelay        time.Duration
+	LockoutDuration time.Duration
+	Window          time.Duration // Failures are forgotten after this long without a new one
+}
+
+// DefaultLoginGuardConfig returns the default login throttling settings
+func DefaultLoginGuardConfig() LoginGuardConfig {
+	return LoginGuardConfig{
+		Account:         LoginPolicy{FreeAttempts: 3, LockoutThreshold: 10},
+		IP:              LoginPolicy{FreeAttempts: 10, LockoutThreshold: 50},
+		BaseDelay:       time.Second,
+		MaxDelay:        5 * time.Minute,
+		LockoutDuration: 15 * time.Minute,
+		Window:          time.Hour,
+	}
+}
+
+// loginFailures tracks recent failed logins from one source
+type loginFailures struct {
+	count       int
+	last        time.Time
+	lockedUntil time.Time
+}
+
+// LoginGuard throttles password guessing. Failed logins are counted per
+// account and per client IP; past a few free attempts each further attempt
+// must wait exponentially longer, and enough failures lock the source out
+// for a while. State is kept in memory, so each server instance has its own.
+type LoginGuard struct {
+	cfg LoginGuardConfig
+
+	mu        sync.Mutex
+	failures  map[string]*loginFailures // "account:<email>" or "ip:<addr>" -> failures
+	lastPrune time.Time
+}
+
+// NewLoginGuard creates a login guard with the given settings
+func NewLoginGuard(cfg LoginGuardConfig) *LoginGuard {
+	return &LoginGuard{
+		cfg:      cfg,
+		failures: make(map[string]*loginFailures),
+	}
+}
+
+// LoginLockout describes lockouts started by a failed login
+type LoginLockout struct {
+	Account bool
+	IP      bool
+	Until   time.Time
+}
+
+// Check returns how long a login attempt for email from ip must wait, or
+// zero if it may proceed. Unknown emails are tracked like real ones, so the
+// response does not reveal whether an account exists.
+func (g *LoginGuard) Check(email, ip string, now time.Time) time.Duration {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	wait := g.wait(accountKey(email), g.cfg.Account, now)
+	if w := g.wait(ipKey(ip), g.cfg.IP, now); w > wait {
+		wait = w
+	}
+	return wait
+}
+
+// Fail records a failed login for email from ip and reports any lockout it started
+func (g *LoginGuard) Fail(email, ip string, now time.Time) LoginLockout {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.prune(now)
+
+	var lockout LoginLockout
+	if until, locked := g.fail(accountKey(email), g.cfg.Account, now); locked {
+		lockout.Account = true
+		lockout.Until = until
+	}
+	if until, locked := g.fail(ipKey(ip), g.cfg.IP, now); locked {
+		lockout.IP = true
+		if until.After(lockout.Until) {
+			lockout.Until = until
+		}
+	}
+	return lockout
+}
+
+// Succeed clears the failures of an account after a successful login. IP
+// failures are kept, so that logging in to one's own account does not reset
+// the budget for guessing others.
+func (g *LoginGuard) Succeed(email string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	delete(g.failures, accountKey(email))
+}
+
+// wait returns how long the source key must wait before its next attempt
+func (g *LoginGuard) wait(key string, policy LoginPolicy, now time.Time) time.Duration {
+	f := g.current(key, now)
+	if f == nil {
+		return 0
+	}
+	if now.Before(f.lockedUntil) {
+		return f.lockedUntil.Sub(now)
+	}
+	if f.count < policy.FreeAttempts {
+		return 0
+	}
+
+	if next := f.last.Add(g.backoff(f.count - policy.FreeAttempts)); now.Before(next) {
+		return next.Sub(now)
+	}
+	return 0
+}
+
+// fail counts a failure for key, locking it out once the policy's threshold
+// is reached. It returns the lockout end if a new lockout started.
+func (g *LoginGuard) fail(key string, policy LoginPolicy, now time.Time) (time.Time, bool) {
+	f := g.current(key, now)
+	if f == nil {
+		f = &loginFailures{}
+		g.failures[key] = f
+	}
+	f.count++
+	f.last = now
+
+	if policy.LockoutThreshold > 0 && f.count >= policy.LockoutThreshold && !now.Before(f.lockedUntil) {
+		f.lockedUntil = now.Add(g.cfg.LockoutDuration)
+		return f.lockedUntil, true
+	}
+	return time.Time{}, false
+}
+
+// current returns the failures of key, or nil if there are none within the window
+func (g *LoginGuard) current(key string, now time.Time) *loginFailures {
+	f := g.failures[key]
+	if f == nil || (now.Sub(f.last) > g.cfg.Window && !now.Before(f.lockedUntil)) {
+		return nil
+	}
+	return f
+}
+
+// backoff returns the delay after n failures past the free attempts
+func (g *LoginGuard) backoff(n int) time.Duration {
+	if n > maxBackoffShift {
+		n = maxBackoffShift
+	}
+	delay := g.cfg.BaseDelay << n
+	if delay > g.cfg.MaxDelay {
+		delay = g.cfg.MaxDelay
+	}
+	return delay
+}
+
+// prune drops expired failure records, at most once per loginPrunePeriod
+func (g *LoginGuard) prune(now time.Time) {
+	if now.Sub(g.lastPrune) < loginPrunePeriod {
+		return
+	}
+	g.lastPrune = now
+
+	for key := range g.failures {
+		if g.current(key, now) == nil {
+			delete(g.failures, key)
+		}
+	}
+}
+
+// accountKey normalizes an email address into a failure key
+func accountKey(email string) string {
+	return "account:" + strings.ToLower(strings.TrimSpace(email))
+}
+
+// ipKey builds the failure key of a client address
+func ipKey(ip string) string {
+	return "ip:" + ip
+}
@@ -1,8 +1,11 @@
 package store
 
 import (
+	"context"
 	"errors"
 	"latlongapi/backend/models"
+	"sort"
+	"strings"
 	"sync"
 	"time"
 )
@@ -10,14 +13,51 @@ import (
 var (
 	ErrUserNotFound = errors.New("user not found")
 	ErrUserExists   = errors.New("user already exists")
+
+	ErrAPIKeyNotFound = errors.New("api key not found")
+
+	ErrRefreshTokenNotFound = errors.New("refresh token not found")
+
+	ErrIdentityNotFound = errors.New("identity not found")
+	ErrIdentityExists   = errors.New("identity already linked")
+
+	ErrOrganizationNotFound = errors.New("organization not found")
+	ErrMembershipNotFound   = errors.New("membership not found")
+	ErrMemberExists         = errors.New("user is already a member")
+	ErrInvitationNotFound   = errors.New("invitation not found")
 )
 
-// MemoryStore is an in-memory implementation of UserStore
+// MemoryStore is an in-memory implementation of Store
 type MemoryStore struct {
-	users  map[string]*models.User // email -> user
-	usersByID map[int]*models.User // id -> user
-	mu     sync.RWMutex
-	nextID int
+	users     map[string]*models.User // email -> user
+	usersByID map[int]*models.User    // id -> user
+	mu        sync.RWMutex
+	nextID    int
+
+	apiKeys       map[int]*models.APIKey    // id -> key
+	apiKeysByHash map[string]*models.APIKey // hash -> key
+	nextAPIKeyID  int
+
+	usage    map[int][]models.UsageRecord // user id -> records
+	orgUsage map[int][]models.UsageRecord // org id -> records
+
+	refreshTokens       map[int]*models.RefreshToken    // id -> token
+	refreshTokensByHash map[string]*models.RefreshToken // hash -> token
+	nextRefreshTokenID  int
+	revoked             map[string]time.Time // token or session id -> keep until
+
+	totpSteps     map[int]int64           // user id -> last accepted time step
+	recoveryCodes map[int]map[string]bool // user id -> unused code hashes
+
+	identities     map[string]*models.Identity // provider + "\x00" + subject -> identity
+	nextIdentityID int
+
+	orgs              map[int]*models.Organization
+	nextOrgID         int
+	memberships       map[int]map[int]*models.Membership // org id -> user id -> membership
+	invitations       map[int]*models.Invitation         // id -> invitation
+	invitationsByHash map[string]*models.Invitation      // hash -> invitation
+	nextInvitationID  int
 }
 
 // NewMemoryStore creates a new in-memory user store
@@ -26,9 +66,39 @@ func NewMemoryStore() *MemoryStore {
 		users:     make(map[string]*models.User),
 		usersByID: make(map[int]*models.User),
 		nextID:    1,
+
+		apiKeys:       make(map[int]*models.APIKey),
+		apiKeysByHash: make(map[string]*models.APIKey),
+		nextAPIKeyID:  1,
+
+		usage:    make(map[int][]models.UsageRecord),
+		orgUsage: make(map[int][]models.UsageRecord),
+
+		refreshTokens:       make(map[int]*models.RefreshToken),
+		refreshTokensByHash: make(map[string]*models.RefreshToken),
+		nextRefreshTokenID:  1,
+		revoked:             make(map[string]time.Time),
+
+		totpSteps:     make(map[int]int64),
+		recoveryCodes: make(map[int]map[string]bool),
+
+		identities:     make(map[string]*models.Identity),
+		nextIdentityID: 1,
+
+		orgs:              make(map[int]*models.Organization),
+		nextOrgID:         1,
+		memberships:       make(map[int]map[int]*models.Membership),
+		invitations:       make(map[int]*models.Invitation),
+		invitationsByHash: make(map[string]*models.Invitation),
+		nextInvitationID:  1,
 	}
 }
 
+// Ping always succeeds, as there is nothing to connect to
+func (s *MemoryStore) Ping(ctx context.Context) error {
+	return nil
+}
+
 // CreateUser creates a new user
 func (s *MemoryStore) CreateUser(email, hashedPassword string) (*models.User, error) {
 	s.mu.Lock()
@@ -42,6 +112,8 @@ func (s *MemoryStore) CreateUser(email, hashedPassword string) (*models.User, er
 		ID:        s.nextID,
 		Email:     email,
 		Password:  hashedPassword,
+		Plan:      models.PlanFree,
+		Role:      models.RoleUser,
 		CreatedAt: time.Now(),
 	}
 
@@ -49,7 +121,8 @@ func (s *MemoryStore) CreateUser(email, hashedPassword string) (*models.User, er
 	s.usersByID[user.ID] = user
 	s.nextID++
 
-	return user, nil
+	copied := *user
+	return &copied, nil
 }
 
 // GetUserByEmail retrieves a user by email
@@ -62,7 +135,8 @@ func (s *MemoryStore) GetUserByEmail(email string) (*models.User, error) {
 		return nil, ErrUserNotFound
 	}
 
-	return user, nil
+	copied := *user
+	return &copied, nil
 }
 
 // GetUserByID retrieves a user by ID
@@ -75,6 +149,168 @@ func (s *MemoryStore) GetUserByID(id int) (*models.User, error) {
 		return nil, ErrUserNotFound
 	}
 
-	return user, nil
+	copied := *user
+	return &copied, nil
 }
 
+// UpdatePassword replaces a user's password hash
+func (s *MemoryStore) UpdatePassword(id int, hashedPassword string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user, exists := s.usersByID[id]
+	if !exists {
+		return ErrUserNotFound
+	}
+
+	user.Password = hashedPassword
+	return nil
+}
+
+// MarkEmailVerified records that a user has confirmed their email address.
+// It keeps the original time if the address was already verified.
+func (s *MemoryStore) MarkEmailVerified(id int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user, exists := s.usersByID[id]
+	if !exists {
+		return ErrUserNotFound
+	}
+
+	if user.EmailVerifiedAt == nil {
+		now := time.Now()
+		user.EmailVerifiedAt = &now
+	}
+	return nil
+}
+
+// ListUsers returns one page of the users matching query, oldest first,
+// and the total number of matches
+func (s *MemoryStore) ListUsers(query models.UserQuery) ([]*models.User, int, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	search := strings.ToLower(query.Search)
+	var matches []*models.User
+	for _, user := range s.usersByID {
+		if search != "" && !strings.Contains(strings.ToLower(user.Email), search) {
+			continue
+		}
+		if query.Role != "" && user.Role != query.Role {
+			continue
+		}
+		if query.Plan != "" && user.Plan != query.Plan {
+			continue
+		}
+		matches = append(matches, user)
+	}
+	sort.Slice(matches, func(i, j int) bool { return matches[i].ID < matches[j].ID })
+
+	total := len(matches)
+	if query.Offset > total {
+		query.Offset = total
+	}
+	matches = matches[query.Offset:]
+	if query.Limit > 0 && len(matches) > query.Limit {
+		matches = matches[:query.Limit]
+	}
+
+	users := make([]*models.User, 0, len(matches))
+	for _, user := range matches {
+		copied := *user
+		users = append(users, &copied)
+	}
+
+	return users, total, nil
+}
+
+// UpdateUser saves a user's email, plan, role and suspension
+func (s *MemoryStore) UpdateUser(user *models.User) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	existing, exists := s.usersByID[user.ID]
+	if !exists {
+		return ErrUserNotFound
+	}
+
+	if user.Email != existing.Email {
+		if _, taken := s.users[user.Email]; taken {
+			return ErrUserExists
+		}
+		delete(s.users, existing.Email)
+		s.users[user.Email] = existing
+	}
+
+	existing.Email = user.Email
+	existing.Plan = user.Plan
+	existing.Role = user.Role
+	existing.RoleChangedAt = user.RoleChangedAt
+	existing.SuspendedAt = user.SuspendedAt
+	return nil
+}
+
+// ChangeEmail replaces a user's email address and marks it unverified. The
+// email index is updated under the same lock as the user, so the account is
+// never reachable by both addresses or by neither.
+func (s *MemoryStore) ChangeEmail(id int, email string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user, exists := s.usersByID[id]
+	if !exists {
+		return ErrUserNotFound
+	}
+
+	if other, taken := s.users[email]; taken && other.ID != id {
+		return ErrUserExists
+	}
+
+	delete(s.users, user.Email)
+	s.users[email] = user
+	user.Email = email
+	user.EmailVerifiedAt = nil
+	return nil
+}
+
+// DeleteUser removes a user along with their API keys, usage, sessions,
+// linked identities and organization memberships
+func (s *MemoryStore) DeleteUser(id int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user, exists := s.usersByID[id]
+	if !exists {
+		return ErrUserNotFound
+	}
+
+	delete(s.users, user.Email)
+	delete(s.usersByID, id)
+
+	for keyID, key := range s.apiKeys {
+		if key.UserID == id {
+			delete(s.apiKeysByHash, key.Hash)
+			delete(s.apiKeys, keyID)
+		}
+	}
+	delete(s.usage, id)
+	for tokenID, token := range s.refreshTokens {
+		if token.UserID == id {
+			delete(s.refreshTokensByHash, token.Hash)
+			delete(s.refreshTokens, tokenID)
+		}
+	}
+	delete(s.totpSteps, id)
+	delete(s.recoveryCodes, id)
+	for key, identity := range s.identities {
+		if identity.UserID == id {
+			delete(s.identities, key)
+		}
+	}
+	for _, members := range s.memberships {
+		delete(members, id)
+	}
+
+	return nil
+}
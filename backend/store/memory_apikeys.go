@@ -0,0 +1,183 @@
+package store
+
+import (
+	"latlongapi/backend/models"
+	"sort"
+	"time"
+)
+
+// CreateAPIKey stores a new API key for a user
+func (s *MemoryStore) CreateAPIKey(userID int, label, prefix, hash string) (*models.APIKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := &models.APIKey{
+		ID:        s.nextAPIKeyID,
+		UserID:    userID,
+		Label:     label,
+		Prefix:    prefix,
+		Hash:      hash,
+		CreatedAt: time.Now(),
+	}
+
+	s.apiKeys[key.ID] = key
+	s.apiKeysByHash[hash] = key
+	s.nextAPIKeyID++
+
+	return copyAPIKey(key), nil
+}
+
+// ListAPIKeys returns all keys belonging to a user, oldest first
+func (s *MemoryStore) ListAPIKeys(userID int) ([]*models.APIKey, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	keys := []*models.APIKey{}
+	for _, key := range s.apiKeys {
+		if key.UserID == userID {
+			keys = append(keys, copyAPIKey(key))
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].ID < keys[j].ID })
+
+	return keys, nil
+}
+
+// GetAPIKeyByHash retrieves a key by its hash
+func (s *MemoryStore) GetAPIKeyByHash(hash string) (*models.APIKey, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	key, exists := s.apiKeysByHash[hash]
+	if !exists {
+		return nil, ErrAPIKeyNotFound
+	}
+
+	return copyAPIKey(key), nil
+}
+
+// UpdateAPIKeyLabel changes the label of one of a user's keys
+func (s *MemoryStore) UpdateAPIKeyLabel(userID, id int, label string) (*models.APIKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key, exists := s.apiKeys[id]
+	if !exists || key.UserID != userID {
+		return nil, ErrAPIKeyNotFound
+	}
+
+	key.Label = label
+	return copyAPIKey(key), nil
+}
+
+// RevokeAPIKey marks one of a user's keys as revoked. Revoking an already
+// revoked key keeps the original revocation time.
+func (s *MemoryStore) RevokeAPIKey(userID, id int) (*models.APIKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key, exists := s.apiKeys[id]
+	if !exists || key.UserID != userID {
+		return nil, ErrAPIKeyNotFound
+	}
+
+	if key.RevokedAt == nil {
+		now := time.Now()
+		key.RevokedAt = &now
+	}
+	return copyAPIKey(key), nil
+}
+
+// TouchAPIKey records when a key was last used
+func (s *MemoryStore) TouchAPIKey(id int, usedAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key, exists := s.apiKeys[id]
+	if !exists {
+		return ErrAPIKeyNotFound
+	}
+
+	key.LastUsedAt = &usedAt
+	return nil
+}
+
+// CreateOrgAPIKey stores a new API key for an organization
+func (s *MemoryStore) CreateOrgAPIKey(orgID int, label, prefix, hash string) (*models.APIKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.orgs[orgID]; !exists {
+		return nil, ErrOrganizationNotFound
+	}
+
+	key := &models.APIKey{
+		ID:        s.nextAPIKeyID,
+		OrgID:     orgID,
+		Label:     label,
+		Prefix:    prefix,
+		Hash:      hash,
+		CreatedAt: time.Now(),
+	}
+
+	s.apiKeys[key.ID] = key
+	s.apiKeysByHash[hash] = key
+	s.nextAPIKeyID++
+
+	return copyAPIKey(key), nil
+}
+
+// ListOrgAPIKeys returns all keys belonging to an organization, oldest first
+func (s *MemoryStore) ListOrgAPIKeys(orgID int) ([]*models.APIKey, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	keys := []*models.APIKey{}
+	for _, key := range s.apiKeys {
+		if key.OrgID == orgID {
+			keys = append(keys, copyAPIKey(key))
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].ID < keys[j].ID })
+
+	return keys, nil
+}
+
+// UpdateOrgAPIKeyLabel changes the label of one of an organization's keys
+func (s *MemoryStore) UpdateOrgAPIKeyLabel(orgID, id int, label string) (*models.APIKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key, exists := s.apiKeys[id]
+	if !exists || key.OrgID != orgID {
+		return nil, ErrAPIKeyNotFound
+	}
+
+	key.Label = label
+	return copyAPIKey(key), nil
+}
+
+// RevokeOrgAPIKey marks one of an organization's keys as revoked. Revoking
+// an already revoked key keeps the original revocation time.
+func (s *MemoryStore) RevokeOrgAPIKey(orgID, id int) (*models.APIKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key, exists := s.apiKeys[id]
+	if !exists || key.OrgID != orgID {
+		return nil, ErrAPIKeyNotFound
+	}
+
+	if key.RevokedAt == nil {
+		now := time.Now()
+		key.RevokedAt = &now
+	}
+	return copyAPIKey(key), nil
+}
+
+// copyAPIKey returns a copy of key so callers cannot mutate stored state
+// without holding the lock
+func copyAPIKey(key *models.APIKey) *models.APIKey {
+	c := *key
+	return &c
+}
@@ -0,0 +1,69 @@
+package store
+
+import (
+	"latlongapi/backend/models"
+	"sort"
+	"time"
+)
+
+// CreateIdentity links an external identity to a user
+func (s *MemoryStore) CreateIdentity(userID int, provider, subject, email string) (*models.Identity, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := identityKey(provider, subject)
+	if _, exists := s.identities[key]; exists {
+		return nil, ErrIdentityExists
+	}
+
+	identity := &models.Identity{
+		ID:        s.nextIdentityID,
+		UserID:    userID,
+		Provider:  provider,
+		Subject:   subject,
+		Email:     email,
+		CreatedAt: time.Now(),
+	}
+
+	s.identities[key] = identity
+	s.nextIdentityID++
+
+	copied := *identity
+	return &copied, nil
+}
+
+// GetIdentity retrieves the identity with the given provider and subject
+func (s *MemoryStore) GetIdentity(provider, subject string) (*models.Identity, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	identity, exists := s.identities[identityKey(provider, subject)]
+	if !exists {
+		return nil, ErrIdentityNotFound
+	}
+
+	copied := *identity
+	return &copied, nil
+}
+
+// ListIdentities returns the identities linked to a user, oldest first
+func (s *MemoryStore) ListIdentities(userID int) ([]*models.Identity, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	identities := []*models.Identity{}
+	for _, identity := range s.identities {
+		if identity.UserID == userID {
+			copied := *identity
+			identities = append(identities, &copied)
+		}
+	}
+	sort.Slice(identities, func(i, j int) bool { return identities[i].ID < identities[j].ID })
+
+	return identities, nil
+}
+
+// identityKey builds the map key of an identity
+func identityKey(provider, subject string) string {
+	return provider + "\x00" + subject
+}
@@ -0,0 +1,85 @@
+package store
+
+import "time"
+
+// SetTOTPSecret starts enrollment with a new, unconfirmed secret
+func (s *MemoryStore) SetTOTPSecret(userID int, secret string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user, exists := s.usersByID[userID]
+	if !exists {
+		return ErrUserNotFound
+	}
+
+	user.TOTPSecret = secret
+	user.TOTPEnabledAt = nil
+	delete(s.totpSteps, userID)
+	delete(s.recoveryCodes, userID)
+	return nil
+}
+
+// EnableTOTP confirms enrollment, recording the time step of the confirming
+// code and replacing the user's recovery codes
+func (s *MemoryStore) EnableTOTP(userID int, step int64, recoveryCodeHashes []string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user, exists := s.usersByID[userID]
+	if !exists {
+		return ErrUserNotFound
+	}
+
+	now := time.Now()
+	user.TOTPEnabledAt = &now
+	s.totpSteps[userID] = step
+
+	codes := make(map[string]bool, len(recoveryCodeHashes))
+	for _, hash := range recoveryCodeHashes {
+		codes[hash] = true
+	}
+	s.recoveryCodes[userID] = codes
+	return nil
+}
+
+// DisableTOTP removes the secret and recovery codes
+func (s *MemoryStore) DisableTOTP(userID int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user, exists := s.usersByID[userID]
+	if !exists {
+		return ErrUserNotFound
+	}
+
+	user.TOTPSecret = ""
+	user.TOTPEnabledAt = nil
+	delete(s.totpSteps, userID)
+	delete(s.recoveryCodes, userID)
+	return nil
+}
+
+// UseTOTPStep records the time step of an accepted code, returning false if
+// it is not newer than the last one
+func (s *MemoryStore) UseTOTPStep(userID int, step int64) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if last, exists := s.totpSteps[userID]; exists && step <= last {
+		return false, nil
+	}
+	s.totpSteps[userID] = step
+	return true, nil
+}
+
+// UseRecoveryCode removes a recovery code, returning false if it does not exist
+func (s *MemoryStore) UseRecoveryCode(userID int, hash string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.recoveryCodes[userID][hash] {
+		return false, nil
+	}
+	delete(s.recoveryCodes[userID], hash)
+	return true, nil
+}
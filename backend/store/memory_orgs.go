@@ -0,0 +1,299 @@
+package store
+
+import (
+	"latlongapi/backend/models"
+	"sort"
+	"strings"
+	"time"
+)
+
+// CreateOrganization creates an organization on the free plan with ownerID
+// as its first owner
+func (s *MemoryStore) CreateOrganization(name string, ownerID int) (*models.Organization, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.usersByID[ownerID]; !exists {
+		return nil, ErrUserNotFound
+	}
+
+	org := &models.Organization{
+		ID:        s.nextOrgID,
+		Name:      name,
+		Plan:      models.PlanFree,
+		CreatedAt: time.Now(),
+	}
+
+	s.orgs[org.ID] = org
+	s.memberships[org.ID] = map[int]*models.Membership{
+		ownerID: {
+			OrgID:     org.ID,
+			UserID:    ownerID,
+			Role:      models.OrgRoleOwner,
+			CreatedAt: org.CreatedAt,
+		},
+	}
+	s.nextOrgID++
+
+	copied := *org
+	return &copied, nil
+}
+
+// GetOrganization retrieves an organization by ID
+func (s *MemoryStore) GetOrganization(id int) (*models.Organization, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	org, exists := s.orgs[id]
+	if !exists {
+		return nil, ErrOrganizationNotFound
+	}
+
+	copied := *org
+	return &copied, nil
+}
+
+// ListOrganizations returns the organizations a user belongs to, oldest first
+func (s *MemoryStore) ListOrganizations(userID int) ([]*models.UserOrganization, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	orgs := []*models.UserOrganization{}
+	for orgID, members := range s.memberships {
+		if m, ok := members[userID]; ok {
+			orgs = append(orgs, &models.UserOrganization{Organization: *s.orgs[orgID], Role: m.Role})
+		}
+	}
+	sort.Slice(orgs, func(i, j int) bool { return orgs[i].ID < orgs[j].ID })
+
+	return orgs, nil
+}
+
+// UpdateOrganization saves an organization's name and plan
+func (s *MemoryStore) UpdateOrganization(org *models.Organization) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	existing, exists := s.orgs[org.ID]
+	if !exists {
+		return ErrOrganizationNotFound
+	}
+
+	existing.Name = org.Name
+	existing.Plan = org.Plan
+	return nil
+}
+
+// DeleteOrganization removes an organization with its memberships,
+// invitations, API keys and usage
+func (s *MemoryStore) DeleteOrganization(id int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.orgs[id]; !exists {
+		return ErrOrganizationNotFound
+	}
+
+	delete(s.orgs, id)
+	delete(s.memberships, id)
+	for invitationID, invitation := range s.invitations {
+		if invitation.OrgID == id {
+			delete(s.invitationsByHash, invitation.Hash)
+			delete(s.invitations, invitationID)
+		}
+	}
+	for keyID, key := range s.apiKeys {
+		if key.OrgID == id {
+			delete(s.apiKeysByHash, key.Hash)
+			delete(s.apiKeys, keyID)
+		}
+	}
+	delete(s.orgUsage, id)
+
+	return nil
+}
+
+// GetMembership retrieves a user's membership of an organization
+func (s *MemoryStore) GetMembership(orgID, userID int) (*models.Membership, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	m, exists := s.memberships[orgID][userID]
+	if !exists {
+		return nil, ErrMembershipNotFound
+	}
+
+	return s.copyMembership(m), nil
+}
+
+// ListMembers returns the members of an organization, earliest first
+func (s *MemoryStore) ListMembers(orgID int) ([]*models.Membership, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	members := []*models.Membership{}
+	for _, m := range s.memberships[orgID] {
+		members = append(members, s.copyMembership(m))
+	}
+	sort.Slice(members, func(i, j int) bool {
+		if !members[i].CreatedAt.Equal(members[j].CreatedAt) {
+			return members[i].CreatedAt.Before(members[j].CreatedAt)
+		}
+		return members[i].UserID < members[j].UserID
+	})
+
+	return members, nil
+}
+
+// UpdateMemberRole changes a member's role
+func (s *MemoryStore) UpdateMemberRole(orgID, userID int, role string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	m, exists := s.memberships[orgID][userID]
+	if !exists {
+		return ErrMembershipNotFound
+	}
+
+	m.Role = role
+	return nil
+}
+
+// RemoveMember removes a user from an organization
+func (s *MemoryStore) RemoveMember(orgID, userID int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.memberships[orgID][userID]; !exists {
+		return ErrMembershipNotFound
+	}
+
+	delete(s.memberships[orgID], userID)
+	return nil
+}
+
+// CreateInvitation stores an invitation, replacing any earlier invitation of
+// the same address to the organization
+func (s *MemoryStore) CreateInvitation(orgID int, email, role string, invitedBy int, hash string, expiresAt time.Time) (*models.Invitation, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.orgs[orgID]; !exists {
+		return nil, ErrOrganizationNotFound
+	}
+
+	for id, invitation := range s.invitations {
+		if invitation.OrgID == orgID && strings.EqualFold(invitation.Email, email) {
+			delete(s.invitationsByHash, invitation.Hash)
+			delete(s.invitations, id)
+		}
+	}
+
+	invitation := &models.Invitation{
+		ID:        s.nextInvitationID,
+		OrgID:     orgID,
+		Email:     email,
+		Role:      role,
+		InvitedBy: invitedBy,
+		Hash:      hash,
+		CreatedAt: time.Now(),
+		ExpiresAt: expiresAt,
+	}
+
+	s.invitations[invitation.ID] = invitation
+	s.invitationsByHash[hash] = invitation
+	s.nextInvitationID++
+
+	copied := *invitation
+	return &copied, nil
+}
+
+// GetInvitationByHash retrieves an invitation by the hash of its token
+func (s *MemoryStore) GetInvitationByHash(hash string) (*models.Invitation, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	invitation, exists := s.invitationsByHash[hash]
+	if !exists {
+		return nil, ErrInvitationNotFound
+	}
+
+	copied := *invitation
+	return &copied, nil
+}
+
+// ListInvitations returns an organization's pending invitations, oldest first
+func (s *MemoryStore) ListInvitations(orgID int) ([]*models.Invitation, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	invitations := []*models.Invitation{}
+	for _, invitation := range s.invitations {
+		if invitation.OrgID == orgID {
+			copied := *invitation
+			invitations = append(invitations, &copied)
+		}
+	}
+	sort.Slice(invitations, func(i, j int) bool { return invitations[i].ID < invitations[j].ID })
+
+	return invitations, nil
+}
+
+// DeleteInvitation withdraws one of an organization's invitations
+func (s *MemoryStore) DeleteInvitation(orgID, id int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	invitation, exists := s.invitations[id]
+	if !exists || invitation.OrgID != orgID {
+		return ErrInvitationNotFound
+	}
+
+	delete(s.invitationsByHash, invitation.Hash)
+	delete(s.invitations, id)
+	return nil
+}
+
+// AcceptInvitation deletes an invitation and adds userID to its organization
+// with the invited role
+func (s *MemoryStore) AcceptInvitation(id, userID int) (*models.Membership, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	invitation, exists := s.invitations[id]
+	if !exists {
+		return nil, ErrInvitationNotFound
+	}
+	if _, exists := s.usersByID[userID]; !exists {
+		return nil, ErrUserNotFound
+	}
+	if _, exists := s.memberships[invitation.OrgID][userID]; exists {
+		return nil, ErrMemberExists
+	}
+
+	m := &models.Membership{
+		OrgID:     invitation.OrgID,
+		UserID:    userID,
+		Role:      invitation.Role,
+		CreatedAt: time.Now(),
+	}
+	if s.memberships[invitation.OrgID] == nil {
+		s.memberships[invitation.OrgID] = make(map[int]*models.Membership)
+	}
+	s.memberships[invitation.OrgID][userID] = m
+
+	delete(s.invitationsByHash, invitation.Hash)
+	delete(s.invitations, id)
+
+	return s.copyMembership(m), nil
+}
+
+// copyMembership returns a copy of m with the member's current email
+// address. The caller must hold the lock.
+func (s *MemoryStore) copyMembership(m *models.Membership) *models.Membership {
+	c := *m
+	if user, ok := s.usersByID[m.UserID]; ok {
+		c.Email = user.Email
+	}
+	return &c
+}
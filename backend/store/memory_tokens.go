@@ -0,0 +1,155 @@
+package store
+
+import (
+	"latlongapi/backend/models"
+	"time"
+)
+
+// CreateRefreshToken stores a new refresh token for a user's session
+func (s *MemoryStore) CreateRefreshToken(userID int, sessionID, hash string, expiresAt time.Time) (*models.RefreshToken, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	token := &models.RefreshToken{
+		ID:        s.nextRefreshTokenID,
+		UserID:    userID,
+		SessionID: sessionID,
+		Hash:      hash,
+		CreatedAt: time.Now(),
+		ExpiresAt: expiresAt,
+	}
+
+	s.refreshTokens[token.ID] = token
+	s.refreshTokensByHash[hash] = token
+	s.nextRefreshTokenID++
+
+	c := *token
+	return &c, nil
+}
+
+// GetRefreshTokenByHash retrieves a refresh token by its hash
+func (s *MemoryStore) GetRefreshTokenByHash(hash string) (*models.RefreshToken, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	token, exists := s.refreshTokensByHash[hash]
+	if !exists {
+		return nil, ErrRefreshTokenNotFound
+	}
+
+	c := *token
+	return &c, nil
+}
+
+// RevokeRefreshToken revokes a refresh token, returning false if it was already revoked
+func (s *MemoryStore) RevokeRefreshToken(id int) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	token, exists := s.refreshTokens[id]
+	if !exists {
+		return false, ErrRefreshTokenNotFound
+	}
+	if token.RevokedAt != nil {
+		return false, nil
+	}
+
+	now := time.Now()
+	token.RevokedAt = &now
+	return true, nil
+}
+
+// RevokeSession revokes a session's refresh tokens and keeps the session ID
+// on the revocation list until the given time
+func (s *MemoryStore) RevokeSession(sessionID string, until time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	for _, token := range s.refreshTokens {
+		if token.SessionID == sessionID && token.RevokedAt == nil {
+			token.RevokedAt = &now
+		}
+	}
+	s.revokeLocked(sessionID, until)
+	return nil
+}
+
+// RevokeUserSessions revokes every session of a user
+func (s *MemoryStore) RevokeUserSessions(userID int, until time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	for _, token := range s.refreshTokens {
+		if token.UserID != userID {
+			continue
+		}
+		if token.RevokedAt == nil {
+			token.RevokedAt = &now
+		}
+		s.revokeLocked(token.SessionID, until)
+	}
+	return nil
+}
+
+// RevokeToken keeps a token or session ID on the revocation list until the given time
+func (s *MemoryStore) RevokeToken(id string, until time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.revokeLocked(id, until)
+	return nil
+}
+
+// IsTokenRevoked reports whether a token or session ID is on the revocation list
+func (s *MemoryStore) IsTokenRevoked(id string) (bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	until, exists := s.revoked[id]
+	return exists && time.Now().Before(until), nil
+}
+
+// ConsumeToken records a single-use token ID until the given time, returning
+// false if it was already recorded
+func (s *MemoryStore) ConsumeToken(id string, until time.Time) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if expires, exists := s.revoked[id]; exists && time.Now().Before(expires) {
+		return false, nil
+	}
+	s.revokeLocked(id, until)
+	return true, nil
+}
+
+// CountActiveSessions counts sessions with an unrevoked refresh token that
+// has not expired by now
+func (s *MemoryStore) CountActiveSessions(now time.Time) (int, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	sessions := make(map[string]struct{})
+	for _, token := range s.refreshTokens {
+		if token.RevokedAt == nil && now.Before(token.ExpiresAt) {
+			sessions[token.SessionID] = struct{}{}
+		}
+	}
+	return len(sessions), nil
+}
+
+// revokeLocked adds id to the revocation list and prunes expired entries.
+// Callers must hold s.mu.
+func (s *MemoryStore) revokeLocked(id string, until time.Time) {
+	now := time.Now()
+	for revokedID, expires := range s.revoked {
+		if now.After(expires) {
+			delete(s.revoked, revokedID)
+		}
+	}
+
+	if until.After(s.revoked[id]) {
+		s.revoked[id] = until
+	}
+}
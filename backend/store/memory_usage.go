@@ -0,0 +1,79 @@
+package store
+
+import (
+	"latlongapi/backend/models"
+	"net/http"
+	"time"
+)
+
+// RecordUsage appends a usage record for the record's user or organization
+func (s *MemoryStore) RecordUsage(record models.UsageRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if record.OrgID != 0 {
+		s.orgUsage[record.OrgID] = append(s.orgUsage[record.OrgID], record)
+		return nil
+	}
+	s.usage[record.UserID] = append(s.usage[record.UserID], record)
+	return nil
+}
+
+// ListUsage returns a user's usage records at or after since, in recording order
+func (s *MemoryStore) ListUsage(userID int, since time.Time) ([]models.UsageRecord, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	result := []models.UsageRecord{}
+	for _, record := range s.usage[userID] {
+		if !record.Timestamp.Before(since) {
+			result = append(result, record)
+		}
+	}
+	return result, nil
+}
+
+// ListOrgUsage returns an organization's usage records at or after since,
+// in recording order
+func (s *MemoryStore) ListOrgUsage(orgID int, since time.Time) ([]models.UsageRecord, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	result := []models.UsageRecord{}
+	for _, record := range s.orgUsage[orgID] {
+		if !record.Timestamp.Before(since) {
+			result = append(result, record)
+		}
+	}
+	return result, nil
+}
+
+// CountUsage adds up the quota units of a user's requests at or after since
+// that were not rejected by rate limiting
+func (s *MemoryStore) CountUsage(userID int, since time.Time) (int, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return countQuotaUsage(s.usage[userID], since), nil
+}
+
+// CountOrgUsage adds up the quota units of an organization's requests at or
+// after since that were not rejected by rate limiting
+func (s *MemoryStore) CountOrgUsage(orgID int, since time.Time) (int, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return countQuotaUsage(s.orgUsage[orgID], since), nil
+}
+
+// countQuotaUsage adds up the quota units of the records at or after since
+// that were not rejected by rate limiting
+func countQuotaUsage(records []models.UsageRecord, since time.Time) int {
+	units := 0
+	for _, record := range records {
+		if !record.Timestamp.Before(since) && record.Status != http.StatusTooManyRequests {
+			units += record.Units
+		}
+	}
+	return units
+}
@@ -0,0 +1,468 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"latlongapi/backend/models"
+	"strings"
+	"time"
+
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// DefaultSQLitePath is the database file used when no path is configured
+const DefaultSQLitePath = "latlongapi.db"
+
+// migrations are applied in order; each entry's index + 1 is its schema
+// version. Never edit an existing migration, append a new one instead.
+var migrations = []string{
+	// 1: users
+	`CREATE TABLE users (
+		id         INTEGER PRIMARY KEY AUTOINCREMENT,
+		email      TEXT    NOT NULL UNIQUE,
+		password   TEXT    NOT NULL,
+		plan       TEXT    NOT NULL DEFAULT 'free',
+		created_at INTEGER NOT NULL
+	)`,
+
+	// 2: api keys
+	`CREATE TABLE api_keys (
+		id           INTEGER PRIMARY KEY AUTOINCREMENT,
+		user_id      INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+		label        TEXT    NOT NULL,
+		prefix       TEXT    NOT NULL,
+		hash         TEXT    NOT NULL UNIQUE,
+		created_at   INTEGER NOT NULL,
+		last_used_at INTEGER,
+		revoked_at   INTEGER
+	);
+	CREATE INDEX api_keys_user_id ON api_keys(user_id)`,
+
+	// 3: usage
+	`CREATE TABLE usage (
+		id         INTEGER PRIMARY KEY AUTOINCREMENT,
+		user_id    INTEGER NOT NULL,
+		api_key_id INTEGER NOT NULL,
+		endpoint   TEXT    NOT NULL,
+		timestamp  INTEGER NOT NULL,
+		status     INTEGER NOT NULL,
+		latency    INTEGER NOT NULL,
+		cache_hit  INTEGER NOT NULL
+	);
+	CREATE INDEX usage_user_id_timestamp ON usage(user_id, timestamp)`,
+
+	// 4: refresh tokens and revocation list
+	`CREATE TABLE refresh_tokens (
+		id         INTEGER PRIMARY KEY AUTOINCREMENT,
+		user_id    INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+		session_id TEXT    NOT NULL,
+		hash       TEXT    NOT NULL UNIQUE,
+		created_at INTEGER NOT NULL,
+		expires_at INTEGER NOT NULL,
+		revoked_at INTEGER
+	);
+	CREATE INDEX refresh_tokens_session_id ON refresh_tokens(session_id);
+	CREATE INDEX refresh_tokens_user_id ON refresh_tokens(user_id);
+	CREATE TABLE revoked_tokens (
+		id    TEXT    PRIMARY KEY,
+		until INTEGER NOT NULL
+	)`,
+
+	// 5: email verification; existing accounts are treated as verified
+	`ALTER TABLE users ADD COLUMN email_verified_at INTEGER;
+	UPDATE users SET email_verified_at = created_at`,
+
+	// 6: TOTP two-factor authentication
+	`ALTER TABLE users ADD COLUMN totp_secret TEXT NOT NULL DEFAULT '';
+	ALTER TABLE users ADD COLUMN totp_enabled_at INTEGER;
+	ALTER TABLE users ADD COLUMN totp_last_step INTEGER NOT NULL DEFAULT 0;
+	CREATE TABLE recovery_codes (
+		user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+		hash    TEXT    NOT NULL,
+		PRIMARY KEY (user_id, hash)
+	)`,
+
+	// 7: external identities
+	`CREATE TABLE identities (
+		id         INTEGER PRIMARY KEY AUTOINCREMENT,
+		user_id    INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+		provider   TEXT    NOT NULL,
+		subject    TEXT    NOT NULL,
+		email      TEXT    NOT NULL,
+		created_at INTEGER NOT NULL,
+		UNIQUE (provider, subject)
+	);
+	CREATE INDEX identities_user_id ON identities(user_id)`,
+
+	// 8: roles and suspension
+	`ALTER TABLE users ADD COLUMN role TEXT NOT NULL DEFAULT 'user';
+	ALTER TABLE users ADD COLUMN suspended_at INTEGER`,
+
+	// 9: organizations; api_keys is rebuilt so that a key belongs to either
+	// a user or an organization
+	`CREATE TABLE organizations (
+		id         INTEGER PRIMARY KEY AUTOINCREMENT,
+		name       TEXT    NOT NULL,
+		plan       TEXT    NOT NULL DEFAULT 'free',
+		created_at INTEGER NOT NULL
+	);
+	CREATE TABLE memberships (
+		org_id     INTEGER NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+		user_id    INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+		role       TEXT    NOT NULL,
+		created_at INTEGER NOT NULL,
+		PRIMARY KEY (org_id, user_id)
+	);
+	CREATE INDEX memberships_user_id ON memberships(user_id);
+	CREATE TABLE invitations (
+		id         INTEGER PRIMARY KEY AUTOINCREMENT,
+		org_id     INTEGER NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+		email      TEXT    NOT NULL COLLATE NOCASE,
+		role       TEXT    NOT NULL,
+		invited_by INTEGER NOT NULL,
+		hash       TEXT    NOT NULL UNIQUE,
+		created_at INTEGER NOT NULL,
+		expires_at INTEGER NOT NULL,
+		UNIQUE (org_id, email)
+	);
+	CREATE TABLE api_keys_new (
+		id           INTEGER PRIMARY KEY AUTOINCREMENT,
+		user_id      INTEGER REFERENCES users(id) ON DELETE CASCADE,
+		org_id       INTEGER REFERENCES organizations(id) ON DELETE CASCADE,
+		label        TEXT    NOT NULL,
+		prefix       TEXT    NOT NULL,
+		hash         TEXT    NOT NULL UNIQUE,
+		created_at   INTEGER NOT NULL,
+		last_used_at INTEGER,
+		revoked_at   INTEGER,
+		CHECK ((user_id IS NULL) != (org_id IS NULL))
+	);
+	INSERT INTO api_keys_new (id, user_id, label, prefix, hash, created_at, last_used_at, revoked_at)
+		SELECT id, user_id, label, prefix, hash, created_at, last_used_at, revoked_at FROM api_keys;
+	DROP TABLE api_keys;
+	ALTER TABLE api_keys_new RENAME TO api_keys;
+	CREATE INDEX api_keys_user_id ON api_keys(user_id);
+	CREATE INDEX api_keys_org_id ON api_keys(org_id);
+	ALTER TABLE usage ADD COLUMN org_id INTEGER;
+	CREATE INDEX usage_org_id_timestamp ON usage(org_id, timestamp)`,
+
+	// 10: when a user's role was changed
+	`ALTER TABLE users ADD COLUMN role_changed_at INTEGER`,
+
+	// 11: quota units charged per request, more than one for batches
+	`ALTER TABLE usage ADD COLUMN units INTEGER NOT NULL DEFAULT 1`,
+}
+
+// userColumns are the columns read by getUser, in scan order
+const userColumns = `id, email, password, plan, role, created_at, email_verified_at, totp_secret, totp_enabled_at, suspended_at, role_changed_at`
+
+// SQLiteStore is a SQLite-backed implementation of Store. Timestamps are
+// stored as Unix nanoseconds.
+type SQLiteStore struct {
+	db *sql.DB
+}
+
+// NewSQLiteStore opens (creating if needed) the database at path and
+// applies any pending migrations
+func NewSQLiteStore(path string) (*SQLiteStore, error) {
+	if path == "" {
+		path = DefaultSQLitePath
+	}
+
+	dsn := "file:" + path + "?_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)"
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	// Every connection to ":memory:" opens a separate, empty database
+	if path == ":memory:" {
+		db.SetMaxOpenConns(1)
+	}
+
+	s := &SQLiteStore{db: db}
+	if err := s.migrate(); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// Close closes the database
+func (s *SQLiteStore) Close() error {
+	return s.db.Close()
+}
+
+// Ping checks that the database file can be queried
+func (s *SQLiteStore) Ping(ctx context.Context) error {
+	var version int
+	return s.db.QueryRowContext(ctx, `SELECT COALESCE(MAX(version), 0) FROM schema_migrations`).Scan(&version)
+}
+
+// migrate applies migrations newer than the database's schema version
+func (s *SQLiteStore) migrate() error {
+	if _, err := s.db.Exec(`CREATE TABLE IF NOT EXISTS schema_migrations (version INTEGER PRIMARY KEY)`); err != nil {
+		return fmt.Errorf("creating schema_migrations: %w", err)
+	}
+
+	var version int
+	if err := s.db.QueryRow(`SELECT COALESCE(MAX(version), 0) FROM schema_migrations`).Scan(&version); err != nil {
+		return fmt.Errorf("reading schema version: %w", err)
+	}
+
+	for i := version; i < len(migrations); i++ {
+		tx, err := s.db.Begin()
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec(migrations[i]); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("applying migration %d: %w", i+1, err)
+		}
+		if _, err := tx.Exec(`INSERT INTO schema_migrations (version) VALUES (?)`, i+1); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("recording migration %d: %w", i+1, err)
+		}
+		if err := tx.Commit(); err != nil {
+			return fmt.Errorf("committing migration %d: %w", i+1, err)
+		}
+	}
+
+	return nil
+}
+
+// CreateUser creates a new user
+func (s *SQLiteStore) CreateUser(email, hashedPassword string) (*models.User, error) {
+	user := &models.User{
+		Email:     email,
+		Password:  hashedPassword,
+		Plan:      models.PlanFree,
+		Role:      models.RoleUser,
+		CreatedAt: time.Now(),
+	}
+
+	res, err := s.db.Exec(
+		`INSERT INTO users (email, password, plan, role, created_at) VALUES (?, ?, ?, ?, ?)`,
+		user.Email, user.Password, user.Plan, user.Role, user.CreatedAt.UnixNano(),
+	)
+	if err != nil {
+		if isUniqueViolation(err) {
+			return nil, ErrUserExists
+		}
+		return nil, err
+	}
+
+	id, err := res.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+	user.ID = int(id)
+
+	return user, nil
+}
+
+// GetUserByEmail retrieves a user by email
+func (s *SQLiteStore) GetUserByEmail(email string) (*models.User, error) {
+	return s.getUser(`SELECT `+userColumns+` FROM users WHERE email = ?`, email)
+}
+
+// GetUserByID retrieves a user by ID
+func (s *SQLiteStore) GetUserByID(id int) (*models.User, error) {
+	return s.getUser(`SELECT `+userColumns+` FROM users WHERE id = ?`, id)
+}
+
+// getUser runs a single-user query
+func (s *SQLiteStore) getUser(query string, args ...interface{}) (*models.User, error) {
+	user, err := scanUser(s.db.QueryRow(query, args...))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrUserNotFound
+	}
+	return user, err
+}
+
+// scanUser reads a user selected with userColumns
+func scanUser(row interface{ Scan(...interface{}) error }) (*models.User, error) {
+	var user models.User
+	var createdAt int64
+	var verifiedAt, totpEnabledAt, suspendedAt, roleChangedAt sql.NullInt64
+
+	err := row.Scan(
+		&user.ID, &user.Email, &user.Password, &user.Plan, &user.Role, &createdAt, &verifiedAt,
+		&user.TOTPSecret, &totpEnabledAt, &suspendedAt, &roleChangedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	user.CreatedAt = time.Unix(0, createdAt)
+	user.EmailVerifiedAt = nullTime(verifiedAt)
+	user.TOTPEnabledAt = nullTime(totpEnabledAt)
+	user.SuspendedAt = nullTime(suspendedAt)
+	user.RoleChangedAt = nullTime(roleChangedAt)
+
+	return &user, nil
+}
+
+// UpdatePassword replaces a user's password hash
+func (s *SQLiteStore) UpdatePassword(id int, hashedPassword string) error {
+	res, err := s.db.Exec(`UPDATE users SET password = ? WHERE id = ?`, hashedPassword, id)
+	if err != nil {
+		return err
+	}
+	return requireRowsAffected(res, ErrUserNotFound)
+}
+
+// MarkEmailVerified records that a user has confirmed their email address.
+// It keeps the original time if the address was already verified.
+func (s *SQLiteStore) MarkEmailVerified(id int) error {
+	res, err := s.db.Exec(
+		`UPDATE users SET email_verified_at = COALESCE(email_verified_at, ?) WHERE id = ?`,
+		time.Now().UnixNano(), id,
+	)
+	if err != nil {
+		return err
+	}
+	return requireRowsAffected(res, ErrUserNotFound)
+}
+
+// ListUsers returns one page of the users matching query, oldest first,
+// and the total number of matches
+func (s *SQLiteStore) ListUsers(query models.UserQuery) ([]*models.User, int, error) {
+	where := `WHERE 1 = 1`
+	var args []interface{}
+	if query.Search != "" {
+		where += ` AND email LIKE ? ESCAPE '\'`
+		args = append(args, "%"+escapeLike(query.Search)+"%")
+	}
+	if query.Role != "" {
+		where += ` AND role = ?`
+		args = append(args, query.Role)
+	}
+	if query.Plan != "" {
+		where += ` AND plan = ?`
+		args = append(args, query.Plan)
+	}
+
+	var total int
+	if err := s.db.QueryRow(`SELECT COUNT(*) FROM users `+where, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	limit := query.Limit
+	if limit <= 0 {
+		limit = -1
+	}
+	rows, err := s.db.Query(
+		`SELECT `+userColumns+` FROM users `+where+` ORDER BY id LIMIT ? OFFSET ?`,
+		append(args, limit, query.Offset)...,
+	)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	users := []*models.User{}
+	for rows.Next() {
+		user, err := scanUser(rows)
+		if err != nil {
+			return nil, 0, err
+		}
+		users = append(users, user)
+	}
+
+	return users, total, rows.Err()
+}
+
+// UpdateUser saves a user's email, plan, role and suspension
+func (s *SQLiteStore) UpdateUser(user *models.User) error {
+	var suspendedAt, roleChangedAt interface{}
+	if user.SuspendedAt != nil {
+		suspendedAt = user.SuspendedAt.UnixNano()
+	}
+	if user.RoleChangedAt != nil {
+		roleChangedAt = user.RoleChangedAt.UnixNano()
+	}
+
+	res, err := s.db.Exec(
+		`UPDATE users SET email = ?, plan = ?, role = ?, role_changed_at = ?, suspended_at = ? WHERE id = ?`,
+		user.Email, user.Plan, user.Role, roleChangedAt, suspendedAt, user.ID,
+	)
+	if err != nil {
+		if isUniqueViolation(err) {
+			return ErrUserExists
+		}
+		return err
+	}
+	return requireRowsAffected(res, ErrUserNotFound)
+}
+
+// ChangeEmail replaces a user's email address and marks it unverified
+func (s *SQLiteStore) ChangeEmail(id int, email string) error {
+	res, err := s.db.Exec(`UPDATE users SET email = ?, email_verified_at = NULL WHERE id = ?`, email, id)
+	if err != nil {
+		if isUniqueViolation(err) {
+			return ErrUserExists
+		}
+		return err
+	}
+	return requireRowsAffected(res, ErrUserNotFound)
+}
+
+// DeleteUser removes a user along with their API keys, usage, sessions,
+// linked identities and organization memberships. Usage has no foreign
+// key, so it is deleted explicitly; everything else cascades.
+func (s *SQLiteStore) DeleteUser(id int) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM usage WHERE user_id = ?`, id); err != nil {
+		return err
+	}
+	res, err := tx.Exec(`DELETE FROM users WHERE id = ?`, id)
+	if err != nil {
+		return err
+	}
+	if err := requireRowsAffected(res, ErrUserNotFound); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// escapeLike escapes the LIKE wildcards in s, using \ as the escape character
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
+
+// isUniqueViolation reports whether err is a SQLite unique constraint failure
+func isUniqueViolation(err error) bool {
+	var sqliteErr *sqlite.Error
+	return errors.As(err, &sqliteErr) && sqliteErr.Code() == sqlite3.SQLITE_CONSTRAINT_UNIQUE
+}
+
+// isPrimaryKeyViolation reports whether err is a SQLite primary key constraint failure
+func isPrimaryKeyViolation(err error) bool {
+	var sqliteErr *sqlite.Error
+	return errors.As(err, &sqliteErr) && sqliteErr.Code() == sqlite3.SQLITE_CONSTRAINT_PRIMARYKEY
+}
+
+// isForeignKeyViolation reports whether err is a SQLite foreign key constraint failure
+func isForeignKeyViolation(err error) bool {
+	var sqliteErr *sqlite.Error
+	return errors.As(err, &sqliteErr) && sqliteErr.Code() == sqlite3.SQLITE_CONSTRAINT_FOREIGNKEY
+}
+
+// nullTime converts a nullable Unix-nanosecond column to *time.Time
+func nullTime(v sql.NullInt64) *time.Time {
+	if !v.Valid {
+		return nil
+	}
+	t := time.Unix(0, v.Int64)
+	return &t
+}
@@ -0,0 +1,221 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+	"latlongapi/backend/models"
+	"time"
+)
+
+const apiKeyColumns = `id, user_id, org_id, label, prefix, hash, created_at, last_used_at, revoked_at`
+
+// CreateAPIKey stores a new API key for a user
+func (s *SQLiteStore) CreateAPIKey(userID int, label, prefix, hash string) (*models.APIKey, error) {
+	key := &models.APIKey{
+		UserID:    userID,
+		Label:     label,
+		Prefix:    prefix,
+		Hash:      hash,
+		CreatedAt: time.Now(),
+	}
+
+	res, err := s.db.Exec(
+		`INSERT INTO api_keys (user_id, label, prefix, hash, created_at) VALUES (?, ?, ?, ?, ?)`,
+		key.UserID, key.Label, key.Prefix, key.Hash, key.CreatedAt.UnixNano(),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	id, err := res.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+	key.ID = int(id)
+
+	return key, nil
+}
+
+// ListAPIKeys returns all keys belonging to a user, oldest first
+func (s *SQLiteStore) ListAPIKeys(userID int) ([]*models.APIKey, error) {
+	rows, err := s.db.Query(`SELECT `+apiKeyColumns+` FROM api_keys WHERE user_id = ? ORDER BY id`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := []*models.APIKey{}
+	for rows.Next() {
+		key, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+
+	return keys, rows.Err()
+}
+
+// GetAPIKeyByHash retrieves a key by its hash
+func (s *SQLiteStore) GetAPIKeyByHash(hash string) (*models.APIKey, error) {
+	return s.getAPIKey(`SELECT `+apiKeyColumns+` FROM api_keys WHERE hash = ?`, hash)
+}
+
+// UpdateAPIKeyLabel changes the label of one of a user's keys
+func (s *SQLiteStore) UpdateAPIKeyLabel(userID, id int, label string) (*models.APIKey, error) {
+	res, err := s.db.Exec(`UPDATE api_keys SET label = ? WHERE id = ? AND user_id = ?`, label, id, userID)
+	if err != nil {
+		return nil, err
+	}
+	if err := requireRowsAffected(res, ErrAPIKeyNotFound); err != nil {
+		return nil, err
+	}
+
+	return s.getAPIKey(`SELECT `+apiKeyColumns+` FROM api_keys WHERE id = ?`, id)
+}
+
+// RevokeAPIKey marks one of a user's keys as revoked. Revoking an already
+// revoked key keeps the original revocation time.
+func (s *SQLiteStore) RevokeAPIKey(userID, id int) (*models.APIKey, error) {
+	res, err := s.db.Exec(
+		`UPDATE api_keys SET revoked_at = COALESCE(revoked_at, ?) WHERE id = ? AND user_id = ?`,
+		time.Now().UnixNano(), id, userID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if err := requireRowsAffected(res, ErrAPIKeyNotFound); err != nil {
+		return nil, err
+	}
+
+	return s.getAPIKey(`SELECT `+apiKeyColumns+` FROM api_keys WHERE id = ?`, id)
+}
+
+// TouchAPIKey records when a key was last used
+func (s *SQLiteStore) TouchAPIKey(id int, usedAt time.Time) error {
+	res, err := s.db.Exec(`UPDATE api_keys SET last_used_at = ? WHERE id = ?`, usedAt.UnixNano(), id)
+	if err != nil {
+		return err
+	}
+	return requireRowsAffected(res, ErrAPIKeyNotFound)
+}
+
+// CreateOrgAPIKey stores a new API key for an organization
+func (s *SQLiteStore) CreateOrgAPIKey(orgID int, label, prefix, hash string) (*models.APIKey, error) {
+	key := &models.APIKey{
+		OrgID:     orgID,
+		Label:     label,
+		Prefix:    prefix,
+		Hash:      hash,
+		CreatedAt: time.Now(),
+	}
+
+	res, err := s.db.Exec(
+		`INSERT INTO api_keys (org_id, label, prefix, hash, created_at) VALUES (?, ?, ?, ?, ?)`,
+		key.OrgID, key.Label, key.Prefix, key.Hash, key.CreatedAt.UnixNano(),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	id, err := res.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+	key.ID = int(id)
+
+	return key, nil
+}
+
+// ListOrgAPIKeys returns all keys belonging to an organization, oldest first
+func (s *SQLiteStore) ListOrgAPIKeys(orgID int) ([]*models.APIKey, error) {
+	rows, err := s.db.Query(`SELECT `+apiKeyColumns+` FROM api_keys WHERE org_id = ? ORDER BY id`, orgID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := []*models.APIKey{}
+	for rows.Next() {
+		key, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+
+	return keys, rows.Err()
+}
+
+// UpdateOrgAPIKeyLabel changes the label of one of an organization's keys
+func (s *SQLiteStore) UpdateOrgAPIKeyLabel(orgID, id int, label string) (*models.APIKey, error) {
+	res, err := s.db.Exec(`UPDATE api_keys SET label = ? WHERE id = ? AND org_id = ?`, label, id, orgID)
+	if err != nil {
+		return nil, err
+	}
+	if err := requireRowsAffected(res, ErrAPIKeyNotFound); err != nil {
+		return nil, err
+	}
+
+	return s.getAPIKey(`SELECT `+apiKeyColumns+` FROM api_keys WHERE id = ?`, id)
+}
+
+// RevokeOrgAPIKey marks one of an organization's keys as revoked. Revoking
+// an already revoked key keeps the original revocation time.
+func (s *SQLiteStore) RevokeOrgAPIKey(orgID, id int) (*models.APIKey, error) {
+	res, err := s.db.Exec(
+		`UPDATE api_keys SET revoked_at = COALESCE(revoked_at, ?) WHERE id = ? AND org_id = ?`,
+		time.Now().UnixNano(), id, orgID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if err := requireRowsAffected(res, ErrAPIKeyNotFound); err != nil {
+		return nil, err
+	}
+
+	return s.getAPIKey(`SELECT `+apiKeyColumns+` FROM api_keys WHERE id = ?`, id)
+}
+
+// getAPIKey runs a single-key query
+func (s *SQLiteStore) getAPIKey(query string, args ...interface{}) (*models.APIKey, error) {
+	key, err := scanAPIKey(s.db.QueryRow(query, args...))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrAPIKeyNotFound
+		}
+		return nil, err
+	}
+	return key, nil
+}
+
+// scanAPIKey scans a row selected with apiKeyColumns
+func scanAPIKey(row interface{ Scan(...interface{}) error }) (*models.APIKey, error) {
+	var key models.APIKey
+	var createdAt int64
+	var userID, orgID, lastUsedAt, revokedAt sql.NullInt64
+
+	err := row.Scan(&key.ID, &userID, &orgID, &key.Label, &key.Prefix, &key.Hash, &createdAt, &lastUsedAt, &revokedAt)
+	if err != nil {
+		return nil, err
+	}
+	key.UserID = int(userID.Int64)
+	key.OrgID = int(orgID.Int64)
+	key.CreatedAt = time.Unix(0, createdAt)
+	key.LastUsedAt = nullTime(lastUsedAt)
+	key.RevokedAt = nullTime(revokedAt)
+
+	return &key, nil
+}
+
+// requireRowsAffected returns notFound if res changed no rows
+func requireRowsAffected(res sql.Result, notFound error) error {
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return notFound
+	}
+	return nil
+}
@@ -0,0 +1,84 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+	"latlongapi/backend/models"
+	"time"
+)
+
+const identityColumns = `id, user_id, provider, subject, email, created_at`
+
+// CreateIdentity links an external identity to a user
+func (s *SQLiteStore) CreateIdentity(userID int, provider, subject, email string) (*models.Identity, error) {
+	identity := &models.Identity{
+		UserID:    userID,
+		Provider:  provider,
+		Subject:   subject,
+		Email:     email,
+		CreatedAt: time.Now(),
+	}
+
+	res, err := s.db.Exec(
+		`INSERT INTO identities (user_id, provider, subject, email, created_at) VALUES (?, ?, ?, ?, ?)`,
+		identity.UserID, identity.Provider, identity.Subject, identity.Email, identity.CreatedAt.UnixNano(),
+	)
+	if err != nil {
+		if isUniqueViolation(err) {
+			return nil, ErrIdentityExists
+		}
+		return nil, err
+	}
+
+	id, err := res.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+	identity.ID = int(id)
+
+	return identity, nil
+}
+
+// GetIdentity retrieves the identity with the given provider and subject
+func (s *SQLiteStore) GetIdentity(provider, subject string) (*models.Identity, error) {
+	row := s.db.QueryRow(`SELECT `+identityColumns+` FROM identities WHERE provider = ? AND subject = ?`, provider, subject)
+	identity, err := scanIdentity(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrIdentityNotFound
+	}
+	return identity, err
+}
+
+// ListIdentities returns the identities linked to a user, oldest first
+func (s *SQLiteStore) ListIdentities(userID int) ([]*models.Identity, error) {
+	rows, err := s.db.Query(`SELECT `+identityColumns+` FROM identities WHERE user_id = ? ORDER BY id`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	identities := []*models.Identity{}
+	for rows.Next() {
+		identity, err := scanIdentity(rows)
+		if err != nil {
+			return nil, err
+		}
+		identities = append(identities, identity)
+	}
+
+	return identities, rows.Err()
+}
+
+// scanIdentity reads an identity selected with identityColumns
+func scanIdentity(row interface{ Scan(...interface{}) error }) (*models.Identity, error) {
+	var identity models.Identity
+	var createdAt int64
+
+	err := row.Scan(&identity.ID, &identity.UserID, &identity.Provider, &identity.Subject, &identity.Email, &createdAt)
+	if err != nil {
+		return nil, err
+	}
+	identity.CreatedAt = time.Unix(0, createdAt)
+
+	return &identity, nil
+}
@@ -0,0 +1,94 @@
+package store
+
+import "time"
+
+// SetTOTPSecret starts enrollment with a new, unconfirmed secret
+func (s *SQLiteStore) SetTOTPSecret(userID int, secret string) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec(
+		`UPDATE users SET totp_secret = ?, totp_enabled_at = NULL, totp_last_step = 0 WHERE id = ?`,
+		secret, userID,
+	)
+	if err != nil {
+		return err
+	}
+	if err := requireRowsAffected(res, ErrUserNotFound); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`DELETE FROM recovery_codes WHERE user_id = ?`, userID); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// EnableTOTP confirms enrollment, recording the time step of the confirming
+// code and replacing the user's recovery codes
+func (s *SQLiteStore) EnableTOTP(userID int, step int64, recoveryCodeHashes []string) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec(
+		`UPDATE users SET totp_enabled_at = ?, totp_last_step = ? WHERE id = ?`,
+		time.Now().UnixNano(), step, userID,
+	)
+	if err != nil {
+		return err
+	}
+	if err := requireRowsAffected(res, ErrUserNotFound); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`DELETE FROM recovery_codes WHERE user_id = ?`, userID); err != nil {
+		return err
+	}
+	for _, hash := range recoveryCodeHashes {
+		if _, err := tx.Exec(`INSERT INTO recovery_codes (user_id, hash) VALUES (?, ?)`, userID, hash); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// DisableTOTP removes the secret and recovery codes
+func (s *SQLiteStore) DisableTOTP(userID int) error {
+	return s.SetTOTPSecret(userID, "")
+}
+
+// UseTOTPStep records the time step of an accepted code, returning false if
+// it is not newer than the last one
+func (s *SQLiteStore) UseTOTPStep(userID int, step int64) (bool, error) {
+	res, err := s.db.Exec(
+		`UPDATE users SET totp_last_step = ? WHERE id = ? AND totp_last_step < ?`,
+		step, userID, step,
+	)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return n > 0, nil
+}
+
+// UseRecoveryCode removes a recovery code, returning false if it does not exist
+func (s *SQLiteStore) UseRecoveryCode(userID int, hash string) (bool, error) {
+	res, err := s.db.Exec(`DELETE FROM recovery_codes WHERE user_id = ? AND hash = ?`, userID, hash)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return n > 0, nil
+}
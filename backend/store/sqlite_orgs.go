@@ -0,0 +1,346 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+	"latlongapi/backend/models"
+	"time"
+)
+
+const (
+	orgColumns        = `id, name, plan, created_at`
+	membershipColumns = `m.org_id, m.user_id, u.email, m.role, m.created_at`
+	invitationColumns = `id, org_id, email, role, invited_by, hash, created_at, expires_at`
+)
+
+// CreateOrganization creates an organization on the free plan with ownerID
+// as its first owner
+func (s *SQLiteStore) CreateOrganization(name string, ownerID int) (*models.Organization, error) {
+	org := &models.Organization{
+		Name:      name,
+		Plan:      models.PlanFree,
+		CreatedAt: time.Now(),
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec(
+		`INSERT INTO organizations (name, plan, created_at) VALUES (?, ?, ?)`,
+		org.Name, org.Plan, org.CreatedAt.UnixNano(),
+	)
+	if err != nil {
+		return nil, err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+	org.ID = int(id)
+
+	if _, err := tx.Exec(
+		`INSERT INTO memberships (org_id, user_id, role, created_at) VALUES (?, ?, ?, ?)`,
+		org.ID, ownerID, models.OrgRoleOwner, org.CreatedAt.UnixNano(),
+	); err != nil {
+		if isForeignKeyViolation(err) {
+			return nil, ErrUserNotFound
+		}
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return org, nil
+}
+
+// GetOrganization retrieves an organization by ID
+func (s *SQLiteStore) GetOrganization(id int) (*models.Organization, error) {
+	var org models.Organization
+	var createdAt int64
+
+	err := s.db.QueryRow(`SELECT `+orgColumns+` FROM organizations WHERE id = ?`, id).Scan(
+		&org.ID, &org.Name, &org.Plan, &createdAt,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrOrganizationNotFound
+		}
+		return nil, err
+	}
+	org.CreatedAt = time.Unix(0, createdAt)
+
+	return &org, nil
+}
+
+// ListOrganizations returns the organizations a user belongs to, oldest first
+func (s *SQLiteStore) ListOrganizations(userID int) ([]*models.UserOrganization, error) {
+	rows, err := s.db.Query(
+		`SELECT o.id, o.name, o.plan, o.created_at, m.role
+		FROM organizations o JOIN memberships m ON m.org_id = o.id
+		WHERE m.user_id = ? ORDER BY o.id`,
+		userID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	orgs := []*models.UserOrganization{}
+	for rows.Next() {
+		var org models.UserOrganization
+		var createdAt int64
+		if err := rows.Scan(&org.ID, &org.Name, &org.Plan, &createdAt, &org.Role); err != nil {
+			return nil, err
+		}
+		org.CreatedAt = time.Unix(0, createdAt)
+		orgs = append(orgs, &org)
+	}
+
+	return orgs, rows.Err()
+}
+
+// UpdateOrganization saves an organization's name and plan
+func (s *SQLiteStore) UpdateOrganization(org *models.Organization) error {
+	res, err := s.db.Exec(`UPDATE organizations SET name = ?, plan = ? WHERE id = ?`, org.Name, org.Plan, org.ID)
+	if err != nil {
+		return err
+	}
+	return requireRowsAffected(res, ErrOrganizationNotFound)
+}
+
+// DeleteOrganization removes an organization with its memberships,
+// invitations, API keys and usage. Usage has no foreign key, so it is
+// deleted explicitly; everything else cascades.
+func (s *SQLiteStore) DeleteOrganization(id int) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM usage WHERE org_id = ?`, id); err != nil {
+		return err
+	}
+	res, err := tx.Exec(`DELETE FROM organizations WHERE id = ?`, id)
+	if err != nil {
+		return err
+	}
+	if err := requireRowsAffected(res, ErrOrganizationNotFound); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// GetMembership retrieves a user's membership of an organization
+func (s *SQLiteStore) GetMembership(orgID, userID int) (*models.Membership, error) {
+	row := s.db.QueryRow(
+		`SELECT `+membershipColumns+` FROM memberships m JOIN users u ON u.id = m.user_id
+		WHERE m.org_id = ? AND m.user_id = ?`,
+		orgID, userID,
+	)
+	m, err := scanMembership(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrMembershipNotFound
+	}
+	return m, err
+}
+
+// ListMembers returns the members of an organization, earliest first
+func (s *SQLiteStore) ListMembers(orgID int) ([]*models.Membership, error) {
+	rows, err := s.db.Query(
+		`SELECT `+membershipColumns+` FROM memberships m JOIN users u ON u.id = m.user_id
+		WHERE m.org_id = ? ORDER BY m.created_at, m.user_id`,
+		orgID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	members := []*models.Membership{}
+	for rows.Next() {
+		m, err := scanMembership(rows)
+		if err != nil {
+			return nil, err
+		}
+		members = append(members, m)
+	}
+
+	return members, rows.Err()
+}
+
+// UpdateMemberRole changes a member's role
+func (s *SQLiteStore) UpdateMemberRole(orgID, userID int, role string) error {
+	res, err := s.db.Exec(`UPDATE memberships SET role = ? WHERE org_id = ? AND user_id = ?`, role, orgID, userID)
+	if err != nil {
+		return err
+	}
+	return requireRowsAffected(res, ErrMembershipNotFound)
+}
+
+// RemoveMember removes a user from an organization
+func (s *SQLiteStore) RemoveMember(orgID, userID int) error {
+	res, err := s.db.Exec(`DELETE FROM memberships WHERE org_id = ? AND user_id = ?`, orgID, userID)
+	if err != nil {
+		return err
+	}
+	return requireRowsAffected(res, ErrMembershipNotFound)
+}
+
+// CreateInvitation stores an invitation, replacing any earlier invitation of
+// the same address to the organization
+func (s *SQLiteStore) CreateInvitation(orgID int, email, role string, invitedBy int, hash string, expiresAt time.Time) (*models.Invitation, error) {
+	invitation := &models.Invitation{
+		OrgID:     orgID,
+		Email:     email,
+		Role:      role,
+		InvitedBy: invitedBy,
+		Hash:      hash,
+		CreatedAt: time.Now(),
+		ExpiresAt: expiresAt,
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM invitations WHERE org_id = ? AND email = ?`, orgID, email); err != nil {
+		return nil, err
+	}
+	res, err := tx.Exec(
+		`INSERT INTO invitations (org_id, email, role, invited_by, hash, created_at, expires_at) VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		invitation.OrgID, invitation.Email, invitation.Role, invitation.InvitedBy, invitation.Hash,
+		invitation.CreatedAt.UnixNano(), invitation.ExpiresAt.UnixNano(),
+	)
+	if err != nil {
+		if isForeignKeyViolation(err) {
+			return nil, ErrOrganizationNotFound
+		}
+		return nil, err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+	invitation.ID = int(id)
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return invitation, nil
+}
+
+// GetInvitationByHash retrieves an invitation by the hash of its token
+func (s *SQLiteStore) GetInvitationByHash(hash string) (*models.Invitation, error) {
+	row := s.db.QueryRow(`SELECT `+invitationColumns+` FROM invitations WHERE hash = ?`, hash)
+	invitation, err := scanInvitation(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrInvitationNotFound
+	}
+	return invitation, err
+}
+
+// ListInvitations returns an organization's pending invitations, oldest first
+func (s *SQLiteStore) ListInvitations(orgID int) ([]*models.Invitation, error) {
+	rows, err := s.db.Query(`SELECT `+invitationColumns+` FROM invitations WHERE org_id = ? ORDER BY id`, orgID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	invitations := []*models.Invitation{}
+	for rows.Next() {
+		invitation, err := scanInvitation(rows)
+		if err != nil {
+			return nil, err
+		}
+		invitations = append(invitations, invitation)
+	}
+
+	return invitations, rows.Err()
+}
+
+// DeleteInvitation withdraws one of an organization's invitations
+func (s *SQLiteStore) DeleteInvitation(orgID, id int) error {
+	res, err := s.db.Exec(`DELETE FROM invitations WHERE id = ? AND org_id = ?`, id, orgID)
+	if err != nil {
+		return err
+	}
+	return requireRowsAffected(res, ErrInvitationNotFound)
+}
+
+// AcceptInvitation deletes an invitation and adds userID to its organization
+// with the invited role
+func (s *SQLiteStore) AcceptInvitation(id, userID int) (*models.Membership, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var orgID int
+	var role string
+	err = tx.QueryRow(`DELETE FROM invitations WHERE id = ? RETURNING org_id, role`, id).Scan(&orgID, &role)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrInvitationNotFound
+		}
+		return nil, err
+	}
+
+	if _, err := tx.Exec(
+		`INSERT INTO memberships (org_id, user_id, role, created_at) VALUES (?, ?, ?, ?)`,
+		orgID, userID, role, time.Now().UnixNano(),
+	); err != nil {
+		if isPrimaryKeyViolation(err) {
+			return nil, ErrMemberExists
+		}
+		if isForeignKeyViolation(err) {
+			return nil, ErrUserNotFound
+		}
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return s.GetMembership(orgID, userID)
+}
+
+// scanMembership reads a membership selected with membershipColumns
+func scanMembership(row interface{ Scan(...interface{}) error }) (*models.Membership, error) {
+	var m models.Membership
+	var createdAt int64
+
+	if err := row.Scan(&m.OrgID, &m.UserID, &m.Email, &m.Role, &createdAt); err != nil {
+		return nil, err
+	}
+	m.CreatedAt = time.Unix(0, createdAt)
+
+	return &m, nil
+}
+
+// scanInvitation reads an invitation selected with invitationColumns
+func scanInvitation(row interface{ Scan(...interface{}) error }) (*models.Invitation, error) {
+	var invitation models.Invitation
+	var createdAt, expiresAt int64
+
+	err := row.Scan(
+		&invitation.ID, &invitation.OrgID, &invitation.Email, &invitation.Role,
+		&invitation.InvitedBy, &invitation.Hash, &createdAt, &expiresAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	invitation.CreatedAt = time.Unix(0, createdAt)
+	invitation.ExpiresAt = time.Unix(0, expiresAt)
+
+	return &invitation, nil
+}
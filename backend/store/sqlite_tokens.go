@@ -0,0 +1,209 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+	"latlongapi/backend/models"
+	"time"
+)
+
+// CreateRefreshToken stores a new refresh token for a user's session
+func (s *SQLiteStore) CreateRefreshToken(userID int, sessionID, hash string, expiresAt time.Time) (*models.RefreshToken, error) {
+	token := &models.RefreshToken{
+		UserID:    userID,
+		SessionID: sessionID,
+		Hash:      hash,
+		CreatedAt: time.Now(),
+		ExpiresAt: expiresAt,
+	}
+
+	res, err := s.db.Exec(
+		`INSERT INTO refresh_tokens (user_id, session_id, hash, created_at, expires_at) VALUES (?, ?, ?, ?, ?)`,
+		token.UserID, token.SessionID, token.Hash, token.CreatedAt.UnixNano(), token.ExpiresAt.UnixNano(),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	id, err := res.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+	token.ID = int(id)
+
+	return token, nil
+}
+
+// GetRefreshTokenByHash retrieves a refresh token by its hash
+func (s *SQLiteStore) GetRefreshTokenByHash(hash string) (*models.RefreshToken, error) {
+	var token models.RefreshToken
+	var createdAt, expiresAt int64
+	var revokedAt sql.NullInt64
+
+	err := s.db.QueryRow(
+		`SELECT id, user_id, session_id, hash, created_at, expires_at, revoked_at FROM refresh_tokens WHERE hash = ?`, hash,
+	).Scan(&token.ID, &token.UserID, &token.SessionID, &token.Hash, &createdAt, &expiresAt, &revokedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrRefreshTokenNotFound
+		}
+		return nil, err
+	}
+	token.CreatedAt = time.Unix(0, createdAt)
+	token.ExpiresAt = time.Unix(0, expiresAt)
+	token.RevokedAt = nullTime(revokedAt)
+
+	return &token, nil
+}
+
+// RevokeRefreshToken revokes a refresh token, returning false if it was already revoked
+func (s *SQLiteStore) RevokeRefreshToken(id int) (bool, error) {
+	res, err := s.db.Exec(`UPDATE refresh_tokens SET revoked_at = ? WHERE id = ? AND revoked_at IS NULL`, time.Now().UnixNano(), id)
+	if err != nil {
+		return false, err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	if n == 0 {
+		// Distinguish an unknown token from an already revoked one
+		var exists int
+		if err := s.db.QueryRow(`SELECT COUNT(*) FROM refresh_tokens WHERE id = ?`, id).Scan(&exists); err != nil {
+			return false, err
+		}
+		if exists == 0 {
+			return false, ErrRefreshTokenNotFound
+		}
+		return false, nil
+	}
+
+	return true, nil
+}
+
+// RevokeSession revokes a session's refresh tokens and keeps the session ID
+// on the revocation list until the given time
+func (s *SQLiteStore) RevokeSession(sessionID string, until time.Time) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(
+		`UPDATE refresh_tokens SET revoked_at = ? WHERE session_id = ? AND revoked_at IS NULL`,
+		time.Now().UnixNano(), sessionID,
+	); err != nil {
+		return err
+	}
+	if err := revokeTokenTx(tx, sessionID, until); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// RevokeUserSessions revokes every session of a user
+func (s *SQLiteStore) RevokeUserSessions(userID int, until time.Time) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(
+		`INSERT INTO revoked_tokens (id, until)
+		SELECT DISTINCT session_id, ? FROM refresh_tokens WHERE user_id = ?
+		ON CONFLICT(id) DO UPDATE SET until = MAX(until, excluded.until)`,
+		until.UnixNano(), userID,
+	); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(
+		`UPDATE refresh_tokens SET revoked_at = ? WHERE user_id = ? AND revoked_at IS NULL`,
+		time.Now().UnixNano(), userID,
+	); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// RevokeToken keeps a token or session ID on the revocation list until the given time
+func (s *SQLiteStore) RevokeToken(id string, until time.Time) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := revokeTokenTx(tx, id, until); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// IsTokenRevoked reports whether a token or session ID is on the revocation list
+func (s *SQLiteStore) IsTokenRevoked(id string) (bool, error) {
+	var count int
+	err := s.db.QueryRow(
+		`SELECT COUNT(*) FROM revoked_tokens WHERE id = ? AND until > ?`, id, time.Now().UnixNano(),
+	).Scan(&count)
+	if err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// ConsumeToken records a single-use token ID until the given time, returning
+// false if it was already recorded
+func (s *SQLiteStore) ConsumeToken(id string, until time.Time) (bool, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM revoked_tokens WHERE until <= ?`, time.Now().UnixNano()); err != nil {
+		return false, err
+	}
+	res, err := tx.Exec(
+		`INSERT INTO revoked_tokens (id, until) VALUES (?, ?) ON CONFLICT(id) DO NOTHING`,
+		id, until.UnixNano(),
+	)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return n > 0, tx.Commit()
+}
+
+// revokeTokenTx adds id to the revocation list and prunes expired entries
+func revokeTokenTx(tx *sql.Tx, id string, until time.Time) error {
+	if _, err := tx.Exec(`DELETE FROM revoked_tokens WHERE until <= ?`, time.Now().UnixNano()); err != nil {
+		return err
+	}
+	_, err := tx.Exec(
+		`INSERT INTO revoked_tokens (id, until) VALUES (?, ?)
+		ON CONFLICT(id) DO UPDATE SET until = MAX(until, excluded.until)`,
+		id, until.UnixNano(),
+	)
+	return err
+}
+
+// CountActiveSessions counts sessions with an unrevoked refresh token that
+// has not expired by now
+func (s *SQLiteStore) CountActiveSessions(now time.Time) (int, error) {
+	var count int
+	err := s.db.QueryRow(
+		`SELECT COUNT(DISTINCT session_id) FROM refresh_tokens WHERE revoked_at IS NULL AND expires_at > ?`,
+		now.UnixNano(),
+	).Scan(&count)
+	return count, err
+}
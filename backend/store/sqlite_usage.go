@@ -0,0 +1,86 @@
+package store
+
+import (
+	"database/sql"
+	"latlongapi/backend/models"
+	"net/http"
+	"time"
+)
+
+// RecordUsage stores a usage record
+func (s *SQLiteStore) RecordUsage(record models.UsageRecord) error {
+	var orgID interface{}
+	if record.OrgID != 0 {
+		orgID = record.OrgID
+	}
+
+	_, err := s.db.Exec(
+		`INSERT INTO usage (user_id, org_id, api_key_id, endpoint, timestamp, status, latency, cache_hit, units) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		record.UserID, orgID, record.APIKeyID, record.Endpoint, record.Timestamp.UnixNano(),
+		record.Status, int64(record.Latency), record.CacheHit, record.Units,
+	)
+	return err
+}
+
+// ListUsage returns a user's usage records at or after since, oldest first
+func (s *SQLiteStore) ListUsage(userID int, since time.Time) ([]models.UsageRecord, error) {
+	return s.listUsage(`user_id = ? AND org_id IS NULL`, userID, since)
+}
+
+// ListOrgUsage returns an organization's usage records at or after since,
+// oldest first
+func (s *SQLiteStore) ListOrgUsage(orgID int, since time.Time) ([]models.UsageRecord, error) {
+	return s.listUsage(`org_id = ?`, orgID, since)
+}
+
+// listUsage returns the usage records matching where at or after since
+func (s *SQLiteStore) listUsage(where string, id int, since time.Time) ([]models.UsageRecord, error) {
+	rows, err := s.db.Query(
+		`SELECT user_id, org_id, api_key_id, endpoint, timestamp, status, latency, cache_hit, units
+		FROM usage WHERE `+where+` AND timestamp >= ? ORDER BY timestamp`,
+		id, since.UnixNano(),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	records := []models.UsageRecord{}
+	for rows.Next() {
+		var record models.UsageRecord
+		var orgID sql.NullInt64
+		var timestamp, latency int64
+		if err := rows.Scan(&record.UserID, &orgID, &record.APIKeyID, &record.Endpoint, &timestamp, &record.Status, &latency, &record.CacheHit, &record.Units); err != nil {
+			return nil, err
+		}
+		record.OrgID = int(orgID.Int64)
+		record.Timestamp = time.Unix(0, timestamp)
+		record.Latency = time.Duration(latency)
+		records = append(records, record)
+	}
+
+	return records, rows.Err()
+}
+
+// CountUsage adds up the quota units of a user's requests at or after since
+// that were not rejected by rate limiting
+func (s *SQLiteStore) CountUsage(userID int, since time.Time) (int, error) {
+	return s.countUsage(`user_id = ? AND org_id IS NULL`, userID, since)
+}
+
+// CountOrgUsage adds up the quota units of an organization's requests at or
+// after since that were not rejected by rate limiting
+func (s *SQLiteStore) CountOrgUsage(orgID int, since time.Time) (int, error) {
+	return s.countUsage(`org_id = ?`, orgID, since)
+}
+
+// countUsage adds up the quota units of the usage records matching where
+// at or after since, leaving out rate limited requests
+func (s *SQLiteStore) countUsage(where string, id int, since time.Time) (int, error) {
+	var units int
+	err := s.db.QueryRow(
+		`SELECT COALESCE(SUM(units), 0) FROM usage WHERE `+where+` AND timestamp >= ? AND status != ?`,
+		id, since.UnixNano(), http.StatusTooManyRequests,
+	).Scan(&units)
+	return units, err
+}
@@ -0,0 +1,34 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"latlongapi/backend/models"
+)
+
+// Store combines all storage interfaces used by the server
+type Store interface {
+	models.UserStore
+	models.APIKeyStore
+	models.UsageStore
+	models.TokenStore
+	models.MFAStore
+	models.IdentityStore
+	models.OrganizationStore
+
+	// Ping checks that the store can serve queries
+	Ping(ctx context.Context) error
+}
+
+// Open creates the store selected by driver: "memory" (default) or "sqlite",
+// in which case dsn is the database file path
+func Open(driver, dsn string) (Store, error) {
+	switch driver {
+	case "", "memory":
+		return NewMemoryStore(), nil
+	case "sqlite":
+		return NewSQLiteStore(dsn)
+	default:
+		return nil, fmt.Errorf("unknown store driver: %s", driver)
+	}
+}
@@ -0,0 +1,233 @@
+package store
+
+import (
+	"database/sql"
+	"latlongapi/backend/models"
+	"net/http"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// testStores returns each Store implementation, empty
+func testStores(t *testing.T) map[string]Store {
+	t.Helper()
+	sqliteStore, err := NewSQLiteStore(":memory:")
+	if err != nil {
+		t.Fatalf("NewSQLiteStore: %v", err)
+	}
+	t.Cleanup(func() { sqliteStore.Close() })
+
+	return map[string]Store{
+		"memory": NewMemoryStore(),
+		"sqlite": sqliteStore,
+	}
+}
+
+func TestSQLiteMigrations(t *testing.T) {
+	s, err := NewSQLiteStore(":memory:")
+	if err != nil {
+		t.Fatalf("NewSQLiteStore: %v", err)
+	}
+	defer s.Close()
+
+	var version int
+	if err := s.db.QueryRow(`SELECT MAX(version) FROM schema_migrations`).Scan(&version); err != nil {
+		t.Fatalf("reading schema version: %v", err)
+	}
+	if version != len(migrations) {
+		t.Errorf("got schema version %d, want %d", version, len(migrations))
+	}
+
+	// Migrating again is a no-op
+	if err := s.migrate(); err != nil {
+		t.Errorf("second migrate: %v", err)
+	}
+}
+
+func TestSQLiteMigrationKeepsAPIKeys(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.db")
+
+	// A database from before organizations, with a user and a key
+	db, err := sql.Open("sqlite", "file:"+path+"?_pragma=foreign_keys(1)")
+	if err != nil {
+		t.Fatalf("sql.Open: %v", err)
+	}
+	if _, err := db.Exec(`CREATE TABLE schema_migrations (version INTEGER PRIMARY KEY)`); err != nil {
+		t.Fatal(err)
+	}
+	for i, migration := range migrations[:8] {
+		if _, err := db.Exec(migration); err != nil {
+			t.Fatalf("applying migration %d: %v", i+1, err)
+		}
+		if _, err := db.Exec(`INSERT INTO schema_migrations (version) VALUES (?)`, i+1); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := db.Exec(`INSERT INTO users (id, email, password, created_at) VALUES (1, 'ivan@example.com', 'hash', 0)`); err != nil {
+		t.Fatalf("inserting user: %v", err)
+	}
+	if _, err := db.Exec(`INSERT INTO api_keys (id, user_id, label, prefix, hash, created_at) VALUES (7, 1, 'ci', 'lla_abcd', 'keyhash', 0)`); err != nil {
+		t.Fatalf("inserting key: %v", err)
+	}
+	db.Close()
+
+	s, err := NewSQLiteStore(path)
+	if err != nil {
+		t.Fatalf("NewSQLiteStore: %v", err)
+	}
+	defer s.Close()
+
+	key, err := s.GetAPIKeyByHash("keyhash")
+	if err != nil {
+		t.Fatalf("GetAPIKeyByHash: %v", err)
+	}
+	if key.ID != 7 || key.UserID != 1 || key.OrgID != 0 || key.Label != "ci" {
+		t.Errorf("got key %+v after the api_keys rebuild", key)
+	}
+
+	// The rebuilt table still cascades from users
+	if err := s.DeleteUser(1); err != nil {
+		t.Fatalf("DeleteUser: %v", err)
+	}
+	if _, err := s.GetAPIKeyByHash("keyhash"); err != ErrAPIKeyNotFound {
+		t.Errorf("key of a deleted user: got error %v, want %v", err, ErrAPIKeyNotFound)
+	}
+}
+
+func TestStoreUsers(t *testing.T) {
+	for name, s := range testStores(t) {
+		user, err := s.CreateUser("ivan@example.com", "hash")
+		if err != nil {
+			t.Fatalf("%s: CreateUser: %v", name, err)
+		}
+		if user.ID == 0 || user.Plan != models.PlanFree || user.Role != models.RoleUser || user.EmailVerified() {
+			t.Errorf("%s: got new user %+v", name, user)
+		}
+
+		if _, err := s.CreateUser("ivan@example.com", "other"); err != ErrUserExists {
+			t.Errorf("%s: duplicate email: got error %v, want %v", name, err, ErrUserExists)
+		}
+
+		byEmail, err := s.GetUserByEmail("ivan@example.com")
+		if err != nil || byEmail.ID != user.ID {
+			t.Errorf("%s: GetUserByEmail: got %+v, %v", name, byEmail, err)
+		}
+		if _, err := s.GetUserByID(user.ID + 100); err != ErrUserNotFound {
+			t.Errorf("%s: unknown ID: got error %v, want %v", name, err, ErrUserNotFound)
+		}
+
+		if err := s.UpdatePassword(user.ID, "new hash"); err != nil {
+			t.Errorf("%s: UpdatePassword: %v", name, err)
+		}
+		if err := s.MarkEmailVerified(user.ID); err != nil {
+			t.Errorf("%s: MarkEmailVerified: %v", name, err)
+		}
+		got, _ := s.GetUserByID(user.ID)
+		if got.Password != "new hash" || !got.EmailVerified() {
+			t.Errorf("%s: got %+v after updates", name, got)
+		}
+
+		// Changing to an address in use fails; a new address is unverified
+		other, _ := s.CreateUser("judy@example.com", "hash")
+		if err := s.ChangeEmail(user.ID, other.Email); err != ErrUserExists {
+			t.Errorf("%s: ChangeEmail to a taken address: got error %v, want %v", name, err, ErrUserExists)
+		}
+		if err := s.ChangeEmail(user.ID, "ivan@example.org"); err != nil {
+			t.Fatalf("%s: ChangeEmail: %v", name, err)
+		}
+		got, _ = s.GetUserByEmail("ivan@example.org")
+		if got == nil || got.ID != user.ID || got.EmailVerified() {
+			t.Errorf("%s: got %+v after changing email", name, got)
+		}
+		if _, err := s.GetUserByEmail("ivan@example.com"); err != ErrUserNotFound {
+			t.Errorf("%s: old address: got error %v, want %v", name, err, ErrUserNotFound)
+		}
+
+		got.Plan = models.PlanPro
+		got.Email = other.Email
+		if err := s.UpdateUser(got); err != ErrUserExists {
+			t.Errorf("%s: UpdateUser to a taken address: got error %v, want %v", name, err, ErrUserExists)
+		}
+		got.Email = "ivan@example.org"
+		if err := s.UpdateUser(got); err != nil {
+			t.Errorf("%s: UpdateUser: %v", name, err)
+		}
+		if got, _ := s.GetUserByID(user.ID); got.Plan != models.PlanPro {
+			t.Errorf("%s: got plan %q, want %q", name, got.Plan, models.PlanPro)
+		}
+	}
+}
+
+func TestStoreDeleteUser(t *testing.T) {
+	for name, s := range testStores(t) {
+		owner, _ := s.CreateUser("ivan@example.com", "hash")
+		user, _ := s.CreateUser("judy@example.com", "hash")
+
+		// Everything the user owns or takes part in
+		key, err := s.CreateAPIKey(user.ID, "ci", "lla_abcd", "keyhash")
+		if err != nil {
+			t.Fatalf("%s: CreateAPIKey: %v", name, err)
+		}
+		if _, err := s.CreateIdentity(user.ID, "google", "sub-1", user.Email); err != nil {
+			t.Fatalf("%s: CreateIdentity: %v", name, err)
+		}
+		if _, err := s.CreateIdentity(owner.ID, "google", "sub-1", owner.Email); err != ErrIdentityExists {
+			t.Errorf("%s: duplicate identity: got error %v, want %v", name, err, ErrIdentityExists)
+		}
+		if _, err := s.CreateRefreshToken(user.ID, "session", "tokenhash", time.Now().Add(time.Hour)); err != nil {
+			t.Fatalf("%s: CreateRefreshToken: %v", name, err)
+		}
+		if err := s.RecordUsage(models.UsageRecord{UserID: user.ID, APIKeyID: key.ID, Endpoint: "/api/convert", Timestamp: time.Now(), Status: http.StatusOK, Units: 1}); err != nil {
+			t.Fatalf("%s: RecordUsage: %v", name, err)
+		}
+		org, err := s.CreateOrganization("Acme", owner.ID)
+		if err != nil {
+			t.Fatalf("%s: CreateOrganization: %v", name, err)
+		}
+		invitation, err := s.CreateInvitation(org.ID, user.Email, models.OrgRoleMember, owner.ID, "invitehash", time.Now().Add(time.Hour))
+		if err != nil {
+			t.Fatalf("%s: CreateInvitation: %v", name, err)
+		}
+		if _, err := s.AcceptInvitation(invitation.ID, user.ID); err != nil {
+			t.Fatalf("%s: AcceptInvitation: %v", name, err)
+		}
+		if _, err := s.AcceptInvitation(invitation.ID, user.ID); err == nil {
+			t.Errorf("%s: invitation accepted twice", name)
+		}
+
+		if err := s.DeleteUser(user.ID); err != nil {
+			t.Fatalf("%s: DeleteUser: %v", name, err)
+		}
+		if err := s.DeleteUser(user.ID); err != ErrUserNotFound {
+			t.Errorf("%s: second DeleteUser: got error %v, want %v", name, err, ErrUserNotFound)
+		}
+
+		if _, err := s.GetUserByEmail(user.Email); err != ErrUserNotFound {
+			t.Errorf("%s: user: got error %v, want %v", name, err, ErrUserNotFound)
+		}
+		if _, err := s.GetAPIKeyByHash("keyhash"); err != ErrAPIKeyNotFound {
+			t.Errorf("%s: API key: got error %v, want %v", name, err, ErrAPIKeyNotFound)
+		}
+		if _, err := s.GetIdentity("google", "sub-1"); err != ErrIdentityNotFound {
+			t.Errorf("%s: identity: got error %v, want %v", name, err, ErrIdentityNotFound)
+		}
+		if _, err := s.GetRefreshTokenByHash("tokenhash"); err != ErrRefreshTokenNotFound {
+			t.Errorf("%s: refresh token: got error %v, want %v", name, err, ErrRefreshTokenNotFound)
+		}
+		if usage, _ := s.ListUsage(user.ID, time.Time{}); len(usage) != 0 {
+			t.Errorf("%s: got %d usage records, want none", name, len(usage))
+		}
+		if _, err := s.GetMembership(org.ID, user.ID); err != ErrMembershipNotFound {
+			t.Errorf("%s: membership: got error %v, want %v", name, err, ErrMembershipNotFound)
+		}
+
+		// The organization and its other members stay
+		if members, err := s.ListMembers(org.ID); err != nil || len(members) != 1 || members[0].UserID != owner.ID {
+			t.Errorf("%s: got members %+v, %v; want the owner alone", name, members, err)
+		}
+		if _, err := s.GetUserByID(owner.ID); err != nil {
+			t.Errorf("%s: owner: %v", name, err)
+		}
+	}
+}
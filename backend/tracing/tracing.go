@@ -0,0 +1,103 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Span exporters
+const (
+	ExporterNone   = "none"
+	ExporterOTLP   = "otlp"
+	ExporterStdout = "stdout"
+)
+
+// DefaultServiceName names the service in exported spans unless
+// OTEL_SERVICE_NAME is set
+const DefaultServiceName = "latlongapi"
+
+// instrumentationName identifies the tracer that creates this module's spans
+const instrumentationName = "latlongapi"
+
+var (
+	ErrUnknownExporter = errors.New("unknown trace exporter")
+)
+
+// Config selects where spans are exported. Everything else, such as the
+// OTLP endpoint, headers and sampler, is read by the OpenTelemetry SDK from
+// the standard OTEL_* environment variables.
+type Config struct {
+	Exporter string    // none (default), otlp or stdout
+	Stdout   io.Writer // Destination of the stdout exporter
+}
+
+// Setup installs the global tracer provider and the W3C trace context and
+// baggage propagators. Incoming traceparent headers are honoured and passed
+// on to upstream calls even when no exporter is configured. The returned
+// function flushes and stops the exporter.
+func Setup(ctx context.Context, cfg Config) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{},
+		propagation.Baggage{},
+	))
+
+	var exporter sdktrace.SpanExporter
+	var err error
+	batch := true
+	switch strings.ToLower(cfg.Exporter) {
+	case "", ExporterNone:
+		return func(context.Context) error { return nil }, nil
+	case ExporterOTLP:
+		exporter, err = otlptracehttp.New(ctx)
+	case ExporterStdout, "console":
+		opts := []stdouttrace.Option{stdouttrace.WithPrettyPrint()}
+		if cfg.Stdout != nil {
+			opts = append(opts, stdouttrace.WithWriter(cfg.Stdout))
+		}
+		exporter, err = stdouttrace.New(opts...)
+		batch = false // Print spans as they end
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnknownExporter, cfg.Exporter)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// OTEL_SERVICE_NAME and OTEL_RESOURCE_ATTRIBUTES take precedence over
+	// the default name
+	res, err := resource.New(ctx,
+		resource.WithSchemaURL(semconv.SchemaURL),
+		resource.WithAttributes(semconv.ServiceName(DefaultServiceName)),
+		resource.WithFromEnv(),
+		resource.WithTelemetrySDK(),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	processor := sdktrace.WithSyncer(exporter)
+	if batch {
+		processor = sdktrace.WithBatcher(exporter)
+	}
+	provider := sdktrace.NewTracerProvider(processor, sdktrace.WithResource(res))
+	otel.SetTracerProvider(provider)
+
+	return provider.Shutdown, nil
+}
+
+// Tracer returns the tracer for this module's spans
+func Tracer() trace.Tracer {
+	return otel.Tracer(instrumentationName)
+}
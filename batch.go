@@ -0,0 +1,259 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"latlongapi/backend/geocode"
+	"latlongapi/backend/middleware"
+	"latlongapi/backend/models"
+	"log/slog"
+	"mime"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Defaults for the batch conversion endpoint.
+const (
+	defaultBatchConcurrency = 4
+	defaultBatchMaxItems    = 1000
+	maxBatchBodyBytes       = 10 << 20 // 10 MB
+)
+
+// batchConfig controls concurrency and size limits for batch conversions.
+var batchConfig = struct {
+	Concurrency int
+	MaxItems    int
+}{
+	Concurrency: defaultBatchConcurrency,
+	MaxItems:    defaultBatchMaxItems,
+}
+
+// configureBatch reads batch settings from the environment.
+func configureBatch() {
+	batchConfig.Concurrency = envInt("BATCH_CONCURRENCY", defaultBatchConcurrency)
+	batchConfig.MaxItems = envInt("BATCH_MAX_ITEMS", defaultBatchMaxItems)
+}
+
+// batchItem is a single coordinate pair in a batch conversion request.
+type batchItem struct {
+	Lat *float64 `json:"lat"`
+	Lng *float64 `json:"lng"`
+
+	err error // Set when the item could not be decoded
+}
+
+// apiConvertBatchHandler is a batch reverse geocoding API endpoint.
+// It accepts a JSON array, or NDJSON when sent as application/x-ndjson,
+// of {"lat": ..., "lng": ...} objects and returns one result per item in
+// input order. Items that fail carry an "error" field instead of address data.
+func apiConvertBatchHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, X-API-Key")
+
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	ndjson := isNDJSON(r.Header.Get("Content-Type"))
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxBatchBodyBytes)
+	var items []batchItem
+	var err error
+	if ndjson {
+		items, err = decodeNDJSONBatch(r)
+	} else {
+		err = json.NewDecoder(r.Body).Decode(&items)
+	}
+	if err != nil {
+		writeBatchError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if len(items) == 0 {
+		writeBatchError(w, "Request must contain at least one item", http.StatusBadRequest)
+		return
+	}
+	if len(items) > batchConfig.MaxItems {
+		writeBatchError(w, fmt.Sprintf("Batch must not contain more than %d items", batchConfig.MaxItems), http.StatusBadRequest)
+		return
+	}
+
+	// Each item counts against the monthly quota
+	if !middleware.ChargeQuota(w, r, len(items)) {
+		return
+	}
+
+	// Large batches can take far longer than WRITE_TIMEOUT, as upstream calls
+	// are paced; they stop when the client goes away instead
+	if err := http.NewResponseController(w).SetWriteDeadline(time.Time{}); err != nil {
+		slog.WarnContext(r.Context(), "could not lift write deadline for batch", "error", err)
+	}
+
+	results := convertBatch(r.Context(), items)
+	if r.Context().Err() != nil {
+		// Client went away; nothing left to respond to
+		return
+	}
+
+	if ndjson {
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		enc := json.NewEncoder(w)
+		for _, result := range results {
+			if err := enc.Encode(result); err != nil {
+				slog.WarnContext(r.Context(), "error writing batch response", "item", result.Index, "error", err)
+				return
+			}
+		}
+		return
+	}
+
+	failed := 0
+	for _, result := range results {
+		if result.Error != "" {
+			failed++
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(models.BatchResponse{
+		Count:     len(results),
+		Succeeded: len(results) - failed,
+		Failed:    failed,
+		Results:   results,
+	}); err != nil {
+		slog.WarnContext(r.Context(), "error writing batch response", "error", err)
+	}
+}
+
+// convertBatch reverse geocodes items with a bounded worker pool. Each worker
+// checks geocodeCache before calling upstream, where calls are paced by the
+// shared upstream rate limiter.
+func convertBatch(ctx context.Context, items []batchItem) []models.BatchResult {
+	results := make([]models.BatchResult, len(items))
+	jobs := make(chan int)
+
+	workers := batchConfig.Concurrency
+	if workers > len(items) {
+		workers = len(items)
+	}
+
+	var wg sync.WaitGroup
+	for n := 0; n < workers; n++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				results[i] = convertBatchItem(ctx, i, items[i])
+			}
+		}()
+	}
+
+	for i := range items {
+		select {
+		case jobs <- i:
+		case <-ctx.Done():
+		}
+	}
+	close(jobs)
+	wg.Wait()
+
+	return results
+}
+
+// convertBatchItem validates and reverse geocodes a single batch item.
+func convertBatchItem(ctx context.Context, index int, item batchItem) models.BatchResult {
+	result := models.BatchResult{Index: index}
+
+	if item.err != nil {
+		result.Error = item.err.Error()
+		return result
+	}
+	if item.Lat == nil || item.Lng == nil {
+		result.Error = "Missing required fields: lat and lng"
+		return result
+	}
+
+	lat, lng := *item.Lat, *item.Lng
+	if err := validateCoordinates(lat, lng); err != nil {
+		result.Error = err.Error()
+		return result
+	}
+
+	// Cache hits do not count against the upstream rate
+	key := geocodeCacheKey(lat, lng)
+	place, ok := geocodeCache.Get(key)
+	if !ok {
+		fetched, err := reverseGeocode(ctx, lat, lng)
+		switch {
+		case errors.Is(err, geocode.ErrQueueFull):
+			result.Error = "Upstream geocoder is busy, please retry later"
+			return result
+		case errors.Is(err, geocode.ErrNotFound):
+			result.Error = "No address found for these coordinates"
+			return result
+		case err != nil:
+			slog.ErrorContext(ctx, "batch reverse geocoding failed", "item", index, "lat", lat, "lng", lng, "error", err)
+			result.Error = "Failed to geocode coordinates"
+			return result
+		}
+		geocodeCache.Set(key, fetched)
+		place = fetched
+	}
+
+	resp := models.NewConvertResponse(lat, lng, place.(*models.Place))
+	result.ConvertResponse = &resp
+	return result
+}
+
+// decodeNDJSONBatch reads one batch item per line. Lines that are not valid
+// JSON become items carrying a decode error rather than failing the batch.
+func decodeNDJSONBatch(r *http.Request) ([]batchItem, error) {
+	var items []batchItem
+	scanner := bufio.NewScanner(r.Body)
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if len(line) == 0 {
+			continue
+		}
+		var item batchItem
+		if err := json.Unmarshal(line, &item); err != nil {
+			item = batchItem{err: errors.New("Invalid JSON line")}
+		}
+		items = append(items, item)
+		if len(items) > batchConfig.MaxItems {
+			break
+		}
+	}
+	return items, scanner.Err()
+}
+
+// isNDJSON reports whether contentType names a newline-delimited JSON body.
+func isNDJSON(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	return mediaType == "application/x-ndjson" || mediaType == "application/jsonl"
+}
+
+// writeBatchError writes a JSON error for a request that failed as a whole.
+func writeBatchError(w http.ResponseWriter, message string, statusCode int) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(statusCode)
+	json.NewEncoder(w).Encode(map[string]string{
+		"error": message,
+	})
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"latlongapi/backend/cache"
+	"latlongapi/backend/middleware"
+	"latlongapi/backend/models"
+	"latlongapi/backend/ratelimit"
+	"latlongapi/backend/store"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// slowGeocoder answers reverse lookups after a delay of lng milliseconds,
+// so that items of one batch finish out of order
+type slowGeocoder struct{}
+
+func (slowGeocoder) Reverse(ctx context.Context, lat, lng float64) (*models.Place, error) {
+	time.Sleep(time.Duration(lng) * time.Millisecond)
+	return &models.Place{FormattedAddress: fmt.Sprintf("%g,%g", lat, lng)}, nil
+}
+
+func (slowGeocoder) Search(ctx context.Context, query string, limit int) ([]models.Place, error) {
+	return nil, nil
+}
+
+// useTestGeocoder replaces the geocoder and cache for the duration of the test
+func useTestGeocoder(t *testing.T) {
+	t.Helper()
+	previousGeocoder, previousCache := geocoder, geocodeCache
+	geocoder = slowGeocoder{}
+	geocodeCache = cache.NewLRU(100, time.Minute)
+	t.Cleanup(func() { geocoder, geocodeCache = previousGeocoder, previousCache })
+}
+
+// postBatch sends body to the batch endpoint
+func postBatch(t *testing.T, handler http.Handler, contentType, body string, apiKey *models.APIKey) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/convert/batch", strings.NewReader(body))
+	req.Header.Set("Content-Type", contentType)
+	if apiKey != nil {
+		req = req.WithContext(context.WithValue(req.Context(), "apiKey", apiKey))
+	}
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestBatchJSONArray(t *testing.T) {
+	useTestGeocoder(t)
+
+	body := `[{"lat": 1, "lng": 2}, {"lat": 200, "lng": 0}, {"lat": 3}]`
+	rec := postBatch(t, http.HandlerFunc(apiConvertBatchHandler), "application/json", body, nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("got status %d, want %d: %s", rec.Code, http.StatusOK, rec.Body)
+	}
+
+	var resp models.BatchResponse
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatalf("decoding response: %v", err)
+	}
+	if resp.Count != 3 || resp.Succeeded != 1 || resp.Failed != 2 {
+		t.Errorf("got count %d, succeeded %d, failed %d; want 3, 1, 2", resp.Count, resp.Succeeded, resp.Failed)
+	}
+	if r := resp.Results[0]; r.ConvertResponse == nil || r.Latitude != 1 || r.Longitude != 2 || r.FormattedAddress != "1,2" {
+		t.Errorf("item 0: got %+v", r)
+	}
+	if r := resp.Results[1]; r.Error != "Latitude must be between -90 and 90" {
+		t.Errorf("item 1: got %+v", r)
+	}
+	if r := resp.Results[2]; r.Error != "Missing required fields: lat and lng" {
+		t.Errorf("item 2: got %+v", r)
+	}
+}
+
+func TestBatchNDJSON(t *testing.T) {
+	useTestGeocoder(t)
+
+	// A malformed line fails only its own item; blank lines are skipped
+	body := "{\"lat\": 1, \"lng\": 2}\n{\"lat\": \n\n{\"lat\": 3, \"lng\": 4}\n"
+	rec := postBatch(t, http.HandlerFunc(apiConvertBatchHandler), "application/x-ndjson", body, nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("got status %d, want %d: %s", rec.Code, http.StatusOK, rec.Body)
+	}
+	if ct := rec.Header().Get("Content-Type"); ct != "application/x-ndjson" {
+		t.Errorf("got Content-Type %q", ct)
+	}
+
+	var results []models.BatchResult
+	dec := json.NewDecoder(rec.Body)
+	for dec.More() {
+		var result models.BatchResult
+		if err := dec.Decode(&result); err != nil {
+			t.Fatalf("decoding line %d: %v", len(results), err)
+		}
+		results = append(results, result)
+	}
+	if len(results) != 3 {
+		t.Fatalf("got %d results, want 3", len(results))
+	}
+	if results[0].Error != "" || results[2].Error != "" || results[2].FormattedAddress != "3,4" {
+		t.Errorf("got results %+v, %+v", results[0], results[2])
+	}
+	if results[1].Index != 1 || results[1].Error != "Invalid JSON line" {
+		t.Errorf("malformed line: got %+v", results[1])
+	}
+}
+
+func TestBatchTooManyItems(t *testing.T) {
+	useTestGeocoder(t)
+
+	items := strings.Repeat(`{"lat": 1, "lng": 0},`, batchConfig.MaxItems+1)
+	for _, tt := range []struct{ contentType, body string }{
+		{"application/json", "[" + strings.TrimSuffix(items, ",") + "]"},
+		{"application/x-ndjson", strings.ReplaceAll(items, ",", "\n")},
+	} {
+		rec := postBatch(t, http.HandlerFunc(apiConvertBatchHandler), tt.contentType, tt.body, nil)
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: got status %d, want %d", tt.contentType, rec.Code, http.StatusBadRequest)
+		}
+	}
+}
+
+func TestBatchChargesQuotaPerItem(t *testing.T) {
+	useTestGeocoder(t)
+
+	memStore := store.NewMemoryStore()
+	user, err := memStore.CreateUser("kim@example.com", "hash")
+	if err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+	apiKey := &models.APIKey{ID: 1, UserID: user.ID}
+	limiter := ratelimit.NewLimiter(memStore)
+	handler := middleware.BatchRateLimitMiddleware(memStore, memStore, limiter)(http.HandlerFunc(apiConvertBatchHandler))
+
+	// Failed items are charged too: the batch is charged as read
+	monthly := models.GetPlan(user.Plan).MonthlyRequests
+	rec := postBatch(t, handler, "application/json", `[{"lat": 1, "lng": 0}, {"lat": 2, "lng": 0}, {"lat": 200, "lng": 0}]`, apiKey)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("got status %d, want %d: %s", rec.Code, http.StatusOK, rec.Body)
+	}
+	if got := rec.Header().Get("X-RateLimit-Remaining"); got != strconv.Itoa(monthly-3) {
+		t.Errorf("got %s remaining, want %d", got, monthly-3)
+	}
+
+	// A batch larger than the remaining quota is rejected as a whole
+	if d, _ := limiter.Charge(ratelimit.UserAccount(user.ID), models.GetPlan(user.Plan), time.Now(), monthly-5); !d.Allowed {
+		t.Fatalf("using up the quota: %+v", d)
+	}
+	rec = postBatch(t, handler, "application/json", `[{"lat": 1, "lng": 0}, {"lat": 2, "lng": 0}, {"lat": 3, "lng": 0}]`, apiKey)
+	if rec.Code != http.StatusTooManyRequests {
+		t.Errorf("over quota: got status %d, want %d", rec.Code, http.StatusTooManyRequests)
+	}
+	if got := rec.Header().Get("X-RateLimit-Remaining"); got != "2" {
+		t.Errorf("over quota: got %s remaining, want 2", got)
+	}
+}
+
+func TestConvertBatchKeepsOrder(t *testing.T) {
+	useTestGeocoder(t)
+
+	// Earlier items take longer, so the workers finish them last
+	items := make([]batchItem, 12)
+	for i := range items {
+		lat, lng := float64(i), float64(len(items)-i)*5
+		items[i] = batchItem{Lat: &lat, Lng: &lng}
+	}
+
+	results := convertBatch(context.Background(), items)
+	if len(results) != len(items) {
+		t.Fatalf("got %d results, want %d", len(results), len(items))
+	}
+	for i, r := range results {
+		if r.Index != i || r.ConvertResponse == nil || r.Latitude != float64(i) {
+			t.Errorf("result %d: got %+v", i, r)
+		}
+	}
+}
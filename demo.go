@@ -0,0 +1,96 @@
+package main
+
+import (
+	"encoding/json"
+	"latlongapi/backend/geocode"
+	"latlongapi/backend/handlers"
+	"latlongapi/backend/models"
+	"latlongapi/backend/ratelimit"
+	"log/slog"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// defaultDemoRequestsPerMinute is how many demo lookups one client may make
+// per minute.
+const defaultDemoRequestsPerMinute = 10
+
+// demoSample answers demo lookups that are not cached, so that the keyless
+// demo never spends upstream capacity or paid quota.
+var demoSample = geocode.NewStub()
+
+// demoConvertHandler serves reverse geocoding for the interactive demo page.
+// Unlike /api/v1/convert it needs no API key, so it only answers requests
+// from pages of the site at origin, limits each client address, and never
+// calls the upstream geocoder: cached results are served as they are and
+// anything else gets a sample address, marked by X-Demo-Result: sample.
+func demoConvertHandler(origin string, limiter *ratelimit.KeyLimiter) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+
+		if !fromSite(r, origin) {
+			w.WriteHeader(http.StatusForbidden)
+			json.NewEncoder(w).Encode(map[string]string{
+				"error": "The demo endpoint is only available to the demo page; use /api/v1/convert with an API key",
+			})
+			return
+		}
+
+		if ok, retryAfter := limiter.Allow(handlers.ClientIP(r), time.Now()); !ok {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+			w.WriteHeader(http.StatusTooManyRequests)
+			json.NewEncoder(w).Encode(map[string]string{
+				"error": "Too many demo requests, please wait a moment",
+			})
+			return
+		}
+
+		lat, lng, ok := parseCoordinates(w, r)
+		if !ok {
+			return
+		}
+
+		var place *models.Place
+		if cached, ok := geocodeCache.Get(geocodeCacheKey(lat, lng)); ok {
+			place = cached.(*models.Place)
+			w.Header().Set("X-Cache", "HIT")
+		} else {
+			place, _ = demoSample.Reverse(r.Context(), lat, lng)
+			w.Header().Set("X-Cache", "MISS")
+			w.Header().Set("X-Demo-Result", "sample")
+		}
+
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(models.NewConvertResponse(lat, lng, place)); err != nil {
+			slog.WarnContext(r.Context(), "error writing demo response", "error", err)
+		}
+	}
+}
+
+// fromSite reports whether r was sent by a page served from origin. Browsers
+// send Origin on cross-origin requests and Referer on same-origin ones.
+// Either can be forged outside a browser, which is why the demo endpoint is
+// also rate limited and serves no fresh lookups.
+func fromSite(r *http.Request, origin string) bool {
+	if o := r.Header.Get("Origin"); o != "" {
+		return o == origin
+	}
+	referer, err := url.Parse(r.Header.Get("Referer"))
+	if err != nil || referer.Host == "" {
+		return false
+	}
+	return referer.Scheme+"://"+referer.Host == origin
+}
+
+// siteOrigin returns the scheme and host of publicURL.
+func siteOrigin(publicURL string) string {
+	u, err := url.Parse(publicURL)
+	if err != nil {
+		return publicURL
+	}
+	return u.Scheme + "://" + u.Host
+}
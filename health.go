@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"latlongapi/backend/geocode"
+	"latlongapi/backend/health"
+	"latlongapi/backend/store"
+	"net/http"
+	"os"
+	"time"
+)
+
+// Defaults for the readiness checks.
+const (
+	defaultHealthTimeout    = 5 * time.Second
+	defaultGeocoderProbeTTL = time.Minute
+)
+
+// pageTemplates are the templates the page handlers render.
+var pageTemplates = []string{
+	"layout.html", "index.html", "docs.html", "demo.html", "pricing.html",
+	"why-latlong-gps.html", "personal.html", "business.html", "login.html", "404.html",
+}
+
+// readiness holds the checks served on /readyz.
+var readiness = health.NewRegistry()
+
+// registerHealthChecks adds the readiness checks. The store and templates are
+// critical; the geocoder only degrades readiness unless
+// HEALTH_GEOCODER_CRITICAL=true, as cached results can still be served
+// while it is down. Its probe result is cached for HEALTH_GEOCODER_TTL so
+// that frequent readiness probes do not hit the provider.
+func registerHealthChecks(dataStore store.Store, provider geocode.Geocoder) {
+	timeout := envDuration("HEALTH_TIMEOUT", defaultHealthTimeout)
+
+	readiness.Register(health.Check{
+		Name:     "store",
+		Check:    dataStore.Ping,
+		Critical: true,
+		Timeout:  timeout,
+	})
+	readiness.Register(health.Check{
+		Name:     "templates",
+		Check:    checkTemplates,
+		Critical: true,
+		Timeout:  timeout,
+	})
+
+	if pinger, ok := provider.(geocode.Pinger); ok {
+		readiness.Register(health.Check{
+			Name:     "geocoder",
+			Check:    pinger.Ping,
+			Critical: os.Getenv("HEALTH_GEOCODER_CRITICAL") == "true",
+			Timeout:  timeout,
+			CacheTTL: envDuration("HEALTH_GEOCODER_TTL", defaultGeocoderProbeTTL),
+		})
+	}
+}
+
+// checkTemplates reports whether every page template was loaded.
+func checkTemplates(ctx context.Context) error {
+	if tmplCache == nil {
+		return errors.New("templates not loaded")
+	}
+	for _, name := range pageTemplates {
+		if tmplCache.Lookup(name) == nil {
+			return fmt.Errorf("template %s not loaded", name)
+		}
+	}
+	return nil
+}
+
+// livezHandler reports that the process is up and serving requests. It
+// checks no dependencies, so that a failing dependency does not get the
+// process restarted.
+func livezHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Write([]byte(`{"status":"ok"}`))
+}
@@ -1,25 +1,73 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"html/template"
 	"io"
+	"latlongapi/backend/auth"
+	"latlongapi/backend/cache"
+	"latlongapi/backend/geocode"
 	"latlongapi/backend/handlers"
+	"latlongapi/backend/logging"
+	"latlongapi/backend/mail"
 	"latlongapi/backend/middleware"
+	"latlongapi/backend/models"
+	"latlongapi/backend/oidc"
+	"latlongapi/backend/ratelimit"
 	"latlongapi/backend/store"
+	"latlongapi/backend/tracing"
 	"log"
+	"log/slog"
+	"math"
 	"net/http"
-	"net/url"
 	"os"
 	"strconv"
 	"strings"
 	"time"
+
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // tmplCache holds parsed templates.
 var tmplCache *template.Template
 
+// geocoder is the geocoding provider selected at startup.
+var geocoder geocode.Geocoder
+
+// geocodeCache holds recent reverse geocoding results keyed by rounded coordinates.
+var geocodeCache *cache.LRU
+
+// cachePrecision is the number of decimal places coordinates are rounded to
+// when building cache keys (5 places is roughly 1 metre).
+var cachePrecision = defaultCachePrecision
+
+// Defaults for the reverse geocoding cache.
+const (
+	defaultCacheSize      = 10000
+	defaultCacheTTL       = 24 * time.Hour
+	defaultCachePrecision = 5
+)
+
+// Defaults for the shared upstream rate limiter. Nominatim's usage policy
+// allows at most one request per second.
+const (
+	defaultUpstreamRPS   = 1
+	defaultUpstreamBurst = 1
+	defaultUpstreamQueue = 50
+)
+
+// Result limits for the forward geocoding endpoint.
+const (
+	defaultSearchLimit = 5
+	maxSearchLimit     = 40
+)
+
 // loadTemplates parses all templates in the templates directory.
 func loadTemplates() {
 	var err error
@@ -30,12 +78,12 @@ func loadTemplates() {
 }
 
 // renderTemplate renders a named template wrapped in the base layout.
-func renderTemplate(w http.ResponseWriter, name string, data any) {
+func renderTemplate(w http.ResponseWriter, r *http.Request, name string, data any) {
 	w.Header().Set("Content-Type", "text/html; charset=utf-8")
 	// Execute the page template which includes layout.html via blocks
 	err := tmplCache.ExecuteTemplate(w, name, data)
 	if err != nil {
-		log.Printf("error rendering template %s: %v", name, err)
+		slog.ErrorContext(r.Context(), "error rendering template", "template", name, "error", err)
 		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 	}
 }
@@ -46,56 +94,56 @@ func homeHandler(w http.ResponseWriter, r *http.Request) {
 		notFoundHandler(w, r)
 		return
 	}
-	renderTemplate(w, "index.html", map[string]any{
+	renderTemplate(w, r, "index.html", map[string]any{
 		"Title": "LatLongAPI - Simple Latitude & Longitude API in Go",
 	})
 }
 
 // docsHandler serves a simple API documentation page.
 func docsHandler(w http.ResponseWriter, r *http.Request) {
-	renderTemplate(w, "docs.html", map[string]any{
+	renderTemplate(w, r, "docs.html", map[string]any{
 		"Title": "LatLongAPI Docs",
 	})
 }
 
 // demoHandler serves the interactive demo page.
 func demoHandler(w http.ResponseWriter, r *http.Request) {
-	renderTemplate(w, "demo.html", map[string]any{
+	renderTemplate(w, r, "demo.html", map[string]any{
 		"Title": "LatLongAPI Demo",
 	})
 }
 
 // pricingHandler serves a simple pricing page.
 func pricingHandler(w http.ResponseWriter, r *http.Request) {
-	renderTemplate(w, "pricing.html", map[string]any{
+	renderTemplate(w, r, "pricing.html", map[string]any{
 		"Title": "LatLongAPI Pricing",
 	})
 }
 
 // whyLatLongGPSHandler serves the WhyLatLongGPS page.
 func whyLatLongGPSHandler(w http.ResponseWriter, r *http.Request) {
-	renderTemplate(w, "why-latlong-gps.html", map[string]any{
+	renderTemplate(w, r, "why-latlong-gps.html", map[string]any{
 		"Title": "Why LatLongGPS",
 	})
 }
 
 // personalHandler serves the Personal page.
 func personalHandler(w http.ResponseWriter, r *http.Request) {
-	renderTemplate(w, "personal.html", map[string]any{
+	renderTemplate(w, r, "personal.html", map[string]any{
 		"Title": "Personal - LatLongAPI",
 	})
 }
 
 // businessHandler serves the Business page.
 func businessHandler(w http.ResponseWriter, r *http.Request) {
-	renderTemplate(w, "business.html", map[string]any{
+	renderTemplate(w, r, "business.html", map[string]any{
 		"Title": "Business - LatLongAPI",
 	})
 }
 
 // loginHandler serves the login page.
 func loginHandler(w http.ResponseWriter, r *http.Request) {
-	renderTemplate(w, "login.html", map[string]any{
+	renderTemplate(w, r, "login.html", map[string]any{
 		"Title": "Login - LatLongAPI",
 	})
 }
@@ -103,62 +151,85 @@ func loginHandler(w http.ResponseWriter, r *http.Request) {
 // notFoundHandler renders a custom 404 page.
 func notFoundHandler(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusNotFound)
-	renderTemplate(w, "404.html", map[string]any{
+	renderTemplate(w, r, "404.html", map[string]any{
 		"Title": "Page not found",
 		"Path":  r.URL.Path,
 	})
 }
 
-// reverseGeocode uses OpenStreetMap Nominatim API to convert coordinates to address.
-func reverseGeocode(lat, lng float64) (map[string]interface{}, error) {
-	// Parse coordinates
-	latStr := strconv.FormatFloat(lat, 'f', 6, 64)
-	lngStr := strconv.FormatFloat(lng, 'f', 6, 64)
+// reverseGeocode converts coordinates to a place using the configured geocoder.
+// ctx carries the request ID, which is logged here and sent upstream.
+func reverseGeocode(ctx context.Context, lat, lng float64) (*models.Place, error) {
+	start := time.Now()
+	place, err := geocoder.Reverse(ctx, lat, lng)
 
-	// Build Nominatim API URL
-	apiURL := fmt.Sprintf("https://nominatim.openstreetmap.org/reverse?format=json&lat=%s&lon=%s&zoom=18&addressdetails=1",
-		url.QueryEscape(latStr), url.QueryEscape(lngStr))
-
-	// Create HTTP client with proper User-Agent (required by Nominatim)
-	client := &http.Client{
-		Timeout: 10 * time.Second,
-	}
-
-	req, err := http.NewRequest("GET", apiURL, nil)
+	attrs := []any{"lat", lat, "lng", lng, "duration_ms", durationMS(time.Since(start))}
 	if err != nil {
-		return nil, err
+		attrs = append(attrs, "error", err)
 	}
-	req.Header.Set("User-Agent", "LatLongAPI-Go/1.0")
+	slog.DebugContext(ctx, "reverse geocode", attrs...)
+	return place, err
+}
 
-	resp, err := client.Do(req)
-	if err != nil {
-		return nil, err
-	}
-	defer resp.Body.Close()
+// geocodeCacheKey returns the cache key for a coordinate pair.
+func geocodeCacheKey(lat, lng float64) string {
+	return cache.CoordinateKey(lat, lng, cachePrecision)
+}
 
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("nominatim API returned status %d", resp.StatusCode)
+// cachedReverseGeocode serves reverse geocoding results from geocodeCache,
+// falling back to reverseGeocode on a miss. It reports whether the result
+// was a cache hit.
+func cachedReverseGeocode(ctx context.Context, lat, lng float64) (*models.Place, bool, error) {
+	key := geocodeCacheKey(lat, lng)
+	if cached, ok := geocodeCache.Get(key); ok {
+		return cached.(*models.Place), true, nil
 	}
 
-	body, err := io.ReadAll(resp.Body)
+	place, err := reverseGeocode(ctx, lat, lng)
 	if err != nil {
-		return nil, err
+		return nil, false, err
 	}
+	geocodeCache.Set(key, place)
+	return place, false, nil
+}
 
-	var data map[string]interface{}
-	if err := json.Unmarshal(body, &data); err != nil {
-		return nil, err
+// respondUpstreamBusy writes a 503 response with a Retry-After header when err
+// reports that the upstream geocoder queue is full. It returns false for any
+// other error.
+func respondUpstreamBusy(w http.ResponseWriter, err error) bool {
+	var queueFull *geocode.QueueFullError
+	if !errors.As(err, &queueFull) {
+		return false
 	}
 
-	return data, nil
+	retryAfter := int(math.Ceil(queueFull.RetryAfter.Seconds()))
+	if retryAfter < 1 {
+		retryAfter = 1
+	}
+	w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+	w.WriteHeader(http.StatusServiceUnavailable)
+	json.NewEncoder(w).Encode(map[string]string{
+		"error": "Upstream geocoder is busy, please retry later",
+	})
+	return true
 }
 
-// apiConvertHandler is a reverse geocoding API endpoint.
-// It accepts lat and lng query parameters and returns address information.
-func apiConvertHandler(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json; charset=utf-8")
-	w.Header().Set("Access-Control-Allow-Origin", "*")
+// validateCoordinates checks that lat and lng are finite and within valid
+// ranges. strconv.ParseFloat accepts "NaN" and "Inf", which compare false
+// against any bound and cannot be encoded as JSON.
+func validateCoordinates(lat, lng float64) error {
+	if math.IsNaN(lat) || math.IsInf(lat, 0) || lat < -90 || lat > 90 {
+		return errors.New("Latitude must be between -90 and 90")
+	}
+	if math.IsNaN(lng) || math.IsInf(lng, 0) || lng < -180 || lng > 180 {
+		return errors.New("Longitude must be between -180 and 180")
+	}
+	return nil
+}
 
+// parseCoordinates reads and validates the lat and lng query parameters,
+// writing a 400 response if they are missing or invalid.
+func parseCoordinates(w http.ResponseWriter, r *http.Request) (lat, lng float64, ok bool) {
 	latStr := r.URL.Query().Get("lat")
 	lngStr := r.URL.Query().Get("lng")
 
@@ -167,7 +238,7 @@ func apiConvertHandler(w http.ResponseWriter, r *http.Request) {
 		json.NewEncoder(w).Encode(map[string]string{
 			"error": "Missing required parameters: lat and lng",
 		})
-		return
+		return 0, 0, false
 	}
 
 	lat, err := strconv.ParseFloat(latStr, 64)
@@ -176,39 +247,65 @@ func apiConvertHandler(w http.ResponseWriter, r *http.Request) {
 		json.NewEncoder(w).Encode(map[string]string{
 			"error": fmt.Sprintf("Invalid latitude: %s", latStr),
 		})
-		return
+		return 0, 0, false
 	}
 
-	lng, err := strconv.ParseFloat(lngStr, 64)
+	lng, err = strconv.ParseFloat(lngStr, 64)
 	if err != nil {
 		w.WriteHeader(http.StatusBadRequest)
 		json.NewEncoder(w).Encode(map[string]string{
 			"error": fmt.Sprintf("Invalid longitude: %s", lngStr),
 		})
-		return
+		return 0, 0, false
 	}
 
 	// Validate coordinate ranges
-	if lat < -90 || lat > 90 {
+	if err := validateCoordinates(lat, lng); err != nil {
 		w.WriteHeader(http.StatusBadRequest)
 		json.NewEncoder(w).Encode(map[string]string{
-			"error": "Latitude must be between -90 and 90",
+			"error": err.Error(),
 		})
-		return
+		return 0, 0, false
 	}
 
-	if lng < -180 || lng > 180 {
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(map[string]string{
-			"error": "Longitude must be between -180 and 180",
-		})
+	return lat, lng, true
+}
+
+// apiConvertHandler is a reverse geocoding API endpoint.
+// It accepts lat and lng query parameters and returns address information.
+func apiConvertHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, span := tracing.Tracer().Start(r.Context(), "apiConvertHandler")
+	defer span.End()
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+
+	lat, lng, ok := parseCoordinates(w, r)
+	if !ok {
 		return
 	}
 
+	span.SetAttributes(attribute.Float64("geo.lat", lat), attribute.Float64("geo.lng", lng))
+
 	// Perform reverse geocoding
-	geocodeData, err := reverseGeocode(lat, lng)
+	place, cacheHit, err := cachedReverseGeocode(ctx, lat, lng)
+	span.SetAttributes(attribute.Bool("cache.hit", cacheHit))
 	if err != nil {
-		log.Printf("Reverse geocoding error: %v", err)
+		if !errors.Is(err, geocode.ErrNotFound) {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		if respondUpstreamBusy(w, err) {
+			return
+		}
+		if errors.Is(err, geocode.ErrNotFound) {
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(map[string]string{
+				"error": "No address found for these coordinates",
+			})
+			return
+		}
+		slog.ErrorContext(ctx, "reverse geocoding failed", "lat", lat, "lng", lng, "error", err)
 		w.WriteHeader(http.StatusInternalServerError)
 		json.NewEncoder(w).Encode(map[string]string{
 			"error": "Failed to geocode coordinates",
@@ -216,89 +313,291 @@ func apiConvertHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Extract address information
-	response := map[string]interface{}{
-		"latitude":  latStr,
-		"longitude": lngStr,
+	if cacheHit {
+		w.Header().Set("X-Cache", "HIT")
+	} else {
+		w.Header().Set("X-Cache", "MISS")
 	}
 
-	// Extract display_name (full address)
-	if displayName, ok := geocodeData["display_name"].(string); ok {
-		response["address"] = displayName
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(models.NewConvertResponse(lat, lng, place)); err != nil {
+		slog.WarnContext(ctx, "error writing convert response", "error", err)
 	}
+}
 
-	// Extract address components
-	if addr, ok := geocodeData["address"].(map[string]interface{}); ok {
-		if country, ok := addr["country"].(string); ok {
-			response["country"] = country
-		}
-		if city, ok := addr["city"].(string); ok {
-			response["city"] = city
-		} else if town, ok := addr["town"].(string); ok {
-			response["city"] = town
-		} else if village, ok := addr["village"].(string); ok {
-			response["city"] = village
-		}
-		if state, ok := addr["state"].(string); ok {
-			response["state"] = state
-		}
-		if postcode, ok := addr["postcode"].(string); ok {
-			response["postcode"] = postcode
-		}
-		if road, ok := addr["road"].(string); ok {
-			response["road"] = road
-		}
-		if houseNumber, ok := addr["house_number"].(string); ok {
-			response["house_number"] = houseNumber
-		}
+// apiSearchHandler is a forward geocoding API endpoint.
+// It accepts a free-form q query parameter and returns ranked candidate coordinates.
+func apiSearchHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+
+	query := strings.TrimSpace(r.URL.Query().Get("q"))
+	if query == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": "Missing required parameter: q",
+		})
+		return
 	}
 
-	// Build a formatted address string if components exist
-	var addressParts []string
-	if addr, ok := geocodeData["address"].(map[string]interface{}); ok {
-		if houseNum, ok := addr["house_number"].(string); ok {
-			addressParts = append(addressParts, houseNum)
-		}
-		if road, ok := addr["road"].(string); ok {
-			addressParts = append(addressParts, road)
+	limit := defaultSearchLimit
+	if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
+		n, err := strconv.Atoi(limitStr)
+		if err != nil || n < 1 || n > maxSearchLimit {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{
+				"error": fmt.Sprintf("Limit must be between 1 and %d", maxSearchLimit),
+			})
+			return
 		}
-		if city, ok := addr["city"].(string); ok {
-			addressParts = append(addressParts, city)
-		} else if town, ok := addr["town"].(string); ok {
-			addressParts = append(addressParts, town)
-		} else if village, ok := addr["village"].(string); ok {
-			addressParts = append(addressParts, village)
-		}
-		if state, ok := addr["state"].(string); ok {
-			addressParts = append(addressParts, state)
-		}
-		if country, ok := addr["country"].(string); ok {
-			addressParts = append(addressParts, country)
-		}
-		if len(addressParts) > 0 && response["address"] == nil {
-			response["address"] = strings.Join(addressParts, ", ")
+		limit = n
+	}
+
+	// Perform forward geocoding
+	candidates, err := geocoder.Search(r.Context(), query, limit)
+	if err != nil {
+		if respondUpstreamBusy(w, err) {
+			return
 		}
+		slog.ErrorContext(r.Context(), "forward geocoding failed", "query", query, "error", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": "Failed to geocode query",
+		})
+		return
+	}
+
+	// Candidates are returned in the provider's ranking order
+	results := make([]models.SearchResult, 0, len(candidates))
+	for i, candidate := range candidates {
+		results = append(results, models.SearchResult{Rank: i + 1, Place: candidate})
 	}
 
 	enc := json.NewEncoder(w)
 	enc.SetIndent("", "  ")
-	_ = enc.Encode(response)
+	if err := enc.Encode(models.SearchResponse{
+		Query:   query,
+		Count:   len(results),
+		Results: results,
+	}); err != nil {
+		slog.WarnContext(r.Context(), "error writing search response", "error", err)
+	}
 }
 
-// healthHandler is a basic health check endpoint.
-func healthHandler(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json; charset=utf-8")
-	w.Write([]byte(`{"status":"ok"}`))
+// envInt reads a positive integer from the environment, falling back to def
+// when the variable is unset or invalid.
+func envInt(key string, def int) int {
+	v := os.Getenv(key)
+	if v == "" {
+		return def
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n <= 0 {
+		log.Printf("Ignoring invalid %s=%q, using %d", key, v, def)
+		return def
+	}
+	return n
+}
+
+// envDuration reads a positive duration (e.g. "30m") from the environment,
+// falling back to def when the variable is unset or invalid.
+func envDuration(key string, def time.Duration) time.Duration {
+	v := os.Getenv(key)
+	if v == "" {
+		return def
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil || d <= 0 {
+		log.Printf("Ignoring invalid %s=%q, using %s", key, v, def)
+		return def
+	}
+	return d
+}
+
+// envList reads a comma-separated list from the environment, skipping
+// empty entries.
+func envList(key string) []string {
+	var list []string
+	for _, v := range strings.Split(os.Getenv(key), ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			list = append(list, v)
+		}
+	}
+	return list
+}
+
+// loadOIDCProviders configures the identity providers listed in
+// OIDC_PROVIDERS. Each NAME is configured with OIDC_<NAME>_ISSUER,
+// OIDC_<NAME>_CLIENT_ID, OIDC_<NAME>_CLIENT_SECRET and optionally
+// OIDC_<NAME>_DISPLAY_NAME and OIDC_<NAME>_SCOPES.
+func loadOIDCProviders(publicURL string, production bool) ([]*oidc.Provider, error) {
+	var providers []*oidc.Provider
+	for _, name := range envList("OIDC_PROVIDERS") {
+		prefix := "OIDC_" + strings.ToUpper(strings.ReplaceAll(name, "-", "_")) + "_"
+		cfg := oidc.Config{
+			Name:         name,
+			DisplayName:  os.Getenv(prefix + "DISPLAY_NAME"),
+			Issuer:       os.Getenv(prefix + "ISSUER"),
+			ClientID:     os.Getenv(prefix + "CLIENT_ID"),
+			ClientSecret: os.Getenv(prefix + "CLIENT_SECRET"),
+			RedirectURL:  strings.TrimSuffix(publicURL, "/") + "/api/auth/oidc/" + name + "/callback",
+			Scopes:       strings.Fields(os.Getenv(prefix + "SCOPES")),
+		}
+		if cfg.Issuer == "" || cfg.ClientID == "" {
+			return nil, fmt.Errorf("OIDC provider %s needs %sISSUER and %sCLIENT_ID", name, prefix, prefix)
+		}
+		// Plain HTTP is only for local mock providers
+		if production && !strings.HasPrefix(cfg.Issuer, "https://") {
+			return nil, fmt.Errorf("OIDC provider %s: issuer must use https in production", name)
+		}
+		providers = append(providers, oidc.NewProvider(cfg))
+	}
+	return providers, nil
 }
 
 func main() {
+	// Structured logging (LOG_FORMAT json or text, LOG_LEVEL debug, info, warn or error)
+	logger, err := logging.New(logging.Config{
+		Format: os.Getenv("LOG_FORMAT"),
+		Level:  os.Getenv("LOG_LEVEL"),
+	}, os.Stderr)
+	if err != nil {
+		log.Fatalf("error configuring logging: %v", err)
+	}
+	slog.SetDefault(logger)
+
+	// Tracing (OTEL_TRACES_EXPORTER selects otlp, stdout or none; the SDK reads
+	// its other settings from the standard OTEL_* variables)
+	shutdownTracing, err := tracing.Setup(context.Background(), tracing.Config{
+		Exporter: os.Getenv("OTEL_TRACES_EXPORTER"),
+		Stdout:   os.Stdout,
+	})
+	if err != nil {
+		log.Fatalf("error configuring tracing: %v", err)
+	}
+
 	loadTemplates()
 
-	// Initialize user store
-	userStore := store.NewMemoryStore()
+	// APP_ENV=production refuses insecure development defaults
+	production := os.Getenv("APP_ENV") == "production"
+
+	port := os.Getenv("PORT")
+	if port == "" {
+		port = "8080"
+	}
+
+	// PUBLIC_URL is the address users reach the site at, used in emailed links
+	publicURL := os.Getenv("PUBLIC_URL")
+	if publicURL == "" {
+		publicURL = "http://localhost:" + port
+	}
+
+	// Initialize JWT signing keys (retired keys stay valid for verification during rotation)
+	keyRing, err := auth.LoadKeyRing(auth.KeyRingConfig{
+		Algorithm:       os.Getenv("JWT_ALGORITHM"),
+		Secret:          os.Getenv("JWT_SECRET"),
+		PrivateKeyFile:  os.Getenv("JWT_PRIVATE_KEY_FILE"),
+		PreviousSecrets: envList("JWT_PREVIOUS_SECRETS"),
+		VerifyKeyFiles:  envList("JWT_VERIFY_KEY_FILES"),
+		Production:      production,
+	})
+	if err != nil {
+		log.Fatalf("error configuring JWT keys: %v", err)
+	}
+	auth.SetKeyRing(keyRing)
+
+	// Initialize password hashing (PASSWORD_HASH selects bcrypt or argon2id;
+	// hashes made with other settings are upgraded when their users log in)
+	hashConfig := auth.DefaultPasswordHashConfig()
+	hashConfig.Algorithm = os.Getenv("PASSWORD_HASH")
+	hashConfig.BcryptCost = envInt("BCRYPT_COST", hashConfig.BcryptCost)
+	hashConfig.Argon2Time = uint32(envInt("ARGON2_TIME", int(hashConfig.Argon2Time)))
+	hashConfig.Argon2Memory = uint32(envInt("ARGON2_MEMORY", int(hashConfig.Argon2Memory)))
+	hashConfig.Argon2Threads = uint8(envInt("ARGON2_THREADS", int(hashConfig.Argon2Threads)))
+	if err := auth.SetPasswordHashing(hashConfig); err != nil {
+		log.Fatalf("error configuring password hashing: %v", err)
+	}
+
+	// Initialize the password policy for new passwords
+	passwordPolicy, err := auth.LoadPasswordPolicy(auth.PasswordPolicyConfig{
+		MinLength:        envInt("PASSWORD_MIN_LENGTH", 6),
+		MaxLength:        envInt("PASSWORD_MAX_LENGTH", 72),
+		MinClasses:       envInt("PASSWORD_MIN_CLASSES", 0),
+		BreachedListFile: os.Getenv("PASSWORD_BREACHED_LIST"),
+	})
+	if err != nil {
+		log.Fatalf("error configuring password policy: %v", err)
+	}
+	if n := passwordPolicy.BreachedCount(); n > 0 {
+		log.Printf("Loaded %d breached passwords", n)
+	}
+
+	// Initialize geocoder (GEOCODER selects the provider, GEOCODER_URL overrides its base URL)
+	provider, err := geocode.New(geocode.Config{
+		Provider: os.Getenv("GEOCODER"),
+		BaseURL:  os.Getenv("GEOCODER_URL"),
+	})
+	if err != nil {
+		log.Fatalf("error configuring geocoder: %v", err)
+	}
+
+	// All upstream calls share one rate limiter and coalesce identical requests
+	geocoder = geocode.NewLimited(geocode.NewObserved(provider, observeUpstream), geocode.NewTokenBucket(
+		float64(envInt("UPSTREAM_RPS", defaultUpstreamRPS)),
+		envInt("UPSTREAM_BURST", defaultUpstreamBurst),
+		envInt("UPSTREAM_QUEUE", defaultUpstreamQueue),
+	))
+	configureBatch()
+
+	// Initialize reverse geocoding cache
+	cachePrecision = envInt("CACHE_PRECISION", defaultCachePrecision)
+	geocodeCache = cache.NewLRU(
+		envInt("CACHE_SIZE", defaultCacheSize),
+		envDuration("CACHE_TTL", defaultCacheTTL),
+	)
+
+	// Initialize user store (STORE selects memory or sqlite, SQLITE_PATH sets the database file)
+	userStore, err := store.Open(os.Getenv("STORE"), os.Getenv("SQLITE_PATH"))
+	if err != nil {
+		log.Fatalf("error opening store: %v", err)
+	}
+	registerStateMetrics(userStore)
+	registerHealthChecks(userStore, provider)
+
+	// Initialize mailer (MAILER selects log, file or smtp)
+	mailer, err := mail.New(mail.Config{
+		Mailer:       os.Getenv("MAILER"),
+		From:         os.Getenv("MAIL_FROM"),
+		Dir:          os.Getenv("MAIL_DIR"),
+		SMTPAddr:     os.Getenv("SMTP_ADDR"),
+		SMTPUsername: os.Getenv("SMTP_USERNAME"),
+		SMTPPassword: os.Getenv("SMTP_PASSWORD"),
+	})
+	if err != nil {
+		log.Fatalf("error configuring mailer: %v", err)
+	}
+
+	oidcProviders, err := loadOIDCProviders(publicURL, production)
+	if err != nil {
+		log.Fatalf("error configuring OIDC: %v", err)
+	}
 
 	// Initialize auth handler
-	authHandler := handlers.NewAuthHandler(userStore)
+	loginGuardConfig := ratelimit.DefaultLoginGuardConfig()
+	loginGuardConfig.Account.LockoutThreshold = envInt("LOGIN_LOCKOUT_THRESHOLD", loginGuardConfig.Account.LockoutThreshold)
+	loginGuardConfig.LockoutDuration = envDuration("LOGIN_LOCKOUT_DURATION", loginGuardConfig.LockoutDuration)
+	authHandler := handlers.NewAuthHandler(userStore, userStore, userStore, mailer, publicURL, ratelimit.NewLoginGuard(loginGuardConfig))
+	authHandler.SetAdminEmails(envList("ADMIN_EMAILS"))
+	authHandler.SetPasswordPolicy(passwordPolicy)
+	authHandler.SetPasswordResetLimits(envInt("PASSWORD_RESET_EMAIL_LIMIT", 3), envInt("PASSWORD_RESET_IP_LIMIT", 20))
+	apiKeyHandler := handlers.NewAPIKeyHandler(userStore)
+	usageHandler := handlers.NewUsageHandler(userStore)
+	jwksHandler := handlers.NewJWKSHandler(keyRing)
+	oidcHandler := handlers.NewOIDCHandler(authHandler, userStore, oidcProviders)
+	accountHandler := handlers.NewAccountHandler(authHandler, userStore, userStore, userStore, userStore)
+	orgHandler := handlers.NewOrgHandler(authHandler, userStore, userStore, userStore)
+	adminHandler := handlers.NewAdminHandler(userStore, userStore, userStore)
 
 	mux := http.NewServeMux()
 
@@ -315,50 +614,189 @@ func main() {
 	// Auth API routes.
 	mux.HandleFunc("/api/auth/register", authHandler.Register)
 	mux.HandleFunc("/api/auth/login", authHandler.Login)
+	mux.HandleFunc("/api/auth/refresh", authHandler.Refresh)
 	mux.HandleFunc("/api/auth/logout", authHandler.Logout)
+	mux.HandleFunc("/api/auth/verify", authHandler.Verify)
+	mux.HandleFunc("/api/auth/forgot-password", authHandler.ForgotPassword)
+	mux.HandleFunc("/api/auth/reset-password", authHandler.ResetPassword)
+	mux.HandleFunc("/api/auth/mfa/verify", authHandler.VerifyMFA)
+	mux.HandleFunc("/api/auth/oidc/providers", oidcHandler.Providers)
+	mux.HandleFunc("/api/auth/oidc/", oidcHandler.Route)
+	mux.HandleFunc("/.well-known/jwks.json", jwksHandler.JWKS)
 	
 	// Protected routes (require authentication)
-	authMiddleware := middleware.AuthMiddleware(userStore)
-	mux.Handle("/api/auth/me", authMiddleware(http.HandlerFunc(authHandler.Me)))
-
-	// API routes.
-	mux.HandleFunc("/api/v1/convert", apiConvertHandler)
-	mux.HandleFunc("/healthz", healthHandler)
+	authMiddleware := middleware.AuthMiddleware(userStore, userStore)
+	mux.Handle("/api/auth/me", authMiddleware(http.HandlerFunc(accountHandler.Me)))
+	mux.Handle("/api/auth/me/export", authMiddleware(http.HandlerFunc(accountHandler.Export)))
+	mux.Handle("/api/auth/mfa/totp/enroll", authMiddleware(http.HandlerFunc(authHandler.EnrollTOTP)))
+	mux.Handle("/api/auth/mfa/totp/confirm", authMiddleware(http.HandlerFunc(authHandler.ConfirmTOTP)))
+	mux.Handle("/api/auth/mfa/totp/disable", authMiddleware(http.HandlerFunc(authHandler.DisableTOTP)))
+	mux.Handle("/api/keys", authMiddleware(http.HandlerFunc(apiKeyHandler.Keys)))
+	mux.Handle("/api/keys/", authMiddleware(http.HandlerFunc(apiKeyHandler.Key)))
+	mux.Handle("/api/orgs", authMiddleware(http.HandlerFunc(orgHandler.Orgs)))
+	mux.Handle("/api/orgs/invitations/accept", authMiddleware(http.HandlerFunc(orgHandler.AcceptInvitation)))
+	mux.Handle("/api/orgs/", authMiddleware(http.HandlerFunc(orgHandler.Org)))
+
+	// Admin routes (require the admin role).
+	adminOnly := func(h http.HandlerFunc) http.Handler {
+		return authMiddleware(middleware.RequireRole(models.RoleAdmin)(h))
+	}
+	mux.Handle("/api/admin/users", adminOnly(adminHandler.Users))
+	mux.Handle("/api/admin/users/", adminOnly(adminHandler.User))
+	mux.Handle("/api/admin/orgs/", adminOnly(adminHandler.Org))
+
+	// API routes (require an API key, are metered, and are limited by the owner's plan).
+	apiKeyMiddleware := middleware.APIKeyMiddleware(userStore)
+	usageMiddleware := middleware.UsageMiddleware(userStore)
+	limiter := ratelimit.NewLimiter(userStore)
+	rateLimitMiddleware := middleware.RateLimitMiddleware(userStore, userStore, limiter)
+	apiV1 := func(h http.HandlerFunc) http.Handler {
+		return apiKeyMiddleware(usageMiddleware(rateLimitMiddleware(h)))
+	}
+	// Batches are charged one quota unit per item
+	batchRateLimitMiddleware := middleware.BatchRateLimitMiddleware(userStore, userStore, limiter)
+	mux.Handle("/api/v1/convert", apiV1(apiConvertHandler))
+	mux.Handle("/api/v1/convert/batch", apiKeyMiddleware(usageMiddleware(batchRateLimitMiddleware(http.HandlerFunc(apiConvertBatchHandler)))))
+	mux.Handle("/api/v1/search", apiV1(apiSearchHandler))
+	mux.Handle("/api/v1/usage", authMiddleware(http.HandlerFunc(usageHandler.Usage)))
+
+	// Keyless endpoint used by the interactive demo page. It serves cached
+	// results only, to pages of this site, at a low rate per client.
+	demoLimiter := ratelimit.NewKeyLimiter(envInt("DEMO_REQUESTS_PER_MINUTE", defaultDemoRequestsPerMinute), time.Minute)
+	mux.HandleFunc("/api/demo/convert", demoConvertHandler(siteOrigin(publicURL), demoLimiter))
+
+	// Health checks. /healthz is kept as an alias of /livez.
+	mux.HandleFunc("/livez", livezHandler)
+	mux.HandleFunc("/healthz", livezHandler)
+	mux.Handle("/readyz", readiness.Handler())
+
+	// Prometheus metrics.
+	mux.Handle("/metrics", metricsHandler(os.Getenv("METRICS_TOKEN")))
 
 	// Static files.
 	staticDir := http.Dir("frontend/static")
 	fileServer := http.FileServer(staticDir)
 	mux.Handle("/static/", http.StripPrefix("/static/", fileServer))
 
-	// Custom 404.
+	// Custom 404, request metrics and access log.
 	muxWithNotFound := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		_, route := mux.Handler(r)
+		trace.SpanFromContext(r.Context()).SetAttributes(
+			attribute.String("http.route", route),
+			attribute.String("request_id", logging.RequestID(r.Context())),
+		)
+
 		// Let the mux try to serve the route first.
 		rr := &responseRecorder{ResponseWriter: w, status: http.StatusOK}
 		mux.ServeHTTP(rr, r)
-		if rr.status == http.StatusNotFound {
-			notFoundHandler(w, r)
+		// API handlers write their own JSON 404 responses.
+		if rr.status == http.StatusNotFound && !strings.HasPrefix(r.URL.Path, "/api/") {
+			notFoundHandler(rr, r)
 		}
+		observeRequest(route, rr.status, start)
+		logRequest(r, route, rr, start)
 	})
 
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "8080"
+	// Every request except probes and scrapes gets a server span, continuing
+	// the caller's trace when it sent a traceparent header
+	var handler http.Handler = middleware.RequestIDMiddleware(muxWithNotFound)
+	handler = otelhttp.NewHandler(handler, "http.server",
+		otelhttp.WithFilter(func(r *http.Request) bool {
+			_, route := mux.Handler(r)
+			return !quietRoutes[route]
+		}),
+		otelhttp.WithSpanNameFormatter(func(_ string, r *http.Request) string {
+			_, route := mux.Handler(r)
+			return strings.TrimSpace(r.Method + " " + route)
+		}),
+	)
+
+	// TRUST_PROXY=true takes client addresses from X-Forwarded-For
+	if os.Getenv("TRUST_PROXY") == "true" {
+		handler = middleware.RealIPMiddleware(handler)
 	}
 
-	addr := ":" + port
-	log.Printf("LatLongAPI Go server listening on %s", addr)
-	if err := http.ListenAndServe(addr, muxWithNotFound); err != nil {
+	// TLS_CERT_FILE and TLS_KEY_FILE, or TLS_SELF_SIGNED=true in development, serve HTTPS
+	tlsConfig, err := loadTLSConfig(production)
+	if err != nil {
+		log.Fatalf("error configuring TLS: %v", err)
+	}
+
+	srv := newServer(":"+port, handler)
+	srv.TLSConfig = tlsConfig
+	slog.Info("LatLongAPI Go server listening", "addr", srv.Addr, "tls", tlsConfig != nil)
+	if err := serve(srv, envDuration("SHUTDOWN_TIMEOUT", defaultShutdownTimeout)); err != nil {
 		log.Fatalf("server error: %v", err)
 	}
+
+	// In-flight requests are done; flush what they left behind
+	flushCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := shutdownTracing(flushCtx); err != nil {
+		slog.Warn("error flushing traces", "error", err)
+	}
+	if closer, ok := userStore.(io.Closer); ok {
+		if err := closer.Close(); err != nil {
+			slog.Warn("error closing store", "error", err)
+		}
+	}
+	slog.Info("Server stopped")
+}
+
+// quietRoutes are polled by probes and scrapers, so their requests are only
+// logged at debug level and are not traced.
+var quietRoutes = map[string]bool{
+	"/livez":   true,
+	"/healthz": true,
+	"/readyz":  true,
+	"/metrics": true,
 }
 
-// responseRecorder wraps an http.ResponseWriter to capture the status code.
+// logRequest writes the access log entry for a served request. The query
+// string is left out as it can carry API keys.
+func logRequest(r *http.Request, route string, rr *responseRecorder, start time.Time) {
+	level := slog.LevelInfo
+	if quietRoutes[route] {
+		level = slog.LevelDebug
+	}
+	slog.Log(r.Context(), level, "request",
+		"method", r.Method,
+		"path", r.URL.Path,
+		"route", route,
+		"status", rr.status,
+		"bytes", rr.bytes,
+		"duration_ms", durationMS(time.Since(start)),
+		"ip", handlers.ClientIP(r),
+		"user_agent", r.UserAgent(),
+	)
+}
+
+// durationMS converts d to fractional milliseconds for logging.
+func durationMS(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
+
+// responseRecorder wraps an http.ResponseWriter to capture the status code
+// and the number of body bytes written.
 type responseRecorder struct {
 	http.ResponseWriter
 	status int
+	bytes  int
 }
 
 func (rr *responseRecorder) WriteHeader(code int) {
 	rr.status = code
 	rr.ResponseWriter.WriteHeader(code)
 }
+
+func (rr *responseRecorder) Write(b []byte) (int, error) {
+	n, err := rr.ResponseWriter.Write(b)
+	rr.bytes += n
+	return n, err
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (rr *responseRecorder) Unwrap() http.ResponseWriter {
+	return rr.ResponseWriter
+}
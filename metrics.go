@@ -0,0 +1,121 @@
+package main
+
+import (
+	"crypto/subtle"
+	"errors"
+	"latlongapi/backend/geocode"
+	"latlongapi/backend/metrics"
+	"latlongapi/backend/models"
+	"log/slog"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// registry holds every metric served on /metrics.
+var registry = metrics.NewRegistry()
+
+// HTTP request metrics, labelled by the mux pattern that served the request.
+var (
+	httpRequests = registry.NewCounterVec(
+		"latlongapi_http_requests_total",
+		"HTTP requests served, by route and status code.",
+		"route", "status",
+	)
+	httpRequestDuration = registry.NewHistogramVec(
+		"latlongapi_http_request_duration_seconds",
+		"Time taken to serve HTTP requests, by route and status code.",
+		metrics.DefBuckets,
+		"route", "status",
+	)
+)
+
+// Upstream geocoder metrics. Only calls that reach the provider are counted,
+// not cache hits or requests coalesced into another caller's call.
+var (
+	upstreamRequests = registry.NewCounterVec(
+		"latlongapi_upstream_requests_total",
+		"Calls made to the upstream geocoder, by operation.",
+		"operation",
+	)
+	upstreamErrors = registry.NewCounterVec(
+		"latlongapi_upstream_errors_total",
+		"Upstream geocoder calls that failed, by operation. Places not found are not errors.",
+		"operation",
+	)
+	upstreamDuration = registry.NewHistogramVec(
+		"latlongapi_upstream_request_duration_seconds",
+		"Latency of upstream geocoder calls, by operation.",
+		metrics.DefBuckets,
+		"operation",
+	)
+)
+
+// observeUpstream records an upstream geocoder call.
+func observeUpstream(op string, duration time.Duration, err error) {
+	upstreamRequests.Inc(op)
+	upstreamDuration.Observe(duration.Seconds(), op)
+	if err != nil && !errors.Is(err, geocode.ErrNotFound) {
+		upstreamErrors.Inc(op)
+	}
+}
+
+// observeRequest records a served HTTP request.
+func observeRequest(route string, status int, start time.Time) {
+	if route == "" {
+		route = "unmatched"
+	}
+	code := strconv.Itoa(status)
+	httpRequests.Inc(route, code)
+	httpRequestDuration.ObserveDuration(start, route, code)
+}
+
+// registerStateMetrics adds metrics that are read from the cache and token
+// store each time /metrics is scraped.
+func registerStateMetrics(tokenStore models.TokenStore) {
+	registry.NewCounterFunc("latlongapi_cache_hits_total", "Reverse geocoding cache hits.", func() float64 {
+		return float64(geocodeCache.Stats().Hits)
+	})
+	registry.NewCounterFunc("latlongapi_cache_misses_total", "Reverse geocoding cache misses.", func() float64 {
+		return float64(geocodeCache.Stats().Misses)
+	})
+	registry.NewCounterFunc("latlongapi_cache_evictions_total", "Entries evicted from the reverse geocoding cache.", func() float64 {
+		return float64(geocodeCache.Stats().Evictions)
+	})
+	registry.NewGaugeFunc("latlongapi_cache_entries", "Entries in the reverse geocoding cache.", func() float64 {
+		return float64(geocodeCache.Stats().Size)
+	})
+	registry.NewGaugeFunc("latlongapi_cache_hit_ratio", "Share of reverse geocoding lookups served from the cache since startup.", func() float64 {
+		stats := geocodeCache.Stats()
+		if stats.Hits+stats.Misses == 0 {
+			return 0
+		}
+		return float64(stats.Hits) / float64(stats.Hits+stats.Misses)
+	})
+	registry.NewGaugeFunc("latlongapi_auth_active_sessions", "Signed-in sessions with an unexpired, unrevoked refresh token.", func() float64 {
+		n, err := tokenStore.CountActiveSessions(time.Now())
+		if err != nil {
+			slog.Error("error counting active sessions", "error", err)
+			return math.NaN()
+		}
+		return float64(n)
+	})
+}
+
+// metricsHandler serves the registry in the Prometheus text format. When
+// token is set, scrapers must send it as a bearer token.
+func metricsHandler(token string) http.Handler {
+	next := registry.Handler()
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if token != "" {
+			got := r.Header.Get("Authorization")
+			if subtle.ConstantTimeCompare([]byte(got), []byte("Bearer "+token)) != 1 {
+				w.Header().Set("WWW-Authenticate", `Bearer realm="metrics"`)
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// Defaults for the HTTP server.
+const (
+	defaultReadHeaderTimeout = 5 * time.Second
+	defaultReadTimeout       = 30 * time.Second
+	defaultWriteTimeout      = 60 * time.Second
+	defaultIdleTimeout       = 120 * time.Second
+	defaultMaxHeaderBytes    = 1 << 20 // 1 MB
+	defaultShutdownTimeout   = 30 * time.Second
+)
+
+// selfSignedHosts are the names a development certificate is issued for.
+var selfSignedHosts = []string{"localhost", "127.0.0.1", "::1"}
+
+// newServer builds the HTTP server, with timeouts and limits read from the
+// environment so that slow or idle clients cannot hold connections forever.
+func newServer(addr string, handler http.Handler) *http.Server {
+	return &http.Server{
+		Addr:              addr,
+		Handler:           handler,
+		ReadHeaderTimeout: envDuration("READ_HEADER_TIMEOUT", defaultReadHeaderTimeout),
+		ReadTimeout:       envDuration("READ_TIMEOUT", defaultReadTimeout),
+		WriteTimeout:      envDuration("WRITE_TIMEOUT", defaultWriteTimeout),
+		IdleTimeout:       envDuration("IDLE_TIMEOUT", defaultIdleTimeout),
+		MaxHeaderBytes:    envInt("MAX_HEADER_BYTES", defaultMaxHeaderBytes),
+		ErrorLog:          slog.NewLogLogger(slog.Default().Handler(), slog.LevelWarn),
+	}
+}
+
+// loadTLSConfig returns the TLS settings selected by TLS_CERT_FILE and
+// TLS_KEY_FILE, or a self-signed certificate when TLS_SELF_SIGNED=true. It
+// returns nil to serve plain HTTP, for example behind a TLS-terminating proxy.
+func loadTLSConfig(production bool) (*tls.Config, error) {
+	certFile, keyFile := os.Getenv("TLS_CERT_FILE"), os.Getenv("TLS_KEY_FILE")
+	selfSigned := os.Getenv("TLS_SELF_SIGNED") == "true"
+
+	var cert tls.Certificate
+	var err error
+	switch {
+	case certFile != "" || keyFile != "":
+		if certFile == "" || keyFile == "" {
+			return nil, errors.New("TLS_CERT_FILE and TLS_KEY_FILE must be set together")
+		}
+		cert, err = tls.LoadX509KeyPair(certFile, keyFile)
+	case selfSigned:
+		if production {
+			return nil, errors.New("self-signed certificates are for development; set TLS_CERT_FILE and TLS_KEY_FILE in production")
+		}
+		cert, err = selfSignedCertificate(selfSignedHosts)
+	default:
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}, nil
+}
+
+// selfSignedCertificate generates a throwaway certificate for hosts, valid
+// for a year. Browsers will warn about it.
+func selfSignedCertificate(hosts []string) (tls.Certificate, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{Organization: []string{"LatLongAPI development"}},
+		NotBefore:    now.Add(-time.Hour),
+		NotAfter:     now.AddDate(1, 0, 0),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	for _, host := range hosts {
+		if ip := net.ParseIP(host); ip != nil {
+			template.IPAddresses = append(template.IPAddresses, ip)
+		} else {
+			template.DNSNames = append(template.DNSNames, host)
+		}
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return tls.Certificate{}, fmt.Errorf("creating self-signed certificate: %w", err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}, nil
+}
+
+// serve runs srv until it fails or the process receives SIGINT or SIGTERM.
+// On a signal it stops accepting connections and waits up to timeout for
+// in-flight requests to finish before closing the rest. A second signal
+// stops the process immediately.
+func serve(srv *http.Server, timeout time.Duration) error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	errc := make(chan error, 1)
+	go func() {
+		if srv.TLSConfig != nil {
+			errc <- srv.ListenAndServeTLS("", "")
+		} else {
+			errc <- srv.ListenAndServe()
+		}
+	}()
+
+	select {
+	case err := <-errc:
+		return err
+	case <-ctx.Done():
+	}
+	stop()
+
+	slog.Info("Shutting down, draining in-flight requests", "timeout", timeout.String())
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		slog.Warn("Drain deadline passed, closing remaining connections", "error", err)
+		return srv.Close()
+	}
+	return nil
+}